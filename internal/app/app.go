@@ -11,6 +11,7 @@ import (
 	"devops-pipeline/internal/config"
 	cryptoutil "devops-pipeline/internal/crypto"
 	"devops-pipeline/internal/httpapi"
+	"devops-pipeline/internal/model"
 	"devops-pipeline/internal/pipeline"
 	"devops-pipeline/internal/store"
 
@@ -33,37 +34,43 @@ func New(cfg config.Config, logger *slog.Logger) (*App, error) {
 		artifactDir,
 		cacheDir,
 	}
-	if cfg.DBDriver == "" || cfg.DBDriver == store.DriverSQLite {
-		dirs = append(dirs, filepath.Dir(cfg.DBSource))
-	}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0o755); err != nil {
 			return nil, fmt.Errorf("create data dir %s: %w", dir, err)
 		}
 	}
 
-	db, err := store.Open(cfg.DBDriver, cfg.DBSource)
+	if cfg.EncryptionSecret() == cfg.SigningSecret() {
+		logger.Warn("APP_SECRET is used both to encrypt credentials and to sign login tokens, set APP_ENCRYPTION_KEY and APP_JWT_SECRET to separate them")
+	}
+
+	appStore, err := openStore(cfg)
 	if err != nil {
 		return nil, err
 	}
-
-	appStore := store.New(db, cryptoutil.New(cfg.Secret), cfg.DBDriver)
 	if err = appStore.Migrate(context.Background()); err != nil {
-		db.Close()
+		appStore.Close()
 		return nil, err
 	}
 
 	// 初始化管理员用户
 	if err = initializeAdminUser(context.Background(), appStore, cfg); err != nil {
-		db.Close()
+		appStore.Close()
 		return nil, fmt.Errorf("initialize admin user: %w", err)
 	}
 	if err = appStore.ApplyRunRetention(context.Background()); err != nil {
-		db.Close()
+		appStore.Close()
 		return nil, fmt.Errorf("apply run retention: %w", err)
 	}
+	if err = appStore.ApplyAuditRetention(context.Background()); err != nil {
+		appStore.Close()
+		return nil, fmt.Errorf("apply audit retention: %w", err)
+	}
 
 	executor := pipeline.NewExecutor(appStore, logger, cfg.WorkspaceDir, artifactDir, cacheDir)
+	if err = executor.PruneArtifacts(context.Background()); err != nil {
+		logger.Warn("prune artifacts failed", "error", err)
+	}
 
 	return &App{
 		store:    appStore,
@@ -72,6 +79,21 @@ func New(cfg config.Config, logger *slog.Logger) (*App, error) {
 	}, nil
 }
 
+// openStore opens the configured database without running migrations.
+func openStore(cfg config.Config) (*store.Store, error) {
+	if cfg.DBDriver == "" || cfg.DBDriver == store.DriverSQLite {
+		if err := os.MkdirAll(filepath.Dir(cfg.DBSource), 0o755); err != nil {
+			return nil, fmt.Errorf("create data dir %s: %w", filepath.Dir(cfg.DBSource), err)
+		}
+	}
+
+	db, err := store.Open(cfg.DBDriver, cfg.DBSource)
+	if err != nil {
+		return nil, err
+	}
+	return store.New(db, cryptoutil.New(cfg.EncryptionSecret(), cfg.PreviousEncryptionKeys...), cfg.DBDriver), nil
+}
+
 func (a *App) Handler() http.Handler {
 	return a.handler
 }
@@ -82,20 +104,26 @@ func (a *App) Close() error {
 
 // FixRunningRuns 修复所有卡在运行中的部署记录
 func (a *App) FixRunningRuns(ctx context.Context) error {
-	// 获取最近1000条记录进行修复，避免数据量过大
-	runs, err := a.store.ListAllRuns(ctx, 0, 1000)
-	if err != nil {
-		return err
-	}
-
 	fixedCount := 0
-	for _, run := range runs {
-		if run.Status == "running" {
-			if err := a.store.FinalizeRun(ctx, run.ID, "failed", "deployment interrupted by server restart"); err != nil {
+	query := model.RunListQuery{
+		Filter: model.RunFilter{Statuses: []string{model.RunStatusRunning}},
+		Limit:  200,
+	}
+	for {
+		page, err := a.store.ListRunPage(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, run := range page.Runs {
+			if err := a.store.FinalizeRun(ctx, run.ID, model.RunStatusFailed, "deployment interrupted by server restart"); err != nil {
 				continue
 			}
 			fixedCount++
 		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
 	}
 
 	if fixedCount > 0 {
@@ -107,7 +135,7 @@ func (a *App) FixRunningRuns(ctx context.Context) error {
 
 func initializeAdminUser(ctx context.Context, store *store.Store, cfg config.Config) error {
 	// 检查管理员用户是否已存在
-	exists, err := store.AdminUserExists(ctx)
+	exists, err := store.HasUsers(ctx)
 	if err != nil {
 		return err
 	}
@@ -119,7 +147,7 @@ func initializeAdminUser(ctx context.Context, store *store.Store, cfg config.Con
 			return fmt.Errorf("generate password hash: %w", err)
 		}
 
-		_, err = store.CreateAdminUser(ctx, cfg.AdminUsername, string(passwordHash))
+		_, err = store.CreateUser(ctx, cfg.AdminUsername, string(passwordHash), model.RoleAdmin)
 		if err != nil {
 			return fmt.Errorf("create admin user: %w", err)
 		}
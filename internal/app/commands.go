@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"devops-pipeline/internal/config"
+	"devops-pipeline/internal/store"
+)
+
+// ErrUnknownCommand is returned by RunCommand for arguments it does not handle.
+var ErrUnknownCommand = errors.New("unknown command")
+
+const commandUsage = `usage:
+  server                    start the HTTP server
+  server migrate status     print applied and pending schema migrations
+  server migrate up         apply pending schema migrations and exit
+  server db copy -to-driver DRIVER -to-source SOURCE [-from-driver DRIVER -from-source SOURCE]
+                            copy all data into another database; the source
+                            defaults to APP_DB_DRIVER / APP_DB_SOURCE
+  server keys rotate        re-encrypt all stored credentials with APP_ENCRYPTION_KEY;
+                            the old key must be listed in APP_PREVIOUS_ENCRYPTION_KEYS`
+
+// RunCommand runs a one-off maintenance command given on the command line
+// instead of starting the server.
+func RunCommand(ctx context.Context, cfg config.Config, args []string, out io.Writer) error {
+	if len(args) == 2 && args[0] == "migrate" {
+		switch args[1] {
+		case "status":
+			return migrateStatus(ctx, cfg, out)
+		case "up":
+			return migrateUp(ctx, cfg, out)
+		}
+	}
+	if len(args) >= 2 && args[0] == "db" && args[1] == "copy" {
+		return copyDatabase(ctx, cfg, args[2:], out)
+	}
+	if len(args) == 2 && args[0] == "keys" && args[1] == "rotate" {
+		return rotateKeys(ctx, cfg, out)
+	}
+	return fmt.Errorf("%w: %v\n%s", ErrUnknownCommand, args, commandUsage)
+}
+
+func migrateStatus(ctx context.Context, cfg config.Config, out io.Writer) error {
+	appStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer appStore.Close()
+
+	migrations, err := appStore.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := appStore.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "schema version %d, latest %d\n\n", current, appStore.LatestSchemaVersion())
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tDURATION")
+	for _, migration := range migrations {
+		if migration.AppliedAt == nil {
+			fmt.Fprintf(writer, "%d\t%s\tpending\t-\t-\n", migration.Version, migration.Name)
+			continue
+		}
+		fmt.Fprintf(writer, "%d\t%s\tapplied\t%s\t%s\n",
+			migration.Version,
+			migration.Name,
+			migration.AppliedAt.Local().Format(time.DateTime),
+			time.Duration(migration.DurationMS)*time.Millisecond,
+		)
+	}
+	return writer.Flush()
+}
+
+func migrateUp(ctx context.Context, cfg config.Config, out io.Writer) error {
+	appStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer appStore.Close()
+
+	before, err := appStore.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if err := appStore.Migrate(ctx); err != nil {
+		return err
+	}
+	after, err := appStore.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if after == before {
+		fmt.Fprintf(out, "schema is up to date at version %d\n", after)
+		return nil
+	}
+	fmt.Fprintf(out, "migrated schema from version %d to %d\n", before, after)
+	return nil
+}
+
+func copyDatabase(ctx context.Context, cfg config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("db copy", flag.ContinueOnError)
+	flags.SetOutput(out)
+	fromDriver := flags.String("from-driver", cfg.DBDriver, "source database driver")
+	fromSource := flags.String("from-source", cfg.DBSource, "source database DSN or SQLite path")
+	toDriver := flags.String("to-driver", "", "target database driver")
+	toSource := flags.String("to-source", "", "target database DSN or SQLite path")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*toDriver) == "" || strings.TrimSpace(*toSource) == "" {
+		return errors.New("db copy: -to-driver and -to-source are required")
+	}
+	if *toDriver == *fromDriver && *toSource == *fromSource {
+		return errors.New("db copy: source and target are the same database")
+	}
+
+	sourceCfg := cfg
+	sourceCfg.DBDriver, sourceCfg.DBSource = *fromDriver, *fromSource
+	source, err := openStore(sourceCfg)
+	if err != nil {
+		return fmt.Errorf("open source database: %w", err)
+	}
+	defer source.Close()
+
+	targetCfg := cfg
+	targetCfg.DBDriver, targetCfg.DBSource = *toDriver, *toSource
+	target, err := openStore(targetCfg)
+	if err != nil {
+		return fmt.Errorf("open target database: %w", err)
+	}
+	defer target.Close()
+
+	results, err := store.CopyDatabase(ctx, source, target, func(table string, copied int64) {
+		fmt.Fprintf(out, "%s: %d rows\n", table, copied)
+	})
+	if len(results) > 0 {
+		writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "\nTABLE\tCOPIED\tSOURCE\tTARGET")
+		for _, result := range results {
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%d\n", result.Table, result.CopiedRows, result.SourceRows, result.TargetRows)
+		}
+		writer.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "copy finished, row counts match")
+	return nil
+}
+
+func rotateKeys(ctx context.Context, cfg config.Config, out io.Writer) error {
+	appStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer appStore.Close()
+
+	current, err := appStore.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if latest := appStore.LatestSchemaVersion(); current != latest {
+		return fmt.Errorf("keys rotate: database is at schema version %d, run migrate up first", current)
+	}
+
+	results, err := appStore.RotateEncryptionKey(ctx)
+	if err != nil {
+		return fmt.Errorf("keys rotate: %w; nothing was changed", err)
+	}
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TABLE\tCOLUMN\tVALUES\tROTATED")
+	var rotated int64
+	for _, result := range results {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\n", result.Table, result.Column, result.Values, result.Rotated)
+		rotated += result.Rotated
+	}
+	writer.Flush()
+	fmt.Fprintf(out, "\nre-encrypted %d values with key %s; APP_PREVIOUS_ENCRYPTION_KEYS can now be removed\n", rotated, appStore.EncryptionKeyID())
+	return nil
+}
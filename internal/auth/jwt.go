@@ -11,6 +11,8 @@ import (
 type Claims struct {
 	UserID   int64  `json:"user_id"`
 	Username string `json:"username"`
+	// SessionID 指向 user_sessions 中的登录会话，会话被吊销后令牌立即失效
+	SessionID int64 `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -24,10 +26,12 @@ func NewJWTManager(secret string) *JWTManager {
 	}
 }
 
-func (j *JWTManager) GenerateToken(userID int64, username string, expiration time.Duration) (string, error) {
+// GenerateToken returns an access token for a login session.
+func (j *JWTManager) GenerateToken(userID int64, username string, sessionID int64, expiration time.Duration) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -55,6 +59,10 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 	if !ok || !token.Valid {
 		return nil, errors.New("invalid token")
 	}
+	// 登录令牌不带 subject，OIDC 状态和两步验证的挑战令牌不能当作登录令牌使用
+	if claims.Subject != "" {
+		return nil, errors.New("invalid token")
+	}
 
 	return claims, nil
 }
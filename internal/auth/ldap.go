@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/config"
+	"devops-pipeline/internal/model"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// ErrLDAPInvalidCredentials means the directory has no such user or rejected
+// the password; the caller may still try a local account.
+var ErrLDAPInvalidCredentials = errors.New("invalid ldap credentials")
+
+// LDAPProvider authenticates users with a search followed by a bind as the
+// user that was found.
+type LDAPProvider struct {
+	config config.LDAPConfig
+	roles  RoleMapping
+}
+
+// LDAPIdentity is a directory user that passed authentication. Groups holds
+// each group's DN as well as its CN so either can be used in role mappings.
+type LDAPIdentity struct {
+	DN       string
+	Username string
+	Groups   []string
+}
+
+// NewLDAPProvider validates cfg and returns a provider, or nil when LDAP login
+// is not configured.
+func NewLDAPProvider(cfg config.LDAPConfig) (*LDAPProvider, error) {
+	if strings.TrimSpace(cfg.URL) == "" {
+		return nil, nil
+	}
+	if strings.TrimSpace(cfg.BaseDN) == "" {
+		return nil, errors.New("LDAP_BASE_DN is required")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, errors.New("LDAP_USER_FILTER must contain %s for the username")
+	}
+	if cfg.GroupFilter != "" && !strings.Contains(cfg.GroupFilter, "%s") {
+		return nil, errors.New("LDAP_GROUP_FILTER must contain %s for the user DN")
+	}
+	if cfg.GroupBaseDN == "" {
+		cfg.GroupBaseDN = cfg.BaseDN
+	}
+	if cfg.DefaultRole != "" && !model.ValidRole(cfg.DefaultRole) {
+		return nil, fmt.Errorf("invalid LDAP_DEFAULT_ROLE %q", cfg.DefaultRole)
+	}
+	// 分组 DN 本身含有逗号，映射之间只能用分号分隔
+	roles, err := ParseRoleMapping(cfg.RoleMapping, ";")
+	if err != nil {
+		return nil, fmt.Errorf("LDAP_ROLE_MAPPING: %w", err)
+	}
+	return &LDAPProvider{config: cfg, roles: roles}, nil
+}
+
+// SyncRoles reports whether group mappings are configured, in which case the
+// directory decides the role of existing accounts on every login.
+func (p *LDAPProvider) SyncRoles() bool {
+	return len(p.roles) > 0
+}
+
+// MapRole returns the highest role granted by groups, the default role when
+// no group matches, or "" when the user may not sign in.
+func (p *LDAPProvider) MapRole(groups []string) string {
+	return p.roles.Role(groups, p.config.DefaultRole)
+}
+
+// Authenticate looks the user up and binds with the given password. It
+// returns ErrLDAPInvalidCredentials for unknown users and wrong passwords;
+// other errors mean the directory could not be used.
+func (p *LDAPProvider) Authenticate(username, password string) (LDAPIdentity, error) {
+	// 空密码会被很多目录服务当作匿名绑定而成功，必须提前拒绝
+	if username == "" || password == "" {
+		return LDAPIdentity{}, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return LDAPIdentity{}, err
+	}
+	defer conn.Close()
+
+	if err := p.bindService(conn); err != nil {
+		return LDAPIdentity{}, err
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(ldapTimeout.Seconds()),
+		false,
+		strings.ReplaceAll(p.config.UserFilter, "%s", ldap.EscapeFilter(username)),
+		p.userAttributes(),
+		nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || (err == nil && len(result.Entries) > 1) {
+		return LDAPIdentity{}, fmt.Errorf("ldap user filter matches more than one entry for %q", username)
+	}
+	if err != nil {
+		return LDAPIdentity{}, fmt.Errorf("search ldap user: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return LDAPIdentity{}, ErrLDAPInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return LDAPIdentity{}, ErrLDAPInvalidCredentials
+		}
+		return LDAPIdentity{}, fmt.Errorf("bind ldap user: %w", err)
+	}
+
+	identity := LDAPIdentity{DN: entry.DN, Username: username}
+	if p.config.UsernameAttribute != "" {
+		if value := strings.TrimSpace(entry.GetAttributeValue(p.config.UsernameAttribute)); value != "" {
+			identity.Username = value
+		}
+	}
+	groupDNs := []string{}
+	if p.config.GroupAttribute != "" {
+		groupDNs = append(groupDNs, entry.GetAttributeValues(p.config.GroupAttribute)...)
+	}
+	if p.config.GroupFilter != "" {
+		// 普通用户未必有权限搜索分组，用服务账号重新绑定
+		if err := p.bindService(conn); err != nil {
+			return LDAPIdentity{}, err
+		}
+		groups, err := p.searchGroups(conn, entry.DN)
+		if err != nil {
+			return LDAPIdentity{}, err
+		}
+		groupDNs = append(groupDNs, groups...)
+	}
+	identity.Groups = groupNames(groupDNs)
+	return identity, nil
+}
+
+func (p *LDAPProvider) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.config.InsecureSkipVerify}
+	conn, err := ldap.DialURL(
+		p.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connect ldap: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+	if p.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (p *LDAPProvider) bindService(conn *ldap.Conn) error {
+	if p.config.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+		return fmt.Errorf("bind ldap service account: %w", err)
+	}
+	return nil
+}
+
+func (p *LDAPProvider) userAttributes() []string {
+	var attributes []string
+	if p.config.UsernameAttribute != "" {
+		attributes = append(attributes, p.config.UsernameAttribute)
+	}
+	if p.config.GroupAttribute != "" {
+		attributes = append(attributes, p.config.GroupAttribute)
+	}
+	if len(attributes) == 0 {
+		// 1.1 表示不返回任何属性，空列表则会返回全部属性
+		return []string{"1.1"}
+	}
+	return attributes
+}
+
+func (p *LDAPProvider) searchGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.GroupBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		int(ldapTimeout.Seconds()),
+		false,
+		strings.ReplaceAll(p.config.GroupFilter, "%s", ldap.EscapeFilter(userDN)),
+		[]string{"1.1"},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("search ldap groups: %w", err)
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+// groupNames returns every group DN followed by the value of its first RDN,
+// usually the CN, skipping duplicates.
+func groupNames(groupDNs []string) []string {
+	seen := make(map[string]bool, len(groupDNs)*2)
+	names := make([]string, 0, len(groupDNs)*2)
+	add := func(name string) {
+		key := strings.ToLower(name)
+		if name != "" && !seen[key] {
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+	for _, groupDN := range groupDNs {
+		add(groupDN)
+		if parsed, err := ldap.ParseDN(groupDN); err == nil && len(parsed.RDNs) > 0 && len(parsed.RDNs[0].Attributes) > 0 {
+			add(parsed.RDNs[0].Attributes[0].Value)
+		}
+	}
+	return names
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"devops-pipeline/internal/config"
+	"devops-pipeline/internal/model"
+
+	"github.com/jimlambrt/gldap"
+)
+
+const (
+	testBaseDN     = "dc=example,dc=com"
+	testServiceDN  = "cn=svc,dc=example,dc=com"
+	testServicePwd = "svc-secret"
+)
+
+type testLDAPUser struct {
+	dn       string
+	uid      string
+	password string
+	memberOf []string
+}
+
+// testDirectory is an in-process LDAP server with a fixed set of users and
+// groups. It answers "(uid=...)" user searches and "(member=...)" group
+// searches, which is all the provider sends.
+type testDirectory struct {
+	users  []testLDAPUser
+	groups map[string][]string // group DN -> member DNs
+	addr   string
+	binds  []string
+}
+
+func startTestDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+	directory := &testDirectory{
+		users: []testLDAPUser{
+			{
+				dn:       "uid=alice,ou=people,dc=example,dc=com",
+				uid:      "alice",
+				password: "alice-pw",
+				memberOf: []string{"cn=devops-admins,ou=groups,dc=example,dc=com"},
+			},
+			{dn: "uid=bob,ou=people,dc=example,dc=com", uid: "bob", password: "bob-pw"},
+		},
+		groups: map[string][]string{
+			"cn=developers,ou=groups,dc=example,dc=com": {"uid=bob,ou=people,dc=example,dc=com"},
+		},
+	}
+
+	server, err := gldap.NewServer()
+	if err != nil {
+		t.Fatalf("new ldap server: %v", err)
+	}
+	mux, err := gldap.NewMux()
+	if err != nil {
+		t.Fatalf("new ldap mux: %v", err)
+	}
+	if err := mux.Bind(directory.handleBind); err != nil {
+		t.Fatalf("register bind: %v", err)
+	}
+	if err := mux.Search(directory.handleSearch); err != nil {
+		t.Fatalf("register search: %v", err)
+	}
+	if err := server.Router(mux); err != nil {
+		t.Fatalf("set router: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve port: %v", err)
+	}
+	directory.addr = listener.Addr().String()
+	listener.Close()
+	go server.Run(directory.addr)
+	t.Cleanup(func() { server.Stop() })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("ldap server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return directory
+}
+
+func (d *testDirectory) handleBind(w *gldap.ResponseWriter, r *gldap.Request) {
+	response := r.NewBindResponse(gldap.WithResponseCode(gldap.ResultInvalidCredentials))
+	defer w.Write(response)
+
+	message, err := r.GetSimpleBindMessage()
+	if err != nil {
+		return
+	}
+	d.binds = append(d.binds, message.UserName)
+	if message.UserName == testServiceDN && string(message.Password) == testServicePwd {
+		response.SetResultCode(gldap.ResultSuccess)
+		return
+	}
+	for _, user := range d.users {
+		if message.UserName == user.dn && string(message.Password) == user.password {
+			response.SetResultCode(gldap.ResultSuccess)
+			return
+		}
+	}
+}
+
+func (d *testDirectory) handleSearch(w *gldap.ResponseWriter, r *gldap.Request) {
+	done := r.NewSearchDoneResponse(gldap.WithResponseCode(gldap.ResultSuccess))
+	defer w.Write(done)
+
+	message, err := r.GetSearchMessage()
+	if err != nil {
+		done.SetResultCode(gldap.ResultOperationsError)
+		return
+	}
+	for _, user := range d.users {
+		if message.Filter == fmt.Sprintf("(uid=%s)", user.uid) {
+			w.Write(r.NewSearchResponseEntry(user.dn, gldap.WithAttributes(map[string][]string{
+				"uid":      {user.uid},
+				"memberOf": user.memberOf,
+			})))
+		}
+	}
+	for groupDN, members := range d.groups {
+		for _, member := range members {
+			if message.Filter == fmt.Sprintf("(member=%s)", member) {
+				w.Write(r.NewSearchResponseEntry(groupDN))
+			}
+		}
+	}
+}
+
+func testLDAPConfig(directory *testDirectory) config.LDAPConfig {
+	return config.LDAPConfig{
+		URL:               "ldap://" + directory.addr,
+		BindDN:            testServiceDN,
+		BindPassword:      testServicePwd,
+		BaseDN:            testBaseDN,
+		UserFilter:        "(uid=%s)",
+		UsernameAttribute: "uid",
+		GroupAttribute:    "memberOf",
+		GroupFilter:       "(member=%s)",
+		RoleMapping:       "devops-admins=admin;cn=developers,ou=groups,dc=example,dc=com=deployer",
+	}
+}
+
+func TestLDAPAuthenticateMapsGroups(t *testing.T) {
+	directory := startTestDirectory(t)
+	provider, err := NewLDAPProvider(testLDAPConfig(directory))
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+
+	tests := []struct {
+		username, password, wantRole string
+	}{
+		{username: "alice", password: "alice-pw", wantRole: model.RoleAdmin},
+		{username: "bob", password: "bob-pw", wantRole: model.RoleDeployer},
+	}
+	for _, tt := range tests {
+		identity, err := provider.Authenticate(tt.username, tt.password)
+		if err != nil {
+			t.Fatalf("authenticate %s: %v", tt.username, err)
+		}
+		if identity.Username != tt.username {
+			t.Fatalf("unexpected username %q", identity.Username)
+		}
+		if role := provider.MapRole(identity.Groups); role != tt.wantRole {
+			t.Fatalf("%s: expected role %q from groups %v, got %q", tt.username, tt.wantRole, identity.Groups, role)
+		}
+	}
+}
+
+func TestLDAPAuthenticateRejectsBadCredentials(t *testing.T) {
+	directory := startTestDirectory(t)
+	provider, err := NewLDAPProvider(testLDAPConfig(directory))
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+
+	for name, credentials := range map[string][2]string{
+		"wrong password": {"alice", "nope"},
+		"unknown user":   {"carol", "carol-pw"},
+		"empty password": {"alice", ""},
+		"filter inject":  {"*", "alice-pw"},
+	} {
+		if _, err := provider.Authenticate(credentials[0], credentials[1]); !errors.Is(err, ErrLDAPInvalidCredentials) {
+			t.Fatalf("%s: expected invalid credentials, got %v", name, err)
+		}
+	}
+	for _, dn := range directory.binds {
+		if dn == "" {
+			t.Fatal("expected no anonymous bind")
+		}
+	}
+}
+
+func TestLDAPAuthenticateReportsUnavailableDirectory(t *testing.T) {
+	directory := startTestDirectory(t)
+	cfg := testLDAPConfig(directory)
+	cfg.BindPassword = "wrong"
+	provider, err := NewLDAPProvider(cfg)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	if _, err := provider.Authenticate("alice", "alice-pw"); err == nil || errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Fatalf("expected a service account error, got %v", err)
+	}
+}
+
+func TestNewLDAPProviderValidatesConfig(t *testing.T) {
+	if provider, err := NewLDAPProvider(config.LDAPConfig{}); provider != nil || err != nil {
+		t.Fatalf("expected ldap to stay disabled without a url, got %v, %v", provider, err)
+	}
+	invalid := map[string]config.LDAPConfig{
+		"no base dn":   {URL: "ldap://x"},
+		"no user slot": {URL: "ldap://x", BaseDN: testBaseDN, UserFilter: "(uid=admin)"},
+		"bad mapping":  {URL: "ldap://x", BaseDN: testBaseDN, RoleMapping: "admins=root"},
+		"bad default":  {URL: "ldap://x", BaseDN: testBaseDN, DefaultRole: "owner"},
+	}
+	for name, cfg := range invalid {
+		if _, err := NewLDAPProvider(cfg); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseRoleMappingAcceptsDNs(t *testing.T) {
+	mapping, err := ParseRoleMapping("cn=ops,ou=groups,dc=example,dc=com=maintainer; dev = deployer", ";")
+	if err != nil {
+		t.Fatalf("parse mapping: %v", err)
+	}
+	if got := mapping.Role([]string{"CN=ops,ou=groups,dc=example,dc=com"}, ""); got != model.RoleMaintainer {
+		t.Fatalf("expected maintainer for group dn, got %q", got)
+	}
+	if got := mapping.Role([]string{"dev"}, ""); got != model.RoleDeployer {
+		t.Fatalf("expected deployer, got %q", got)
+	}
+	if got := mapping.Role([]string{"sales"}, ""); got != "" {
+		t.Fatalf("expected no role, got %q", got)
+	}
+}
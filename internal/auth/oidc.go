@@ -0,0 +1,526 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-pipeline/internal/config"
+	"devops-pipeline/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval 限制遇到未知 kid 时重新拉取签名公钥的频率
+const jwksRefreshInterval = time.Minute
+
+const oidcStateSubject = "oidc_state"
+
+// OIDCProvider signs users in through the authorization code flow with PKCE.
+// With an issuer it discovers the endpoints and verifies the ID token; plain
+// OAuth2 providers are supported through their userinfo endpoint.
+type OIDCProvider struct {
+	config config.OIDCConfig
+	client *http.Client
+	roles  RoleMapping
+
+	mu          sync.Mutex
+	endpoints   *oidcEndpoints
+	keys        map[string]any
+	keysFetched time.Time
+}
+
+type oidcEndpoints struct {
+	Issuer      string `json:"issuer"`
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+	JWKSURL     string `json:"jwks_uri"`
+}
+
+// OIDCIdentity is the account described by the provider's claims.
+type OIDCIdentity struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// OIDCState is carried in a signed cookie from the login redirect to the
+// callback, binding the callback to the browser that started the flow.
+type OIDCState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// NewOIDCProvider validates cfg and returns a provider, or nil when single
+// sign-on is not configured.
+func NewOIDCProvider(cfg config.OIDCConfig, client *http.Client) (*OIDCProvider, error) {
+	if strings.TrimSpace(cfg.ClientID) == "" {
+		return nil, nil
+	}
+	cfg.Issuer = strings.TrimRight(strings.TrimSpace(cfg.Issuer), "/")
+	if cfg.Issuer == "" {
+		if cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "" {
+			return nil, errors.New("OIDC_ISSUER, or OIDC_AUTH_URL, OIDC_TOKEN_URL and OIDC_USERINFO_URL are required")
+		}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.Scopes == "" {
+		cfg.Scopes = "openid profile email"
+	}
+	if cfg.DefaultRole != "" && !model.ValidRole(cfg.DefaultRole) {
+		return nil, fmt.Errorf("invalid OIDC_DEFAULT_ROLE %q", cfg.DefaultRole)
+	}
+	roles, err := ParseRoleMapping(cfg.RoleMapping, ",;")
+	if err != nil {
+		return nil, fmt.Errorf("OIDC_ROLE_MAPPING: %w", err)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	return &OIDCProvider{config: cfg, client: client, roles: roles}, nil
+}
+
+func (p *OIDCProvider) DisplayName() string {
+	return p.config.DisplayName
+}
+
+// SyncRoles reports whether group mappings are configured, in which case the
+// provider decides the role of existing accounts on every login.
+func (p *OIDCProvider) SyncRoles() bool {
+	return len(p.roles) > 0
+}
+
+// MapRole returns the highest role granted by groups, the default role when
+// no group matches, or "" when the user may not sign in.
+func (p *OIDCProvider) MapRole(groups []string) string {
+	return p.roles.Role(groups, p.config.DefaultRole)
+}
+
+// AuthCodeURL returns the provider URL the browser is sent to.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, redirectURL string, state OIDCState) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {p.config.Scopes},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(endpoints.AuthURL, "?") {
+		separator = "&"
+	}
+	return endpoints.AuthURL + separator + params.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and resolves the
+// identity from the verified ID token and, when needed, the userinfo
+// endpoint.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, redirectURL string, state OIDCState) (OIDCIdentity, error) {
+	if code == "" {
+		return OIDCIdentity{}, errors.New("authorization code is missing")
+	}
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {state.Verifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	if err := p.doJSON(request, &tokens); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("exchange authorization code: %w", err)
+	}
+
+	claims := map[string]any{}
+	if endpoints.JWKSURL != "" {
+		if tokens.IDToken == "" {
+			return OIDCIdentity{}, errors.New("provider returned no id_token")
+		}
+		if claims, err = p.verifyIDToken(ctx, endpoints, tokens.IDToken); err != nil {
+			return OIDCIdentity{}, fmt.Errorf("verify id_token: %w", err)
+		}
+		if nonce, _ := claims["nonce"].(string); nonce != state.Nonce {
+			return OIDCIdentity{}, errors.New("id_token nonce does not match")
+		}
+	}
+
+	// 很多服务只在 userinfo 中返回用户名或分组，ID token 已包含时不再额外请求
+	_, hasUsername := lookupClaim(claims, p.config.UsernameClaim)
+	_, hasGroups := lookupClaim(claims, p.config.GroupsClaim)
+	hasSubject := p.subject(claims) != ""
+	if endpoints.UserInfoURL != "" && tokens.AccessToken != "" && (!hasSubject || !hasUsername || (p.config.GroupsClaim != "" && !hasGroups)) {
+		userInfo, err := p.userInfo(ctx, endpoints.UserInfoURL, tokens.AccessToken)
+		if err != nil {
+			return OIDCIdentity{}, err
+		}
+		if subject, ok := claims["sub"]; ok && userInfo["sub"] != subject {
+			return OIDCIdentity{}, errors.New("userinfo subject does not match id_token")
+		}
+		for key, value := range userInfo {
+			if _, exists := claims[key]; !exists {
+				claims[key] = value
+			}
+		}
+	}
+
+	identity := OIDCIdentity{Groups: claimStrings(claims, p.config.GroupsClaim)}
+	identity.Subject = p.subject(claims)
+	if identity.Subject == "" {
+		return OIDCIdentity{}, fmt.Errorf("claims %q and %q are missing", "sub", p.config.SubjectClaim)
+	}
+	identity.Username = claimString(claims, p.config.UsernameClaim)
+	if identity.Username == "" {
+		return OIDCIdentity{}, fmt.Errorf("claim %q is missing", p.config.UsernameClaim)
+	}
+	return identity, nil
+}
+
+// subject returns the stable user id: sub, or the configured claim for plain
+// OAuth2 providers whose userinfo has none.
+func (p *OIDCProvider) subject(claims map[string]any) string {
+	if subject := claimID(claims, "sub"); subject != "" {
+		return subject
+	}
+	if p.config.SubjectClaim == "" {
+		return ""
+	}
+	return claimID(claims, p.config.SubjectClaim)
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (oidcEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return *p.endpoints, nil
+	}
+
+	var endpoints oidcEndpoints
+	if p.config.Issuer != "" {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+		if err != nil {
+			return oidcEndpoints{}, err
+		}
+		if err := p.doJSON(request, &endpoints); err != nil {
+			return oidcEndpoints{}, fmt.Errorf("discover oidc provider: %w", err)
+		}
+		if strings.TrimRight(endpoints.Issuer, "/") != p.config.Issuer {
+			return oidcEndpoints{}, fmt.Errorf("discovered issuer %q does not match %q", endpoints.Issuer, p.config.Issuer)
+		}
+	}
+	if p.config.AuthURL != "" {
+		endpoints.AuthURL = p.config.AuthURL
+	}
+	if p.config.TokenURL != "" {
+		endpoints.TokenURL = p.config.TokenURL
+	}
+	if p.config.UserInfoURL != "" {
+		endpoints.UserInfoURL = p.config.UserInfoURL
+	}
+	if endpoints.AuthURL == "" || endpoints.TokenURL == "" {
+		return oidcEndpoints{}, errors.New("oidc provider has no authorization or token endpoint")
+	}
+	p.endpoints = &endpoints
+	return endpoints, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, endpoints oidcEndpoints, raw string) (map[string]any, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(
+		raw,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.signingKey(ctx, endpoints.JWKSURL, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(endpoints.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// signingKey returns the provider key with the given id, refetching the key
+// set when the provider has rotated its keys.
+func (p *OIDCProvider) signingKey(ctx context.Context, jwksURL, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.cachedKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.doJSON(request, &set); err != nil {
+		return nil, fmt.Errorf("fetch signing keys: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key := p.cachedKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) cachedKey(kid string) any {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	// 只有一个公钥且令牌未声明 kid 时直接使用
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (p *OIDCProvider) userInfo(ctx context.Context, userInfoURL, accessToken string) (map[string]any, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	userInfo := map[string]any{}
+	if err := p.doJSON(request, &userInfo); err != nil {
+		return nil, fmt.Errorf("fetch userinfo: %w", err)
+	}
+	return userInfo, nil
+}
+
+func (p *OIDCProvider) doJSON(request *http.Request, out any) error {
+	request.Header.Set("Accept", "application/json")
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// lookupClaim finds a claim by name, falling back to a dotted path into
+// nested objects such as Keycloak's realm_access.roles.
+func lookupClaim(claims map[string]any, name string) (any, bool) {
+	if name == "" {
+		return nil, false
+	}
+	if value, ok := claims[name]; ok {
+		return value, true
+	}
+	var current any = claims
+	for _, part := range strings.Split(name, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func claimString(claims map[string]any, name string) string {
+	value, _ := lookupClaim(claims, name)
+	text, _ := value.(string)
+	return strings.TrimSpace(text)
+}
+
+// claimID is claimString that also accepts numeric ids, which many OAuth2
+// userinfo endpoints return.
+func claimID(claims map[string]any, name string) string {
+	value, _ := lookupClaim(claims, name)
+	switch typed := value.(type) {
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case json.Number:
+		return typed.String()
+	default:
+		return claimString(claims, name)
+	}
+}
+
+func claimStrings(claims map[string]any, name string) []string {
+	value, _ := lookupClaim(claims, name)
+	switch typed := value.(type) {
+	case string:
+		if typed == "" {
+			return nil
+		}
+		return []string{typed}
+	case []any:
+		values := make([]string, 0, len(typed))
+		for _, item := range typed {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// NewOIDCState returns fresh random values for a login attempt.
+func NewOIDCState() (OIDCState, error) {
+	values := make([]string, 3)
+	for i := range values {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return OIDCState{}, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return OIDCState{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// SignOIDCState signs state for the login cookie.
+func (j *JWTManager) SignOIDCState(state OIDCState, expiration time.Duration) (string, error) {
+	state.RegisteredClaims = jwt.RegisteredClaims{
+		Subject:   oidcStateSubject,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, state).SignedString(j.secretKey)
+}
+
+// ParseOIDCState verifies a login cookie signed by SignOIDCState.
+func (j *JWTManager) ParseOIDCState(tokenString string) (OIDCState, error) {
+	var state OIDCState
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&state,
+		func(token *jwt.Token) (interface{}, error) { return j.secretKey, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithSubject(oidcStateSubject),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return OIDCState{}, err
+	}
+	return state, nil
+}
@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"devops-pipeline/internal/config"
+	"devops-pipeline/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a minimal OpenID Connect provider: discovery, JWKS, a token
+// endpoint that checks the PKCE verifier and a userinfo endpoint.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	// idTokenClaims 覆盖签发的 ID token 中的字段
+	idTokenClaims jwt.MapClaims
+	userInfo      map[string]any
+	issuer        string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]string{
+			"issuer":                 idp.issuer,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"userinfo_endpoint":      idp.server.URL + "/userinfo",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "good-code" || r.PostForm.Get("client_secret") != "s3cret" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   idp.issuer,
+			"sub":   "user-1",
+			"aud":   "devops",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": idp.nonce,
+		}
+		for key, value := range idp.idTokenClaims {
+			claims[key] = value
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeTestJSON(w, map[string]string{"access_token": "access-1", "token_type": "Bearer", "id_token": signed})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		writeTestJSON(w, idp.userInfo)
+	})
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	idp.userInfo = map[string]any{"sub": "user-1", "preferred_username": "alice", "groups": []string{"devops-admins", "staff"}}
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the browser: it follows the login URL and remembers what
+// the provider would have stored for the code.
+func (idp *mockIdP) authorize(t *testing.T, provider *OIDCProvider, state OIDCState) {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), "http://app/callback", state)
+	if err != nil {
+		t.Fatalf("auth code url: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	query := parsed.Query()
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") || query.Get("state") != state.State || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected auth url: %s", authURL)
+	}
+	idp.mu.Lock()
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+	idp.mu.Unlock()
+}
+
+func writeTestJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func testOIDCConfig(issuer string) config.OIDCConfig {
+	return config.OIDCConfig{
+		Issuer:        issuer,
+		ClientID:      "devops",
+		ClientSecret:  "s3cret",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		RoleMapping:   "devops-admins=admin, developers=deployer",
+	}
+}
+
+func TestOIDCLoginWithMockIdP(t *testing.T) {
+	idp := newMockIdP(t)
+	provider, err := NewOIDCProvider(testOIDCConfig(idp.server.URL), idp.server.Client())
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	state, err := NewOIDCState()
+	if err != nil {
+		t.Fatalf("new state: %v", err)
+	}
+	idp.authorize(t, provider, state)
+
+	identity, err := provider.Exchange(context.Background(), "good-code", "http://app/callback", state)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if identity.Subject != "user-1" || identity.Username != "alice" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+	if role := provider.MapRole(identity.Groups); role != model.RoleAdmin {
+		t.Fatalf("expected admin from groups %v, got %q", identity.Groups, role)
+	}
+}
+
+func TestOIDCLoginRejectsBadTokens(t *testing.T) {
+	tests := map[string]func(idp *mockIdP, state *OIDCState){
+		"wrong audience": func(idp *mockIdP, state *OIDCState) { idp.idTokenClaims = jwt.MapClaims{"aud": "other"} },
+		"wrong issuer":   func(idp *mockIdP, state *OIDCState) { idp.idTokenClaims = jwt.MapClaims{"iss": "https://evil"} },
+		"expired": func(idp *mockIdP, state *OIDCState) {
+			idp.idTokenClaims = jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}
+		},
+		"wrong nonce":    func(idp *mockIdP, state *OIDCState) { idp.idTokenClaims = jwt.MapClaims{"nonce": "replayed"} },
+		"wrong verifier": func(idp *mockIdP, state *OIDCState) { state.Verifier = "guessed" },
+		"other subject": func(idp *mockIdP, state *OIDCState) {
+			idp.userInfo = map[string]any{"sub": "user-2", "preferred_username": "mallory"}
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			provider, err := NewOIDCProvider(testOIDCConfig(idp.server.URL), idp.server.Client())
+			if err != nil {
+				t.Fatalf("new provider: %v", err)
+			}
+			state, _ := NewOIDCState()
+			idp.authorize(t, provider, state)
+			tamper(idp, &state)
+
+			if identity, err := provider.Exchange(context.Background(), "good-code", "http://app/callback", state); err == nil {
+				t.Fatalf("expected login to fail, got %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOAuth2LoginUsesUserInfo(t *testing.T) {
+	idp := newMockIdP(t)
+	cfg := testOIDCConfig("")
+	cfg.AuthURL = idp.server.URL + "/authorize"
+	cfg.TokenURL = idp.server.URL + "/token"
+	cfg.UserInfoURL = idp.server.URL + "/userinfo"
+	provider, err := NewOIDCProvider(cfg, idp.server.Client())
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	state, _ := NewOIDCState()
+	idp.authorize(t, provider, state)
+
+	identity, err := provider.Exchange(context.Background(), "good-code", "http://app/callback", state)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if identity.Username != "alice" || len(identity.Groups) != 2 {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+}
+
+func TestOAuth2LoginFallsBackToSubjectClaim(t *testing.T) {
+	idp := newMockIdP(t)
+	cfg := testOIDCConfig("")
+	cfg.AuthURL = idp.server.URL + "/authorize"
+	cfg.TokenURL = idp.server.URL + "/token"
+	cfg.UserInfoURL = idp.server.URL + "/userinfo"
+	cfg.UsernameClaim = "login"
+	cfg.SubjectClaim = "id"
+	provider, err := NewOIDCProvider(cfg, idp.server.Client())
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+
+	// 类似 GitHub 的 userinfo：没有 sub，只有数字 id
+	idp.userInfo = map[string]any{"id": 1234567, "login": "alice"}
+	state, _ := NewOIDCState()
+	idp.authorize(t, provider, state)
+	identity, err := provider.Exchange(context.Background(), "good-code", "http://app/callback", state)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if identity.Subject != "1234567" || identity.Username != "alice" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+
+	idp.userInfo = map[string]any{"login": "alice"}
+	state, _ = NewOIDCState()
+	idp.authorize(t, provider, state)
+	if identity, err := provider.Exchange(context.Background(), "good-code", "http://app/callback", state); err == nil {
+		t.Fatalf("expected a login without a user id to fail, got %+v", identity)
+	}
+}
+
+func TestNewOIDCProviderValidatesConfig(t *testing.T) {
+	if provider, err := NewOIDCProvider(config.OIDCConfig{}, nil); provider != nil || err != nil {
+		t.Fatalf("expected sso to stay disabled without a client id, got %v, %v", provider, err)
+	}
+	invalid := map[string]config.OIDCConfig{
+		"no endpoints": {ClientID: "devops"},
+		"bad mapping":  {ClientID: "devops", Issuer: "https://idp", RoleMapping: "admins"},
+		"bad role":     {ClientID: "devops", Issuer: "https://idp", RoleMapping: "admins=root"},
+		"bad default":  {ClientID: "devops", Issuer: "https://idp", DefaultRole: "owner"},
+	}
+	for name, cfg := range invalid {
+		if _, err := NewOIDCProvider(cfg, nil); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOIDCMapRole(t *testing.T) {
+	provider, err := NewOIDCProvider(config.OIDCConfig{
+		ClientID:    "devops",
+		Issuer:      "https://idp",
+		RoleMapping: "ops=maintainer;devops-admins=admin;dev=deployer",
+		DefaultRole: model.RoleViewer,
+	}, nil)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	tests := []struct {
+		groups []string
+		want   string
+	}{
+		{groups: []string{"dev", "ops"}, want: model.RoleMaintainer},
+		{groups: []string{"devops-admins"}, want: model.RoleAdmin},
+		{groups: []string{"sales"}, want: model.RoleViewer},
+		{groups: nil, want: model.RoleViewer},
+	}
+	for _, tt := range tests {
+		if got := provider.MapRole(tt.groups); got != tt.want {
+			t.Fatalf("MapRole(%v) = %q, want %q", tt.groups, got, tt.want)
+		}
+	}
+}
+
+func TestLookupClaimFollowsNestedPaths(t *testing.T) {
+	claims := map[string]any{
+		"realm_access":              map[string]any{"roles": []any{"ops"}},
+		"https://example.com/group": "dev",
+	}
+	if got := claimStrings(claims, "realm_access.roles"); len(got) != 1 || got[0] != "ops" {
+		t.Fatalf("unexpected nested claim: %v", got)
+	}
+	if got := claimStrings(claims, "https://example.com/group"); len(got) != 1 || got[0] != "dev" {
+		t.Fatalf("unexpected namespaced claim: %v", got)
+	}
+}
+
+func TestOIDCStateRoundTrip(t *testing.T) {
+	manager := NewJWTManager("secret")
+	state, err := NewOIDCState()
+	if err != nil {
+		t.Fatalf("new state: %v", err)
+	}
+	signed, err := manager.SignOIDCState(state, time.Minute)
+	if err != nil {
+		t.Fatalf("sign state: %v", err)
+	}
+	parsed, err := manager.ParseOIDCState(signed)
+	if err != nil || parsed.State != state.State || parsed.Nonce != state.Nonce || parsed.Verifier != state.Verifier {
+		t.Fatalf("unexpected parsed state %+v, %v", parsed, err)
+	}
+
+	if _, err := NewJWTManager("other").ParseOIDCState(signed); err == nil {
+		t.Fatal("expected state signed with another secret to be rejected")
+	}
+	sessionToken, _ := manager.GenerateToken(1, "admin", 1, time.Minute)
+	if _, err := manager.ParseOIDCState(sessionToken); err == nil {
+		t.Fatal("expected a session token to be rejected as login state")
+	}
+}
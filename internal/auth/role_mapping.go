@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"devops-pipeline/internal/model"
+)
+
+// RoleMapping maps group names from an external identity provider to roles.
+type RoleMapping []roleRule
+
+type roleRule struct {
+	group string
+	role  string
+}
+
+// ParseRoleMapping reads "group=role" entries split by any of separators.
+// The role follows the last "=", so LDAP group DNs can be used as names.
+func ParseRoleMapping(value, separators string) (RoleMapping, error) {
+	var mapping RoleMapping
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return strings.ContainsRune(separators, r) }) {
+		entry = strings.TrimSpace(entry)
+		index := strings.LastIndex(entry, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("invalid entry %q, expected group=role", entry)
+		}
+		group, role := strings.TrimSpace(entry[:index]), strings.TrimSpace(entry[index+1:])
+		if group == "" || !model.ValidRole(role) {
+			return nil, fmt.Errorf("invalid entry %q, expected group=role", entry)
+		}
+		mapping = append(mapping, roleRule{group: group, role: role})
+	}
+	return mapping, nil
+}
+
+// Role returns the highest role granted by groups, compared case
+// insensitively, or defaultRole when none matches.
+func (m RoleMapping) Role(groups []string, defaultRole string) string {
+	role := ""
+	for _, rule := range m {
+		for _, group := range groups {
+			if strings.EqualFold(group, rule.group) {
+				role = model.HigherRole(role, rule.role)
+			}
+		}
+	}
+	if role == "" {
+		return defaultRole
+	}
+	return role
+}
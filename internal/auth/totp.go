@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TOTP 参数与常见验证器应用（Google Authenticator、1Password 等）的默认值一致
+const (
+	totpDigits     = 6
+	totpPeriod     = 30 * time.Second
+	totpSkewSteps  = 1
+	totpSecretSize = 20
+
+	// RecoveryCodeCount 是每次生成的恢复码数量
+	RecoveryCodeCount = 10
+
+	loginChallengeSubject = "login_2fa"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// LoginChallenge is handed out after the password step of a login for an
+// account with two-factor authentication; it proves the password was
+// correct until the second step completes.
+type LoginChallenge struct {
+	UserID int64 `json:"challenge_user_id"`
+	// Method 是第一步使用的登录方式，用于审计记录
+	Method string `json:"method,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateTOTPSecret returns a new random shared secret in base32, the form
+// authenticator apps expect.
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI that authenticator apps
+// import, usually by scanning it as a QR code.
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	params := url.Values{
+		"secret":    {secret},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	if issuer != "" {
+		params.Set("issuer", issuer)
+	}
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// ValidateTOTP checks code against secret at now, allowing one period of
+// clock drift either way. It returns the time step that matched so callers
+// can refuse a code that was already used.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for offset := int64(-totpSkewSteps); offset <= totpSkewSteps; offset++ {
+		step := current + offset
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPCode returns the code for secret at t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, t.Unix()/int64(totpPeriod.Seconds())), nil
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	key, err := totpEncoding.DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("decode totp secret: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("totp secret is empty")
+	}
+	return key, nil
+}
+
+// totpCode implements the HOTP truncation of RFC 4226 over a time step (RFC 6238).
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes returns RecoveryCodeCount one-time codes formatted
+// as xxxxx-xxxxx and the hashes that are stored instead of them.
+func GenerateRecoveryCodes() (codes, hashes []string, err error) {
+	// 32 个字符，每个随机字节取低 5 位即可，没有取模偏差
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	codes = make([]string, 0, RecoveryCodeCount)
+	hashes = make([]string, 0, RecoveryCodeCount)
+	buf := make([]byte, 10)
+	for range RecoveryCodeCount {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		var code strings.Builder
+		for i, b := range buf {
+			if i == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(alphabet[b&31])
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, HashRecoveryCode(code.String()))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode normalizes a recovery code as typed by a user (case,
+// dashes and spaces are ignored) and returns its hex SHA-256 digest.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	return HashAPIToken(normalized)
+}
+
+// SignLoginChallenge returns a short-lived token for the second login step.
+func (j *JWTManager) SignLoginChallenge(userID int64, method string, expiration time.Duration) (string, error) {
+	challenge := LoginChallenge{
+		UserID: userID,
+		Method: method,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   loginChallengeSubject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, challenge).SignedString(j.secretKey)
+}
+
+// ParseLoginChallenge verifies a token signed by SignLoginChallenge.
+func (j *JWTManager) ParseLoginChallenge(tokenString string) (LoginChallenge, error) {
+	var challenge LoginChallenge
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&challenge,
+		func(token *jwt.Token) (interface{}, error) { return j.secretKey, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithSubject(loginChallengeSubject),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return LoginChallenge{}, err
+	}
+	return challenge, nil
+}
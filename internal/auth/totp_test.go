@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret 是 RFC 6238 附录 B 中 SHA1 测试向量使用的密钥
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	// RFC 给出的是 8 位验证码，6 位验证码取其后 6 位
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("code at %d: %v", unix, err)
+		}
+		if got != want[2:] {
+			t.Fatalf("code at %d: got %s want %s", unix, got, want[2:])
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfDrift(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(rfc6238Secret, now)
+	if err != nil {
+		t.Fatalf("code: %v", err)
+	}
+	step, ok := ValidateTOTP(rfc6238Secret, code, now.Add(totpPeriod))
+	if !ok || step != now.Unix()/30 {
+		t.Fatalf("expected code from the previous step to pass, got step %d ok %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, now.Add(3*totpPeriod)); ok {
+		t.Fatal("expected a code three steps old to fail")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, bad, now); ok {
+			t.Fatalf("expected %q to fail", bad)
+		}
+	}
+}
+
+func TestGenerateTOTPSecretAndProvisioningURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("generate secret: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Fatalf("expected a 160-bit base32 secret, got %q", secret)
+	}
+	uri := TOTPProvisioningURI("Jimuqu DevOps", "alice@example", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Jimuqu%20DevOps:alice@example?") {
+		t.Fatalf("unexpected label in %q", uri)
+	}
+	for _, param := range []string{"secret=" + secret, "issuer=Jimuqu+DevOps", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Fatalf("expected %q in %q", param, uri)
+		}
+	}
+}
+
+func TestRecoveryCodesHashIgnoringFormatting(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generate recovery codes: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", RecoveryCodeCount, len(codes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Fatalf("expected %q to match the hash of %q", typed, code)
+		}
+	}
+}
+
+func TestLoginChallengeIsNotASessionToken(t *testing.T) {
+	manager := NewJWTManager("secret")
+	challenge, err := manager.SignLoginChallenge(7, "password", time.Minute)
+	if err != nil {
+		t.Fatalf("sign challenge: %v", err)
+	}
+	parsed, err := manager.ParseLoginChallenge(challenge)
+	if err != nil || parsed.UserID != 7 || parsed.Method != "password" {
+		t.Fatalf("parse challenge: %+v, %v", parsed, err)
+	}
+	if _, err := manager.ValidateToken(challenge); err == nil {
+		t.Fatal("expected a login challenge to be rejected as a session token")
+	}
+
+	session, err := manager.GenerateToken(7, "alice", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := manager.ParseLoginChallenge(session); err == nil {
+		t.Fatal("expected a session token to be rejected as a login challenge")
+	}
+}
@@ -3,17 +3,83 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+// DefaultAdminPassword is the well-known initial password. Accounts still
+// using it must change it on their next login.
+const DefaultAdminPassword = "admin123"
+
 type Config struct {
-	Addr          string
-	DataDir       string
-	DBDriver      string
-	DBSource      string
-	WorkspaceDir  string
-	Secret        string
+	Addr         string
+	DataDir      string
+	DBDriver     string
+	DBSource     string
+	WorkspaceDir string
+	// Secret 是旧版本统一使用的密钥，未单独配置时加密密钥和签名密钥都取它
+	Secret string
+	// EncryptionKey 加密库中的 *_cipher 字段，PreviousEncryptionKeys 只用于解密轮换前写入的值
+	EncryptionKey          string
+	PreviousEncryptionKeys []string
+	// JWTSecret 签名登录令牌
+	JWTSecret     string
 	AdminUsername string
 	AdminPassword string
+	// TrustedProxies 是允许通过 X-Forwarded-For / X-Real-IP 传递客户端地址的反向代理，IP 或 CIDR
+	TrustedProxies []string
+	OIDC           OIDCConfig
+	LDAP           LDAPConfig
+}
+
+// OIDCConfig configures single sign-on through an OpenID Connect or plain
+// OAuth2 provider. SSO is enabled once a client ID and either an issuer or
+// explicit endpoints are set.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL 为空时根据 public_base_url 设置或请求地址推导回调地址
+	RedirectURL string
+	Scopes      string
+	// 不支持自动发现的 OAuth2 服务需要手动指定以下端点
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+
+	UsernameClaim string
+	// SubjectClaim 是缺少 sub 时作为用户 ID 的字段，普通 OAuth2 服务（如 GitHub、Gitea）的 userinfo 通常只有 id；
+	// 该字段必须稳定且不可由用户修改，不要填写用户名或邮箱
+	SubjectClaim string
+	GroupsClaim  string
+	// RoleMapping 形如 "devops-admins=admin,developers=deployer"
+	RoleMapping string
+	// DefaultRole 是没有匹配到任何分组时的角色，为空时拒绝登录
+	DefaultRole string
+	DisplayName string
+}
+
+// LDAPConfig configures password login against OpenLDAP or Active Directory.
+// LDAP is tried first when URL is set; local accounts remain as a fallback.
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	// BindDN 为空时匿名搜索用户
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter 中的 %s 会替换为转义后的登录名
+	UserFilter        string
+	UsernameAttribute string
+	// GroupAttribute 是用户条目上记录所属分组 DN 的属性，如 memberOf
+	GroupAttribute string
+	// GroupFilter 不为空时另外搜索分组，%s 会替换为用户 DN
+	GroupFilter string
+	GroupBaseDN string
+	// RoleMapping 形如 "devops-admins=admin;cn=dev,ou=groups,dc=example,dc=com=deployer"
+	RoleMapping string
+	DefaultRole string
 }
 
 func Load() Config {
@@ -23,15 +89,66 @@ func Load() Config {
 	dbSource := env("APP_DB_SOURCE", defaultSQLitePath)
 
 	return Config{
-		Addr:          env("APP_ADDR", ":18080"),
-		DataDir:       dataDir,
-		DBDriver:      dbDriver,
-		DBSource:      dbSource,
-		WorkspaceDir:  env("APP_WORKSPACE_DIR", filepath.Join(dataDir, "workspaces")),
-		Secret:        env("APP_SECRET", "change-me-in-production"),
-		AdminUsername: env("ADMIN_USERNAME", "admin"),
-		AdminPassword: env("ADMIN_PASSWORD", "admin123"),
+		Addr:                   env("APP_ADDR", ":18080"),
+		DataDir:                dataDir,
+		DBDriver:               dbDriver,
+		DBSource:               dbSource,
+		WorkspaceDir:           env("APP_WORKSPACE_DIR", filepath.Join(dataDir, "workspaces")),
+		Secret:                 env("APP_SECRET", "change-me-in-production"),
+		EncryptionKey:          os.Getenv("APP_ENCRYPTION_KEY"),
+		PreviousEncryptionKeys: envList("APP_PREVIOUS_ENCRYPTION_KEYS"),
+		JWTSecret:              os.Getenv("APP_JWT_SECRET"),
+		AdminUsername:          env("ADMIN_USERNAME", "admin"),
+		AdminPassword:          env("ADMIN_PASSWORD", DefaultAdminPassword),
+		TrustedProxies:         envList("APP_TRUSTED_PROXIES"),
+		OIDC: OIDCConfig{
+			Issuer:        os.Getenv("OIDC_ISSUER"),
+			ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:        env("OIDC_SCOPES", "openid profile email"),
+			AuthURL:       os.Getenv("OIDC_AUTH_URL"),
+			TokenURL:      os.Getenv("OIDC_TOKEN_URL"),
+			UserInfoURL:   os.Getenv("OIDC_USERINFO_URL"),
+			UsernameClaim: env("OIDC_USERNAME_CLAIM", "preferred_username"),
+			SubjectClaim:  env("OIDC_SUBJECT_CLAIM", "id"),
+			GroupsClaim:   env("OIDC_GROUPS_CLAIM", "groups"),
+			RoleMapping:   os.Getenv("OIDC_ROLE_MAPPING"),
+			DefaultRole:   os.Getenv("OIDC_DEFAULT_ROLE"),
+			DisplayName:   env("OIDC_DISPLAY_NAME", "SSO"),
+		},
+		LDAP: LDAPConfig{
+			URL:                os.Getenv("LDAP_URL"),
+			StartTLS:           envBool("LDAP_START_TLS"),
+			InsecureSkipVerify: envBool("LDAP_INSECURE_SKIP_VERIFY"),
+			BindDN:             os.Getenv("LDAP_BIND_DN"),
+			BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:             os.Getenv("LDAP_BASE_DN"),
+			UserFilter:         env("LDAP_USER_FILTER", "(uid=%s)"),
+			UsernameAttribute:  env("LDAP_USERNAME_ATTRIBUTE", "uid"),
+			GroupAttribute:     env("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+			GroupFilter:        os.Getenv("LDAP_GROUP_FILTER"),
+			GroupBaseDN:        os.Getenv("LDAP_GROUP_BASE_DN"),
+			RoleMapping:        os.Getenv("LDAP_ROLE_MAPPING"),
+			DefaultRole:        os.Getenv("LDAP_DEFAULT_ROLE"),
+		},
+	}
+}
+
+// EncryptionSecret returns the key used to encrypt stored credentials.
+func (c Config) EncryptionSecret() string {
+	if c.EncryptionKey != "" {
+		return c.EncryptionKey
 	}
+	return c.Secret
+}
+
+// SigningSecret returns the key used to sign login tokens.
+func (c Config) SigningSecret() string {
+	if c.JWTSecret != "" {
+		return c.JWTSecret
+	}
+	return c.Secret
 }
 
 func env(key, fallback string) string {
@@ -40,3 +157,19 @@ func env(key, fallback string) string {
 	}
 	return fallback
 }
+
+// envList splits a comma separated variable, skipping empty entries.
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func envBool(key string) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && value
+}
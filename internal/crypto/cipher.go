@@ -7,17 +7,58 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"strings"
 )
 
+// keyIDSeparator 分隔密文前缀中的密钥 ID，base64 标准字母表中没有这个字符，
+// 因此不带前缀的旧密文可以直接区分出来
+const keyIDSeparator = ":"
+
+// Cipher encrypts with its current key and decrypts with the current key or
+// any previous one. Ciphertexts are prefixed with the id of the key that
+// produced them, so rotation can tell which values still need re-encrypting.
 type Cipher struct {
+	// keys[0] 是当前密钥
+	keys []cipherKey
+}
+
+type cipherKey struct {
+	id  string
 	key []byte
 }
 
-func New(secret string) *Cipher {
+// New derives the current key from secret. previous secrets are only used to
+// decrypt values written before a key rotation.
+func New(secret string, previous ...string) *Cipher {
+	c := &Cipher{keys: []cipherKey{deriveKey(secret)}}
+	for _, old := range previous {
+		if old == "" || old == secret {
+			continue
+		}
+		c.keys = append(c.keys, deriveKey(old))
+	}
+	return c
+}
+
+func deriveKey(secret string) cipherKey {
 	sum := sha256.Sum256([]byte(secret))
-	return &Cipher{key: sum[:]}
+	// 密钥 ID 取密钥本身的摘要，不需要额外配置，也不会泄露密钥
+	fingerprint := sha256.Sum256(sum[:])
+	return cipherKey{id: hex.EncodeToString(fingerprint[:4]), key: sum[:]}
+}
+
+// KeyID returns the id of the current key.
+func (c *Cipher) KeyID() string {
+	return c.keys[0].id
+}
+
+// IsCurrent reports whether encoded was produced by the current key. Empty
+// values count as current since there is nothing to re-encrypt.
+func (c *Cipher) IsCurrent(encoded string) bool {
+	return encoded == "" || strings.HasPrefix(encoded, c.keys[0].id+keyIDSeparator)
 }
 
 func (c *Cipher) Encrypt(plain string) (string, error) {
@@ -25,14 +66,9 @@ func (c *Cipher) Encrypt(plain string) (string, error) {
 		return "", nil
 	}
 
-	block, err := aes.NewCipher(c.key)
+	gcm, err := newGCM(c.keys[0].key)
 	if err != nil {
-		return "", fmt.Errorf("new cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("new gcm: %w", err)
+		return "", err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
@@ -41,7 +77,7 @@ func (c *Cipher) Encrypt(plain string) (string, error) {
 	}
 
 	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
-	return base64.StdEncoding.EncodeToString(sealed), nil
+	return c.keys[0].id + keyIDSeparator + base64.StdEncoding.EncodeToString(sealed), nil
 }
 
 func (c *Cipher) Decrypt(encoded string) (string, error) {
@@ -49,19 +85,35 @@ func (c *Cipher) Decrypt(encoded string) (string, error) {
 		return "", nil
 	}
 
-	raw, err := base64.StdEncoding.DecodeString(encoded)
-	if err != nil {
-		return "", fmt.Errorf("decode base64: %w", err)
+	if keyID, payload, ok := strings.Cut(encoded, keyIDSeparator); ok {
+		for _, key := range c.keys {
+			if key.id == keyID {
+				return open(key.key, payload)
+			}
+		}
+		return "", fmt.Errorf("decrypt: unknown key id %q, configure the key it was written with", keyID)
+	}
+
+	// 轮换前写入的密文没有前缀，依次尝试所有密钥，GCM 认证失败说明不是这把密钥
+	var err error
+	for _, key := range c.keys {
+		var plain string
+		if plain, err = open(key.key, encoded); err == nil {
+			return plain, nil
+		}
 	}
+	return "", err
+}
 
-	block, err := aes.NewCipher(c.key)
+func open(key []byte, payload string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(payload)
 	if err != nil {
-		return "", fmt.Errorf("new cipher: %w", err)
+		return "", fmt.Errorf("decode base64: %w", err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
-		return "", fmt.Errorf("new gcm: %w", err)
+		return "", err
 	}
 
 	nonceSize := gcm.NonceSize()
@@ -78,6 +130,19 @@ func (c *Cipher) Decrypt(encoded string) (string, error) {
 	return string(plain), nil
 }
 
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("new gcm: %w", err)
+	}
+	return gcm, nil
+}
+
 // HMACSHA256 计算HMAC-SHA256签名
 func HMACSHA256(data, key []byte) []byte {
 	h := hmac.New(sha256.New, key)
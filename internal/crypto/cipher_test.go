@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// legacyEncrypt 按轮换前的格式加密：没有密钥 ID 前缀
+func legacyEncrypt(t *testing.T, secret, plain string) string {
+	t.Helper()
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil))
+}
+
+func TestEncryptPrefixesKeyID(t *testing.T) {
+	c := New("current")
+	encoded, err := c.Encrypt("hunter2")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !strings.HasPrefix(encoded, c.KeyID()+":") || !c.IsCurrent(encoded) {
+		t.Fatalf("expected %q to carry key id %q", encoded, c.KeyID())
+	}
+	plain, err := c.Decrypt(encoded)
+	if err != nil || plain != "hunter2" {
+		t.Fatalf("decrypt: %q, %v", plain, err)
+	}
+	if New("current").KeyID() != c.KeyID() || New("other").KeyID() == c.KeyID() {
+		t.Fatal("expected the key id to depend on the key only")
+	}
+}
+
+func TestDecryptWithPreviousKeys(t *testing.T) {
+	old := New("old")
+	written, err := old.Encrypt("hunter2")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	legacy := legacyEncrypt(t, "old", "legacy")
+
+	rotated := New("new", "old")
+	if rotated.IsCurrent(written) || rotated.IsCurrent(legacy) {
+		t.Fatal("expected values of the previous key to need re-encrypting")
+	}
+	if plain, err := rotated.Decrypt(written); err != nil || plain != "hunter2" {
+		t.Fatalf("decrypt prefixed value: %q, %v", plain, err)
+	}
+	if plain, err := rotated.Decrypt(legacy); err != nil || plain != "legacy" {
+		t.Fatalf("decrypt legacy value: %q, %v", plain, err)
+	}
+
+	if _, err := New("new").Decrypt(written); err == nil || !strings.Contains(err.Error(), "unknown key id") {
+		t.Fatalf("expected an unknown key id error, got %v", err)
+	}
+	if _, err := New("new").Decrypt(legacy); err == nil {
+		t.Fatal("expected a legacy value of another key to fail")
+	}
+}
@@ -0,0 +1,184 @@
+package gitprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/model"
+	"devops-pipeline/internal/version"
+)
+
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateFailure = "failure"
+)
+
+// Target identifies the repository and credentials used for status updates.
+type Target struct {
+	Provider string // github/gitlab/gitea
+	APIURL   string // 为空时根据仓库地址推断
+	Token    string
+	RepoURL  string
+}
+
+type CommitStatus struct {
+	State       string
+	TargetURL   string
+	Description string
+	Context     string
+}
+
+type Client struct {
+	client *http.Client
+}
+
+func New(client *http.Client) *Client {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{client: client}
+}
+
+// SetCommitStatus posts a commit status for sha to the provider API.
+func (c *Client) SetCommitStatus(ctx context.Context, target Target, sha string, status CommitStatus) error {
+	if strings.TrimSpace(sha) == "" {
+		return fmt.Errorf("commit sha is required")
+	}
+	if strings.TrimSpace(target.Token) == "" {
+		return fmt.Errorf("commit status token is required")
+	}
+
+	repoHost, repoPath, err := ParseRepoURL(target.RepoURL)
+	if err != nil {
+		return err
+	}
+	apiURL := strings.TrimRight(strings.TrimSpace(target.APIURL), "/")
+
+	var (
+		endpoint string
+		payload  map[string]string
+		headers  = map[string]string{}
+	)
+	switch target.Provider {
+	case model.CommitStatusProviderGitHub:
+		if apiURL == "" {
+			apiURL = "https://api.github.com"
+			if repoHost != "github.com" {
+				// GitHub Enterprise
+				apiURL = fmt.Sprintf("https://%s/api/v3", repoHost)
+			}
+		}
+		endpoint = fmt.Sprintf("%s/repos/%s/statuses/%s", apiURL, repoPath, sha)
+		payload = statusPayload(status, status.State, "context")
+		headers["Authorization"] = "Bearer " + target.Token
+		headers["Accept"] = "application/vnd.github+json"
+	case model.CommitStatusProviderGitea:
+		if apiURL == "" {
+			apiURL = fmt.Sprintf("https://%s/api/v1", repoHost)
+		}
+		endpoint = fmt.Sprintf("%s/repos/%s/statuses/%s", apiURL, repoPath, sha)
+		payload = statusPayload(status, status.State, "context")
+		headers["Authorization"] = "token " + target.Token
+	case model.CommitStatusProviderGitLab:
+		if apiURL == "" {
+			apiURL = fmt.Sprintf("https://%s/api/v4", repoHost)
+		}
+		endpoint = fmt.Sprintf("%s/projects/%s/statuses/%s", apiURL, url.PathEscape(repoPath), sha)
+		payload = statusPayload(status, gitLabState(status.State), "name")
+		headers["PRIVATE-TOKEN"] = target.Token
+	default:
+		return fmt.Errorf("unsupported commit status provider: %s", target.Provider)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal commit status: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create commit status request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", version.AppName)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send commit status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("commit status request failed: status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+func statusPayload(status CommitStatus, state, contextField string) map[string]string {
+	payload := map[string]string{
+		"state":       state,
+		"description": truncateDescription(status.Description),
+		contextField:  status.Context,
+	}
+	if status.TargetURL != "" {
+		payload["target_url"] = status.TargetURL
+	}
+	return payload
+}
+
+func gitLabState(state string) string {
+	if state == StateFailure {
+		return "failed"
+	}
+	return state
+}
+
+// GitHub 限制描述最长 140 个字符
+func truncateDescription(description string) string {
+	runes := []rune(description)
+	if len(runes) <= 140 {
+		return description
+	}
+	return string(runes[:137]) + "..."
+}
+
+// ParseRepoURL extracts the host and the "owner/repo" path (nested groups
+// included) from an HTTP(S) or SCP-style SSH clone URL.
+func ParseRepoURL(repoURL string) (string, string, error) {
+	repoURL = strings.TrimSpace(repoURL)
+	var host, repoPath string
+
+	if strings.Contains(repoURL, "://") {
+		parsed, err := url.Parse(repoURL)
+		if err != nil {
+			return "", "", fmt.Errorf("parse repo url: %w", err)
+		}
+		host, repoPath = parsed.Host, parsed.Path
+		if parsed.Scheme == "ssh" {
+			host = parsed.Hostname()
+		}
+	} else if at := strings.Index(repoURL, "@"); at >= 0 && strings.Contains(repoURL[at:], ":") {
+		rest := repoURL[at+1:]
+		colon := strings.Index(rest, ":")
+		host, repoPath = rest[:colon], rest[colon+1:]
+	} else {
+		return "", "", fmt.Errorf("unsupported repo url: %s", repoURL)
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if host == "" || !strings.Contains(repoPath, "/") {
+		return "", "", fmt.Errorf("cannot determine repository path from %s", repoURL)
+	}
+	return host, repoPath, nil
+}
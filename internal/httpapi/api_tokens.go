@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/auth"
+	"devops-pipeline/internal/model"
+)
+
+const (
+	defaultAPITokenExpiryDays = 90
+	maxAPITokenExpiryDays     = 365
+)
+
+func (s *Server) handleListAPITokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.store.ListAPITokens(r.Context(), GetUserID(r))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	var input model.APITokenCreateInput
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if err := normalizeAPITokenInput(&input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+
+	plain, prefix, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	token, err := s.store.CreateAPIToken(r.Context(), model.APIToken{
+		UserID:      GetUserID(r),
+		Name:        input.Name,
+		Scope:       input.Scope,
+		TokenPrefix: prefix,
+		TokenHash:   hash,
+		ExpiresAt:   time.Now().AddDate(0, 0, input.ExpiresInDays),
+	})
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "api_token.create", "api_token", token.ID, token.Name, nil, token)
+	writeJSON(w, http.StatusCreated, model.APITokenCreated{APIToken: token, Token: plain})
+}
+
+func (s *Server) handleDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := parseInt64Param(r, "tokenID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if err := s.store.DeleteAPIToken(r.Context(), GetUserID(r), tokenID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "api_token.revoke", "api_token", tokenID, "", nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func normalizeAPITokenInput(input *model.APITokenCreateInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return errors.New("name is required")
+	}
+	if model.APITokenScopeRole(input.Scope) == "" {
+		return fmt.Errorf("scope must be one of %s, %s, %s", model.APITokenScopeRead, model.APITokenScopeTrigger, model.APITokenScopeFull)
+	}
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = defaultAPITokenExpiryDays
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxAPITokenExpiryDays {
+		return fmt.Errorf("expires_in_days must be between 1 and %d", maxAPITokenExpiryDays)
+	}
+	return nil
+}
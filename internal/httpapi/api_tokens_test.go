@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"devops-pipeline/internal/auth"
+	"devops-pipeline/internal/model"
+)
+
+func TestNormalizeAPITokenInput(t *testing.T) {
+	input := model.APITokenCreateInput{Name: "  ci  ", Scope: model.APITokenScopeTrigger}
+	if err := normalizeAPITokenInput(&input); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if input.Name != "ci" || input.ExpiresInDays != defaultAPITokenExpiryDays {
+		t.Fatalf("unexpected normalized input: %+v", input)
+	}
+
+	invalid := map[string]model.APITokenCreateInput{
+		"missing name":  {Scope: model.APITokenScopeRead},
+		"unknown scope": {Name: "ci", Scope: "write"},
+		"negative":      {Name: "ci", Scope: model.APITokenScopeRead, ExpiresInDays: -1},
+		"too long":      {Name: "ci", Scope: model.APITokenScopeRead, ExpiresInDays: maxAPITokenExpiryDays + 1},
+	}
+	for name, input := range invalid {
+		if err := normalizeAPITokenInput(&input); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAPITokenScopeCapsRole(t *testing.T) {
+	tests := []struct {
+		role, scope, want string
+	}{
+		{role: model.RoleAdmin, scope: model.APITokenScopeRead, want: model.RoleViewer},
+		{role: model.RoleAdmin, scope: model.APITokenScopeTrigger, want: model.RoleDeployer},
+		{role: model.RoleMaintainer, scope: model.APITokenScopeFull, want: model.RoleMaintainer},
+		{role: model.RoleViewer, scope: model.APITokenScopeTrigger, want: model.RoleViewer},
+	}
+	for _, tt := range tests {
+		if got := model.LowerRole(tt.role, model.APITokenScopeRole(tt.scope)); got != tt.want {
+			t.Fatalf("%s with %s token: got %q want %q", tt.role, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateAPIToken(t *testing.T) {
+	token, prefix, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if !auth.IsAPIToken(token) || !strings.HasPrefix(token, prefix) {
+		t.Fatalf("unexpected token %q with prefix %q", token, prefix)
+	}
+	if hash != auth.HashAPIToken(token) || strings.Contains(hash, token) {
+		t.Fatalf("unexpected hash %q", hash)
+	}
+	if auth.IsAPIToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatalf("expected a JWT not to be treated as an api token")
+	}
+}
+
+func TestRequireSessionRejectsAPITokens(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	requireSession(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected session request to pass, got %d", rec.Code)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), APITokenScopeKey, model.APITokenScopeFull))
+	rec = httptest.NewRecorder()
+	requireSession(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected api token request to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,267 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"devops-pipeline/internal/model"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const auditRedacted = "[redacted]"
+
+// audit records a change made by the current request. before and after are
+// the target's state around the change (nil for create or delete); only the
+// fields that differ are kept, with secrets redacted. A failed write is logged
+// rather than returned because the change itself has already been applied.
+func (s *Server) audit(r *http.Request, action, targetType string, targetID any, targetName string, before, after any) {
+	input := model.AuditEventCreateInput{
+		Actor:      GetUsername(r),
+		Action:     action,
+		TargetType: targetType,
+		TargetName: targetName,
+		Changes:    auditDiff(before, after),
+	}
+	if userID := GetUserID(r); userID > 0 {
+		input.ActorID = &userID
+	}
+	if targetID != nil {
+		input.TargetID = fmt.Sprint(targetID)
+	}
+	s.recordAudit(r, input)
+}
+
+// auditLogin records a login attempt. The request is not authenticated yet,
+// so the actor is the account that tried to sign in; userID is 0 when the
+// username did not resolve to an account.
+func (s *Server) auditLogin(r *http.Request, action, username string, userID int64, details map[string]string) {
+	input := model.AuditEventCreateInput{
+		Actor:      username,
+		Action:     action,
+		TargetType: "user",
+		TargetName: username,
+		Changes:    auditDiff(nil, details),
+	}
+	if userID > 0 {
+		input.ActorID = &userID
+		input.TargetID = fmt.Sprint(userID)
+	}
+	s.recordAudit(r, input)
+}
+
+func (s *Server) recordAudit(r *http.Request, input model.AuditEventCreateInput) {
+	input.RequestID = middleware.GetReqID(r.Context())
+	input.ClientIP = clientIP(r)
+	if err := s.store.CreateAuditEvent(r.Context(), input); err != nil {
+		s.logger.Error("record audit event failed", "action", input.Action, "target_id", input.TargetID, "error", err)
+	}
+}
+
+func (s *Server) handleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.ApplyAuditRetention(r.Context()); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := model.AuditEventFilter{
+		Actor:      strings.TrimSpace(query.Get("actor")),
+		Action:     strings.TrimSpace(query.Get("action")),
+		TargetType: strings.TrimSpace(query.Get("target_type")),
+		TargetID:   strings.TrimSpace(query.Get("target_id")),
+		Limit:      parseRunListLimit(r, 50),
+	}
+	var err error
+	if filter.CreatedFrom, err = parseRunDateParam(query.Get("from"), false); err != nil {
+		s.writeBadRequest(w, fmt.Errorf("from: %w", err))
+		return
+	}
+	if filter.CreatedTo, err = parseRunDateParam(query.Get("to"), true); err != nil {
+		s.writeBadRequest(w, fmt.Errorf("to: %w", err))
+		return
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			s.writeBadRequest(w, errors.New("invalid offset"))
+			return
+		}
+		filter.Offset = offset
+	}
+
+	events, total, err := s.store.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	writeJSON(w, http.StatusOK, events)
+}
+
+// auditDiff compares two snapshots field by field. Timestamps maintained by
+// the store are ignored since they change on every write.
+func auditDiff(before, after any) map[string]model.AuditChange {
+	old := auditSnapshot(before)
+	current := auditSnapshot(after)
+
+	changes := make(map[string]model.AuditChange)
+	for key, oldValue := range old {
+		newValue, exists := current[key]
+		if exists && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		change := model.AuditChange{Old: redactAuditValue(key, oldValue)}
+		if exists {
+			change.New = redactAuditValue(key, newValue)
+		}
+		changes[key] = change
+	}
+	for key, newValue := range current {
+		if _, exists := old[key]; !exists {
+			changes[key] = model.AuditChange{New: redactAuditValue(key, newValue)}
+		}
+	}
+	for key := range changes {
+		if field := auditFieldName(key); field == "created_at" || field == "updated_at" {
+			delete(changes, key)
+		}
+	}
+	return changes
+}
+
+// auditSnapshot flattens v into a map keyed by JSON field name; nested structs
+// such as a project's deploy config use dotted keys. Fields hidden from JSON
+// such as stored secrets are included under their snake_case Go name so that
+// changing them is still recorded, redacted.
+func auditSnapshot(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	raw := make(map[string]any)
+	collectAuditFields(reflect.ValueOf(v), "", raw)
+
+	// 经 JSON 往返统一成可比较的基础类型（时间、指针、切片等）
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	snapshot := make(map[string]any)
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func collectAuditFields(value reflect.Value, prefix string, fields map[string]any) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			fields[prefix+fmt.Sprint(key.Interface())] = value.MapIndex(key).Interface()
+		}
+	case reflect.Struct:
+		valueType := value.Type()
+		for i := 0; i < valueType.NumField(); i++ {
+			field := valueType.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Anonymous {
+				collectAuditFields(value.Field(i), prefix, fields)
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || name == "" {
+				name = snakeCase(field.Name)
+			}
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct && fieldType != timeType {
+				collectAuditFields(value.Field(i), prefix+name+".", fields)
+				continue
+			}
+			fields[prefix+name] = value.Field(i).Interface()
+		}
+	}
+}
+
+// auditFieldName returns the last segment of a dotted snapshot key.
+func auditFieldName(key string) string {
+	if index := strings.LastIndexByte(key, '.'); index >= 0 {
+		return key[index+1:]
+	}
+	return key
+}
+
+func snakeCase(name string) string {
+	var builder strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// 连续大写的缩写（如 SSH、URL）视为一个单词
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				builder.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// isSensitiveAuditField reports whether a field holds a credential. Flags such
+// as has_password and the displayable token_prefix are kept as they are.
+func isSensitiveAuditField(key string) bool {
+	key = strings.ToLower(auditFieldName(key))
+	if strings.HasPrefix(key, "has_") || key == "token_prefix" {
+		return false
+	}
+	// 通知渠道的 config 中包含机器人密钥
+	if key == "config" {
+		return true
+	}
+	for _, marker := range []string{"password", "token", "secret", "ssh_key", "private_key", "cipher"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAuditValue hides credentials. Empty values stay visible so that
+// setting or clearing a secret can be told apart; URLs lose their password.
+func redactAuditValue(key string, value any) any {
+	text, isString := value.(string)
+	if isSensitiveAuditField(key) {
+		if value == nil || (isString && text == "") {
+			return value
+		}
+		return auditRedacted
+	}
+	if isString && strings.Contains(text, "@") {
+		if parsed, err := url.Parse(text); err == nil && parsed.User != nil {
+			if _, hasPassword := parsed.User.Password(); hasPassword {
+				return parsed.Redacted()
+			}
+		}
+	}
+	return value
+}
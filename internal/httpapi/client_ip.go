@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses the configured proxy addresses, each a single IP
+// or a CIDR range.
+func parseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", value)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustedProxyKey marks requests whose socket peer is a trusted proxy, so the
+// other forwarding headers such as X-Forwarded-Proto can be honoured as well.
+const trustedProxyKey contextKey = "trusted_proxy"
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP replaces RemoteAddr with the client address reported by a trusted
+// reverse proxy. Requests from any other peer keep their socket address, so
+// clients cannot choose the address that login throttling, the audit trail
+// and the session list see by sending forwarding headers themselves.
+func realIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peerIsTrustedProxy(r, trusted) {
+				r = r.WithContext(context.WithValue(r.Context(), trustedProxyKey, true))
+				if ip := forwardedClientIP(r, trusted); ip != "" {
+					r.RemoteAddr = ip
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func peerIsTrustedProxy(r *http.Request, trusted []netip.Prefix) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+	peer, err := netip.ParseAddr(clientIP(r))
+	return err == nil && isTrustedProxy(peer, trusted)
+}
+
+// forwardedClientIP returns the client address from the forwarding headers of
+// a request sent by a trusted proxy, or "" to keep the peer address.
+func forwardedClientIP(r *http.Request, trusted []netip.Prefix) string {
+	// 代理会把上一跳追加到末尾，从右往左跳过可信代理，第一个不可信的地址才是客户端；
+	// 更靠左的内容由客户端自己填写，不能采用
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !isTrustedProxy(addr, trusted) {
+			break
+		}
+	}
+	if client != "" {
+		return client
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return ""
+}
+
+// viaTrustedProxy reports whether realIP found the request to come from a
+// trusted proxy.
+func viaTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(trustedProxyKey).(bool)
+	return trusted
+}
+
+// clientIP returns the address of the request without its port: the socket
+// peer, or the client reported by a trusted proxy once realIP has run.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
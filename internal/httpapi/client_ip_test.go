@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPStripsPort(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.8:51234"
+	if got := clientIP(request); got != "10.0.0.8" {
+		t.Fatalf("unexpected client ip: %q", got)
+	}
+	request.RemoteAddr = "10.0.0.9"
+	if got := clientIP(request); got != "10.0.0.9" {
+		t.Fatalf("unexpected client ip without port: %q", got)
+	}
+}
+
+func TestRealIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{name: "spoofed by a direct client", remoteAddr: "203.0.113.7:5000", forwarded: []string{"1.2.3.4"}, realIP: "1.2.3.4", want: "203.0.113.7"},
+		{name: "forwarded by a trusted proxy", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.9"}, want: "198.51.100.9"},
+		{name: "client prepends a fake hop", remoteAddr: "10.0.0.2:5000", forwarded: []string{"1.2.3.4, 198.51.100.9"}, want: "198.51.100.9"},
+		{name: "chain of trusted proxies", remoteAddr: "192.168.1.5:5000", forwarded: []string{"198.51.100.9", "10.1.1.1"}, want: "198.51.100.9"},
+		{name: "real ip header", remoteAddr: "10.0.0.2:5000", realIP: "198.51.100.9", want: "198.51.100.9"},
+		{name: "garbage header", remoteAddr: "10.0.0.2:5000", forwarded: []string{"not-an-ip"}, want: "10.0.0.2"},
+	}
+	handler := realIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Client-IP", clientIP(r))
+	}))
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("X-Client-IP"); got != tt.want {
+			t.Fatalf("%s: got %q want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Fatal("expected a host name to be rejected")
+	}
+}
+
+func TestRequestIsHTTPSTrustsForwardedProtoOnlyFromProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+	handler := realIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestIsHTTPS(r) {
+			w.Header().Set("X-Scheme", "https")
+		}
+	}))
+	for remoteAddr, want := range map[string]string{
+		"10.0.0.2:5000":    "https",
+		"203.0.113.7:5000": "",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("X-Scheme"); got != want {
+			t.Fatalf("%s: got scheme %q want %q", remoteAddr, got, want)
+		}
+	}
+}
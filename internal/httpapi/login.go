@@ -0,0 +1,246 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/auth"
+	"devops-pipeline/internal/config"
+	"devops-pipeline/internal/model"
+	"devops-pipeline/internal/store"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 账号不存在、已停用或密码错误都返回同样的提示
+var errInvalidLogin = errors.New("invalid username or password")
+
+const (
+	// 每个请求都会检查会话是否仍然存在，吊销立即生效；访问令牌的有效期只限制它泄露后的可用时长
+	accessTokenTTL = 15 * time.Minute
+	// sessionIdleTTL 是会话在没有刷新的情况下保持有效的时长，每次刷新都会顺延
+	sessionIdleTTL = 7 * 24 * time.Hour
+)
+
+// passwordChangePaths 是必须修改密码的账号仍可访问的接口
+var passwordChangePaths = []string{"/api/v1/admin/profile", "/api/v1/admin/password"}
+
+// errLDAPNotUsed means LDAP did not sign the user in and the local account
+// should be checked instead.
+var errLDAPNotUsed = errors.New("ldap login not used")
+
+func (s *Server) authenticateLocal(ctx context.Context, username, password string) (model.User, error) {
+	user, err := s.store.GetUserByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return model.User{}, errInvalidLogin
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+	// 外部账号只能通过所属的身份源登录
+	if user.Disabled || user.AuthSource != model.AuthSourceLocal {
+		return model.User{}, errInvalidLogin
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return model.User{}, errInvalidLogin
+	}
+	// 仍在使用默认密码的账号必须先改密码，已有安装升级后也会在登录时被标记
+	if password == config.DefaultAdminPassword && !user.PasswordChangeRequired {
+		if err := s.store.RequirePasswordChange(ctx, user.ID); err != nil {
+			return model.User{}, err
+		}
+		user.PasswordChangeRequired = true
+	}
+	return user, nil
+}
+
+// loginResponse finishes the first login step: accounts with a second
+// factor get a challenge, all others a session. method names the first step
+// in the audit trail.
+func (s *Server) loginResponse(r *http.Request, user model.User, method string) (model.LoginResponse, error) {
+	if user.TOTPEnabled {
+		challenge, err := s.jwtManager.SignLoginChallenge(user.ID, method, loginChallengeTTL)
+		if err != nil {
+			return model.LoginResponse{}, err
+		}
+		return model.LoginResponse{Username: user.Username, TwoFactorRequired: true, Challenge: challenge}, nil
+	}
+	return s.sessionResponse(r, user, map[string]string{"method": method})
+}
+
+// sessionResponse starts a login session for a completed login, clears the
+// account's failed attempts and records the login.
+func (s *Server) sessionResponse(r *http.Request, user model.User, details map[string]string) (model.LoginResponse, error) {
+	refreshToken, refreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	session, err := s.store.CreateUserSession(r.Context(), model.UserSession{
+		UserID:           user.ID,
+		UserAgent:        truncateUserAgent(r.UserAgent()),
+		ClientIP:         clientIP(r),
+		RefreshTokenHash: refreshHash,
+		ExpiresAt:        time.Now().Add(sessionIdleTTL),
+	})
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	token, err := s.jwtManager.GenerateToken(user.ID, user.Username, session.ID, accessTokenTTL)
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	s.loginThrottle.succeed(user.Username)
+	s.auditLogin(r, "auth.login", user.Username, user.ID, details)
+	return model.LoginResponse{
+		Token:                  token,
+		RefreshToken:           refreshToken,
+		ExpiresIn:              int(accessTokenTTL.Seconds()),
+		Username:               user.Username,
+		Role:                   user.Role,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+	}, nil
+}
+
+// loginFailed records a failed attempt in the audit trail. The attempt was
+// already counted by the throttle when it began.
+func (s *Server) loginFailed(r *http.Request, attempt *loginAttempt, username string, userID int64, reason string) {
+	s.auditLogin(r, "auth.login_failed", username, userID, map[string]string{"reason": reason})
+	if attempt.locked {
+		s.logger.Warn("account temporarily locked after failed logins", "username", username, "client_ip", clientIP(r))
+		s.auditLogin(r, "auth.lockout", username, userID, map[string]string{"duration": accountLoginPolicy.lockout.String()})
+	}
+}
+
+// requirePasswordChange blocks login sessions of accounts that still have to
+// replace the default password, except for the endpoints needed to do so.
+func requirePasswordChange(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiTokenScope(r) == "" && CurrentUser(r).PasswordChangeRequired && !pathAllowed(r.URL.Path, passwordChangePaths) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "the default password must be changed before continuing"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pathAllowed reports whether path is one of allowed; entries ending in "/"
+// match every path below them.
+func pathAllowed(path string, allowed []string) bool {
+	for _, candidate := range allowed {
+		if path == candidate || (strings.HasSuffix(candidate, "/") && strings.HasPrefix(path, candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateLDAP signs a user in through the directory. Unknown users,
+// wrong passwords, users without a mapped role and an unreachable directory
+// all return errLDAPNotUsed so that local accounts keep working.
+func (s *Server) authenticateLDAP(ctx context.Context, username, password string) (model.User, error) {
+	if s.ldap == nil {
+		return model.User{}, errLDAPNotUsed
+	}
+	identity, err := s.ldap.Authenticate(username, password)
+	if errors.Is(err, auth.ErrLDAPInvalidCredentials) {
+		return model.User{}, errLDAPNotUsed
+	}
+	if err != nil {
+		s.logger.Warn("ldap login unavailable, falling back to local accounts", "username", username, "error", err)
+		return model.User{}, errLDAPNotUsed
+	}
+	role := s.ldap.MapRole(identity.Groups)
+	if role == "" {
+		s.logger.Warn("ldap login rejected, no role mapped", "username", identity.Username, "groups", identity.Groups)
+		return model.User{}, errLDAPNotUsed
+	}
+
+	// 目录账号按登录名关联：用户换了 OU 后 DN 会变，登录名在目录中唯一且不变
+	user, err := s.provisionExternalUser(ctx, model.AuthSourceLDAP, identity.Username, identity.Username, role, s.ldap.SyncRoles())
+	if errors.Is(err, errExternalUserDisabled) {
+		return model.User{}, errInvalidLogin
+	}
+	// 同名的本地账号或单点登录账号不会被目录用户接管，只能用它自己的密码登录
+	if errors.Is(err, errExternalUserConflict) {
+		s.logger.Warn("ldap login matches an account of another source, checking the local password instead", "username", identity.Username)
+		return model.User{}, errLDAPNotUsed
+	}
+	return user, err
+}
+
+var (
+	errExternalUserDisabled = errors.New("account is disabled")
+	errExternalUserConflict = errors.New("an account with this username already exists, ask an administrator to link it")
+)
+
+// provisionExternalUser returns the local account linked to externalID of an
+// external source, creating it on first login. An existing account with the
+// same username is only reused when an administrator handed it to source and
+// no other identity has claimed it yet; local password accounts are never
+// taken over. With syncRole the provider's role replaces the stored one.
+func (s *Server) provisionExternalUser(ctx context.Context, source, externalID, username, role string, syncRole bool) (model.User, error) {
+	if externalID == "" {
+		return model.User{}, fmt.Errorf("%s login returned no user id", source)
+	}
+	user, err := s.store.GetUserByExternalID(ctx, source, externalID)
+	if errors.Is(err, store.ErrNotFound) {
+		user, err = s.claimExternalUser(ctx, source, externalID, username, role)
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+	if user.Disabled {
+		return model.User{}, errExternalUserDisabled
+	}
+	if syncRole && user.Role != role {
+		return s.store.UpdateUser(ctx, user.ID, role, false, "")
+	}
+	return user, nil
+}
+
+func (s *Server) claimExternalUser(ctx context.Context, source, externalID, username, role string) (model.User, error) {
+	user, err := s.store.GetUserByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		// 外部账号没有本地密码，写入一个无人知晓的随机哈希
+		passwordHash, err := unusablePasswordHash()
+		if err != nil {
+			return model.User{}, err
+		}
+		return s.store.CreateExternalUser(ctx, username, passwordHash, role, source, externalID)
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+	if !externalUserClaimable(user, source) {
+		return model.User{}, errExternalUserConflict
+	}
+	if err := s.store.LinkUser(ctx, user.ID, source, externalID); err != nil {
+		return model.User{}, err
+	}
+	user.ExternalID = externalID
+	return user, nil
+}
+
+// externalUserClaimable reports whether a login from source may link to an
+// existing account of the same name.
+func externalUserClaimable(user model.User, source string) bool {
+	return user.AuthSource == source && user.ExternalID == ""
+}
+
+func unusablePasswordHash() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(buf)), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
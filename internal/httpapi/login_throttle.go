@@ -0,0 +1,204 @@
+package httpapi
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginThrottlePolicy 描述一类键（账号或来源 IP）允许的失败次数：前 freeAttempts 次
+// 失败不限制，之后每次失败的等待时间翻倍，达到 lockoutAttempts 次后锁定 lockout。
+type loginThrottlePolicy struct {
+	freeAttempts    int
+	lockoutAttempts int
+	baseDelay       time.Duration
+	lockout         time.Duration
+	// 上次失败（或锁定结束）后 resetAfter 内没有新的失败则清零计数
+	resetAfter time.Duration
+}
+
+var (
+	accountLoginPolicy = loginThrottlePolicy{
+		freeAttempts:    5,
+		lockoutAttempts: 10,
+		baseDelay:       time.Second,
+		lockout:         15 * time.Minute,
+		resetAfter:      15 * time.Minute,
+	}
+	// 同一出口 IP 后面可能有很多用户，限制放宽
+	ipLoginPolicy = loginThrottlePolicy{
+		freeAttempts:    20,
+		lockoutAttempts: 50,
+		baseDelay:       time.Second,
+		lockout:         15 * time.Minute,
+		resetAfter:      15 * time.Minute,
+	}
+)
+
+const loginThrottleSweepInterval = time.Minute
+
+type loginThrottleEntry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	policy       loginThrottlePolicy
+}
+
+// expired reports whether the entry saw no failure for resetAfter after its
+// last block ended, so that counting can start over.
+func (e *loginThrottleEntry) expired(now time.Time) bool {
+	quietSince := e.lastFailure
+	if e.blockedUntil.After(quietSince) {
+		quietSince = e.blockedUntil
+	}
+	return now.Sub(quietSince) > e.policy.resetAfter
+}
+
+// loginThrottle counts failed logins per account and per client IP in
+// memory. Counters are lost on restart, which only shortens a lockout.
+type loginThrottle struct {
+	mu        sync.Mutex
+	entries   map[string]*loginThrottleEntry
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{entries: make(map[string]*loginThrottleEntry), now: time.Now}
+}
+
+func accountThrottleKey(username string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// loginAttempt is a login in progress. It is counted as a failure when it
+// starts, so that parallel requests see it before the password has been
+// checked; release takes the failure back once the attempt succeeded.
+type loginAttempt struct {
+	reservations []loginReservation
+	// locked reports whether counting this attempt locked the account
+	locked bool
+}
+
+type loginReservation struct {
+	key               string
+	entry             *loginThrottleEntry
+	blockedUntil      time.Time
+	priorBlockedUntil time.Time
+}
+
+// begin starts an attempt for username from the request's IP. While either
+// is blocked it records nothing and returns how long the caller has to wait.
+func (t *loginThrottle) begin(r *http.Request, username string) (*loginAttempt, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	keys := []string{accountThrottleKey(username), ipThrottleKey(r)}
+	if wait := t.blocked(now, keys...); wait > 0 {
+		return nil, wait
+	}
+
+	t.sweep(now)
+	account, locked := t.record(keys[0], accountLoginPolicy, now)
+	ip, _ := t.record(keys[1], ipLoginPolicy, now)
+	return &loginAttempt{reservations: []loginReservation{account, ip}, locked: locked}, 0
+}
+
+// blocked returns the longest remaining block of keys, or 0.
+func (t *loginThrottle) blocked(now time.Time, keys ...string) time.Duration {
+	var longest time.Duration
+	for _, key := range keys {
+		if entry, ok := t.entries[key]; ok {
+			if remaining := entry.blockedUntil.Sub(now); remaining > longest {
+				longest = remaining
+			}
+		}
+	}
+	return longest
+}
+
+// release takes back the failure counted for an attempt that did not fail,
+// along with the delay it caused unless a later failure replaced it.
+func (t *loginThrottle) release(attempt *loginAttempt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, reservation := range attempt.reservations {
+		// 计数已经过期重建或被清理时，这次预留的失败也随之消失了
+		entry, ok := t.entries[reservation.key]
+		if !ok || entry != reservation.entry {
+			continue
+		}
+		if entry.failures > 0 {
+			entry.failures--
+		}
+		if entry.blockedUntil.Equal(reservation.blockedUntil) {
+			entry.blockedUntil = reservation.priorBlockedUntil
+		}
+	}
+}
+
+// succeed clears the account's counter. The IP counter is kept, so one valid
+// account does not reset guessing against others from the same address.
+func (t *loginThrottle) succeed(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, accountThrottleKey(username))
+}
+
+func (t *loginThrottle) record(key string, policy loginThrottlePolicy, now time.Time) (reservation loginReservation, locked bool) {
+	entry, ok := t.entries[key]
+	if !ok || entry.expired(now) {
+		entry = &loginThrottleEntry{policy: policy}
+		t.entries[key] = entry
+	}
+	reservation = loginReservation{key: key, entry: entry, priorBlockedUntil: entry.blockedUntil}
+
+	entry.failures++
+	entry.lastFailure = now
+	switch {
+	case entry.failures <= policy.freeAttempts:
+	case entry.failures >= policy.lockoutAttempts:
+		// 锁定期间的尝试不会被记录，所以这里的每次失败都会开始一次新的锁定
+		entry.blockedUntil = now.Add(policy.lockout)
+		locked = true
+	default:
+		exponent := float64(entry.failures - policy.freeAttempts - 1)
+		delay := time.Duration(float64(policy.baseDelay) * math.Pow(2, exponent))
+		if delay > policy.lockout {
+			delay = policy.lockout
+		}
+		entry.blockedUntil = now.Add(delay)
+	}
+	reservation.blockedUntil = entry.blockedUntil
+	return reservation, locked
+}
+
+// sweep drops idle entries so that guessed usernames do not pile up.
+func (t *loginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < loginThrottleSweepInterval {
+		return
+	}
+	t.lastSweep = now
+	for key, entry := range t.entries {
+		if entry.expired(now) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func writeTooManyLoginAttempts(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	writeJSON(w, http.StatusTooManyRequests, map[string]string{
+		"error": fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds),
+	})
+}
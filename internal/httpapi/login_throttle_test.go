@@ -0,0 +1,163 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestLoginThrottle() (*loginThrottle, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	throttle := newLoginThrottle()
+	throttle.now = func() time.Time { return now }
+	return throttle, &now
+}
+
+// failAttempt starts an attempt that is then left counted as a failure.
+func failAttempt(t *testing.T, throttle *loginThrottle, r *http.Request, username string) (locked bool) {
+	t.Helper()
+	attempt, wait := throttle.begin(r, username)
+	if wait > 0 {
+		t.Fatalf("unexpected delay of %s for %s", wait, username)
+	}
+	return attempt.locked
+}
+
+func waitFor(throttle *loginThrottle, r *http.Request, username string) time.Duration {
+	return throttle.blocked(throttle.now(), accountThrottleKey(username), ipThrottleKey(r))
+}
+
+func TestLoginThrottleBacksOffExponentiallyThenLocks(t *testing.T) {
+	throttle, now := newTestLoginThrottle()
+	req := httptest.NewRequest("POST", "/api/v1/admin/login", nil)
+
+	for i := 0; i < accountLoginPolicy.freeAttempts; i++ {
+		if failAttempt(t, throttle, req, "admin") {
+			t.Fatalf("attempt %d: unexpected lockout", i+1)
+		}
+		if wait := waitFor(throttle, req, "admin"); wait != 0 {
+			t.Fatalf("attempt %d: expected no delay, got %s", i+1, wait)
+		}
+	}
+
+	want := time.Second
+	for i := accountLoginPolicy.freeAttempts + 1; i < accountLoginPolicy.lockoutAttempts; i++ {
+		if failAttempt(t, throttle, req, "Admin") {
+			t.Fatalf("attempt %d: unexpected lockout", i)
+		}
+		if wait := waitFor(throttle, req, "admin"); wait != want {
+			t.Fatalf("attempt %d: expected delay %s, got %s", i, want, wait)
+		}
+		if _, wait := throttle.begin(req, "admin"); wait != want {
+			t.Fatalf("attempt %d: expected begin to refuse for %s, got %s", i, want, wait)
+		}
+		*now = now.Add(want)
+		want *= 2
+	}
+
+	if !failAttempt(t, throttle, req, "admin") {
+		t.Fatal("expected the account to be locked")
+	}
+	if wait := waitFor(throttle, req, "admin"); wait != accountLoginPolicy.lockout {
+		t.Fatalf("expected lockout of %s, got %s", accountLoginPolicy.lockout, wait)
+	}
+	if wait := waitFor(throttle, httptest.NewRequest("POST", "/", nil), "someone-else"); wait != 0 {
+		t.Fatalf("expected other accounts to stay usable below the ip limit, got %s", wait)
+	}
+}
+
+func TestLoginThrottleCountsParallelAttempts(t *testing.T) {
+	throttle, _ := newTestLoginThrottle()
+	req := httptest.NewRequest("POST", "/api/v1/admin/login", nil)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		started int
+	)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, wait := throttle.begin(req, "admin"); wait == 0 {
+				mu.Lock()
+				started++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// 时间没有前进，第一次超出免费次数的尝试之后全部被拒绝
+	if want := accountLoginPolicy.freeAttempts + 1; started != want {
+		t.Fatalf("expected %d attempts to be evaluated, got %d", want, started)
+	}
+}
+
+func TestLoginThrottleReleaseTakesBackAttempt(t *testing.T) {
+	throttle, _ := newTestLoginThrottle()
+	req := httptest.NewRequest("POST", "/api/v1/admin/login", nil)
+	for i := 0; i < accountLoginPolicy.freeAttempts; i++ {
+		failAttempt(t, throttle, req, "admin")
+	}
+	attempt, _ := throttle.begin(req, "admin")
+	if waitFor(throttle, req, "admin") == 0 {
+		t.Fatal("expected the pending attempt to count while it runs")
+	}
+	throttle.release(attempt)
+	if wait := waitFor(throttle, req, "admin"); wait != 0 {
+		t.Fatalf("expected the released attempt to lift its delay, got %s", wait)
+	}
+	if got := throttle.entries[accountThrottleKey("admin")].failures; got != accountLoginPolicy.freeAttempts {
+		t.Fatalf("expected %d failures after release, got %d", accountLoginPolicy.freeAttempts, got)
+	}
+}
+
+func TestLoginThrottleSuccessResetsAccountOnly(t *testing.T) {
+	throttle, _ := newTestLoginThrottle()
+	req := httptest.NewRequest("POST", "/api/v1/admin/login", nil)
+	for i := 0; i < ipLoginPolicy.freeAttempts+1; i++ {
+		failAttempt(t, throttle, req, fmt.Sprintf("user%d", i))
+	}
+	throttle.succeed("user0")
+	if _, ok := throttle.entries[accountThrottleKey("user0")]; ok {
+		t.Fatal("expected the account counter to be cleared")
+	}
+	if wait := waitFor(throttle, req, "other"); wait == 0 {
+		t.Fatal("expected the ip to stay throttled")
+	}
+}
+
+func TestLoginThrottleForgetsIdleFailures(t *testing.T) {
+	throttle, now := newTestLoginThrottle()
+	req := httptest.NewRequest("POST", "/api/v1/admin/login", nil)
+	for i := 0; i < accountLoginPolicy.freeAttempts; i++ {
+		failAttempt(t, throttle, req, "admin")
+	}
+	*now = now.Add(accountLoginPolicy.resetAfter + time.Second)
+	failAttempt(t, throttle, req, "admin")
+	if wait := waitFor(throttle, req, "admin"); wait != 0 {
+		t.Fatalf("expected counting to start over, got %s", wait)
+	}
+	if got := throttle.entries[accountThrottleKey("admin")].failures; got != 1 {
+		t.Fatalf("expected 1 failure after reset, got %d", got)
+	}
+}
+
+func TestPathAllowed(t *testing.T) {
+	allowed := []string{"/api/v1/admin/profile", "/api/v1/admin/2fa/"}
+	for path, want := range map[string]bool{
+		"/api/v1/admin/profile":      true,
+		"/api/v1/admin/profile/x":    false,
+		"/api/v1/admin/2fa/setup":    true,
+		"/api/v1/admin/2fa":          false,
+		"/api/v1/admin/profile-evil": false,
+		"/api/v1/hosts":              false,
+	} {
+		if got := pathAllowed(path, allowed); got != want {
+			t.Fatalf("%s: got %v want %v", path, got, want)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package httpapi
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"devops-pipeline/internal/auth"
+	"devops-pipeline/internal/model"
+	"devops-pipeline/internal/store"
 )
 
 type contextKey string
@@ -13,9 +17,90 @@ type contextKey string
 const (
 	UserIDKey   contextKey = "user_id"
 	UsernameKey contextKey = "username"
+	UserKey     contextKey = "user"
+	// APITokenScopeKey 仅在使用 API 令牌认证时存在
+	APITokenScopeKey contextKey = "api_token_scope"
+	// SessionIDKey 仅在使用登录会话的访问令牌认证时存在
+	SessionIDKey contextKey = "session_id"
 )
 
-func AuthMiddleware(jwtManager *auth.JWTManager) func(http.Handler) http.Handler {
+var (
+	errAccountUnavailable = errors.New("account does not exist or is disabled")
+	errAPITokenExpired    = errors.New("api token has expired")
+	errSessionRevoked     = errors.New("session has ended")
+)
+
+// apiTokenTouchInterval 限制 last_used_at 的写入频率，避免每个请求都写库
+const apiTokenTouchInterval = time.Minute
+
+// authIdentity is what a bearer credential resolved to. Exactly one of
+// Scope (API token) and SessionID (login session) is set.
+type authIdentity struct {
+	User      model.User
+	Scope     string
+	SessionID int64
+}
+
+// authenticateToken validates a bearer credential, either an access token
+// issued by login or a personal API token, and loads the account it belongs
+// to. Roles, the disabled flag and the login session are read from the store
+// on every request, so changes and revocations take effect without waiting
+// for the credential to expire. For API tokens the scope is set and the
+// user's role is capped by it.
+func authenticateToken(r *http.Request, jwtManager *auth.JWTManager, appStore *store.Store, tokenString string) (authIdentity, error) {
+	var (
+		userID   int64
+		identity authIdentity
+	)
+	if auth.IsAPIToken(tokenString) {
+		token, err := appStore.GetAPITokenByHash(r.Context(), auth.HashAPIToken(tokenString))
+		if err != nil {
+			return authIdentity{}, err
+		}
+		now := time.Now()
+		if !now.Before(token.ExpiresAt) {
+			return authIdentity{}, errAPITokenExpired
+		}
+		if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+			if err := appStore.TouchAPIToken(r.Context(), token.ID, now); err != nil {
+				return authIdentity{}, err
+			}
+		}
+		userID, identity.Scope = token.UserID, token.Scope
+	} else {
+		claims, err := jwtManager.ValidateToken(tokenString)
+		if err != nil {
+			return authIdentity{}, err
+		}
+		// 升级前签发的令牌没有 sid，一律视为已失效
+		if claims.SessionID == 0 {
+			return authIdentity{}, errSessionRevoked
+		}
+		session, err := appStore.GetUserSession(r.Context(), claims.SessionID)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && (session.UserID != claims.UserID || !time.Now().Before(session.ExpiresAt))) {
+			return authIdentity{}, errSessionRevoked
+		}
+		if err != nil {
+			return authIdentity{}, err
+		}
+		userID, identity.SessionID = claims.UserID, session.ID
+	}
+
+	user, err := appStore.GetUser(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && user.Disabled) {
+		return authIdentity{}, errAccountUnavailable
+	}
+	if err != nil {
+		return authIdentity{}, err
+	}
+	if identity.Scope != "" {
+		user.Role = model.LowerRole(user.Role, model.APITokenScopeRole(identity.Scope))
+	}
+	identity.User = user
+	return identity, nil
+}
+
+func AuthMiddleware(jwtManager *auth.JWTManager, appStore *store.Store) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 从Authorization header获取token
@@ -34,16 +119,24 @@ func AuthMiddleware(jwtManager *auth.JWTManager) func(http.Handler) http.Handler
 
 			tokenString := parts[1]
 
-			// 验证token
-			claims, err := jwtManager.ValidateToken(tokenString)
+			// 验证token并加载账号
+			identity, err := authenticateToken(r, jwtManager, appStore, tokenString)
 			if err != nil {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
 			// 将用户信息存入context
-			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, UsernameKey, claims.Username)
+			user := identity.User
+			ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
+			ctx = context.WithValue(ctx, UsernameKey, user.Username)
+			ctx = context.WithValue(ctx, UserKey, user)
+			if identity.Scope != "" {
+				ctx = context.WithValue(ctx, APITokenScopeKey, identity.Scope)
+			}
+			if identity.SessionID != 0 {
+				ctx = context.WithValue(ctx, SessionIDKey, identity.SessionID)
+			}
 
 			// 继续处理请求
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -63,4 +156,108 @@ func GetUsername(r *http.Request) string {
 		return username
 	}
 	return ""
-}
\ No newline at end of file
+}
+
+// CurrentUser returns the account attached by AuthMiddleware.
+func CurrentUser(r *http.Request) model.User {
+	if user, ok := r.Context().Value(UserKey).(model.User); ok {
+		return user
+	}
+	return model.User{}
+}
+
+// apiTokenScope returns the scope of the API token used for the request, or
+// "" when the request was authenticated by a login session.
+func apiTokenScope(r *http.Request) string {
+	scope, _ := r.Context().Value(APITokenScopeKey).(string)
+	return scope
+}
+
+// currentSessionID returns the login session of the request, or 0 for API
+// tokens.
+func currentSessionID(r *http.Request) int64 {
+	sessionID, _ := r.Context().Value(SessionIDKey).(int64)
+	return sessionID
+}
+
+// requireSession rejects requests authenticated by an API token, so that a
+// leaked token cannot change the account or create further tokens.
+func requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiTokenScope(r) != "" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "this action is not available to api tokens"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole rejects requests whose account has a global role below role.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !model.RoleAtLeast(CurrentUser(r).Role, role) {
+				writeForbidden(w, role)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireProjectRole checks the role on the project named by the projectID
+// URL parameter, which includes per-project grants.
+func (s *Server) requireProjectRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			projectID, err := parseInt64Param(r, "projectID")
+			if err != nil {
+				s.writeBadRequest(w, err)
+				return
+			}
+			s.checkProjectRole(w, r, next, projectID, role)
+		})
+	}
+}
+
+// requireRunRole checks the role on the project a run belongs to.
+func (s *Server) requireRunRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			runID, err := parseInt64Param(r, "runID")
+			if err != nil {
+				s.writeBadRequest(w, err)
+				return
+			}
+			run, err := s.store.GetRunSummary(r.Context(), runID)
+			if err != nil {
+				s.writeError(w, err)
+				return
+			}
+			s.checkProjectRole(w, r, next, run.ProjectID, role)
+		})
+	}
+}
+
+func (s *Server) checkProjectRole(w http.ResponseWriter, r *http.Request, next http.Handler, projectID int64, role string) {
+	user := CurrentUser(r)
+	if !model.RoleAtLeast(user.Role, role) {
+		granted, err := s.store.ProjectRole(r.Context(), user, projectID)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if scope := apiTokenScope(r); scope != "" {
+			granted = model.LowerRole(granted, model.APITokenScopeRole(scope))
+		}
+		if !model.RoleAtLeast(granted, role) {
+			writeForbidden(w, role)
+			return
+		}
+	}
+	next.ServeHTTP(w, r)
+}
+
+func writeForbidden(w http.ResponseWriter, role string) {
+	writeJSON(w, http.StatusForbidden, map[string]string{"error": "this action requires the " + role + " role"})
+}
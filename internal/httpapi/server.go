@@ -2,7 +2,7 @@ package httpapi
 
 import (
 	"bytes"
-	"context"
+	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -18,13 +19,13 @@ import (
 	"devops-pipeline/internal/auth"
 	"devops-pipeline/internal/config"
 	"devops-pipeline/internal/crypto"
+	"devops-pipeline/internal/gitprovider"
 	"devops-pipeline/internal/model"
 	"devops-pipeline/internal/pipeline"
 	"devops-pipeline/internal/store"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Server struct {
@@ -33,21 +34,46 @@ type Server struct {
 	logger     *slog.Logger
 	config     config.Config
 	jwtManager *auth.JWTManager
+	// oidc 和 ldap 为空表示未配置对应的登录方式
+	oidc *auth.OIDCProvider
+	ldap *auth.LDAPProvider
+	// loginThrottle 记录登录失败次数，用于退避和临时锁定
+	loginThrottle *loginThrottle
+	// streamTickets 是日志流使用的一次性票据
+	streamTickets *streamTickets
 }
 
 func New(store *store.Store, executor *pipeline.Executor, logger *slog.Logger, cfg config.Config) http.Handler {
-	jwtManager := auth.NewJWTManager(cfg.Secret)
+	jwtManager := auth.NewJWTManager(cfg.SigningSecret())
 	server := &Server{
 		store:      store,
 		executor:   executor,
 		logger:     logger,
 		config:     cfg,
 		jwtManager: jwtManager,
+
+		loginThrottle: newLoginThrottle(),
+		streamTickets: newStreamTickets(),
+	}
+	oidc, err := auth.NewOIDCProvider(cfg.OIDC, nil)
+	if err != nil {
+		logger.Error("oidc single sign-on disabled", "error", err)
+	}
+	server.oidc = oidc
+	ldapProvider, err := auth.NewLDAPProvider(cfg.LDAP)
+	if err != nil {
+		logger.Error("ldap login disabled", "error", err)
+	}
+	server.ldap = ldapProvider
+	// 配置有误时不信任任何代理，来源 IP 退回到连接地址
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Error("forwarded client addresses ignored", "error", err)
 	}
 
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	router.Use(realIP(trustedProxies))
 	router.Use(middleware.Recoverer)
 	router.Use(corsMiddleware)
 
@@ -56,82 +82,146 @@ func New(store *store.Store, executor *pipeline.Executor, logger *slog.Logger, c
 	router.Route("/api/v1", func(r chi.Router) {
 		// 公开接口 - 不需要认证
 		r.Post("/admin/login", server.handleAdminLogin)
+		r.Post("/admin/login/2fa", server.handleTwoFactorLogin)
+		r.Post("/auth/refresh", server.handleRefreshSession)
+		r.Post("/auth/logout", server.handleLogout)
+		r.Get("/auth/oidc", server.handleOIDCInfo)
+		r.Get("/auth/oidc/login", server.handleOIDCLogin)
+		r.Get("/auth/oidc/callback", server.handleOIDCCallback)
 		r.Post("/webhooks/{token}", server.handleWebhook)
 
-		// 需要认证的接口
+		// 需要认证的接口，viewer 及以上角色均可读取，写操作按角色和项目授权校验
 		r.Group(func(r chi.Router) {
-			r.Use(AuthMiddleware(server.jwtManager))
+			r.Use(AuthMiddleware(server.jwtManager, server.store))
+			r.Use(requirePasswordChange)
+			r.Use(server.requireTwoFactorEnrolled)
+			maintainer := RequireRole(model.RoleMaintainer)
+			admin := RequireRole(model.RoleAdmin)
 
 			r.Route("/hosts", func(r chi.Router) {
 				r.Get("/", server.handleListHosts)
-				r.Post("/", server.handleCreateHost)
-				r.Put("/reorder", server.handleReorderHosts)
+				r.With(maintainer).Post("/", server.handleCreateHost)
+				r.With(maintainer).Put("/reorder", server.handleReorderHosts)
 				r.Route("/{hostID}", func(r chi.Router) {
 					r.Get("/", server.handleGetHost)
-					r.Put("/", server.handleUpdateHost)
-					r.Delete("/", server.handleDeleteHost)
+					r.With(maintainer).Put("/", server.handleUpdateHost)
+					r.With(maintainer).Delete("/", server.handleDeleteHost)
 				})
 			})
 
 			r.Route("/projects", func(r chi.Router) {
 				r.Get("/", server.handleListProjects)
-				r.Post("/", server.handleCreateProject)
-				r.Put("/reorder", server.handleReorderProjects)
+				r.With(maintainer).Post("/", server.handleCreateProject)
+				r.With(maintainer).Put("/reorder", server.handleReorderProjects)
 				r.Route("/{projectID}", func(r chi.Router) {
+					projectMaintainer := server.requireProjectRole(model.RoleMaintainer)
 					r.Get("/", server.handleGetProject)
-					r.Put("/", server.handleUpdateProject)
-					r.Delete("/", server.handleDeleteProject)
-					r.Post("/clone", server.handleCloneProject)
-					r.Put("/deploy-config", server.handleUpsertDeployConfig)
+					r.With(projectMaintainer).Put("/", server.handleUpdateProject)
+					r.With(projectMaintainer).Delete("/", server.handleDeleteProject)
+					r.With(maintainer).Post("/clone", server.handleCloneProject)
+					r.With(projectMaintainer).Put("/deploy-config", server.handleUpsertDeployConfig)
 					r.Get("/deploy-config", server.handleGetDeployConfig)
 					r.Get("/runs", server.handleListProjectRuns)
-					r.Post("/trigger", server.handleTriggerProject)
+					r.With(server.requireProjectRole(model.RoleDeployer)).Post("/trigger", server.handleTriggerProject)
 				})
 			})
 
 			r.Route("/notification-channels", func(r chi.Router) {
 				r.Get("/", server.handleListNotificationChannels)
-				r.Post("/", server.handleCreateNotificationChannel)
-				r.Put("/reorder", server.handleReorderNotificationChannels)
+				r.With(maintainer).Post("/", server.handleCreateNotificationChannel)
+				r.With(maintainer).Put("/reorder", server.handleReorderNotificationChannels)
 				r.Route("/{channelID}", func(r chi.Router) {
 					r.Get("/", server.handleGetNotificationChannel)
-					r.Put("/", server.handleUpdateNotificationChannel)
-					r.Delete("/", server.handleDeleteNotificationChannel)
-					r.Put("/default", server.handleSetDefaultNotificationChannel)
-					r.Post("/test", server.handleTestNotificationChannel)
+					r.With(maintainer).Put("/", server.handleUpdateNotificationChannel)
+					r.With(maintainer).Delete("/", server.handleDeleteNotificationChannel)
+					r.With(maintainer).Put("/default", server.handleSetDefaultNotificationChannel)
+					r.With(maintainer).Post("/test", server.handleTestNotificationChannel)
+				})
+			})
+
+			r.Route("/webhook-deliveries", func(r chi.Router) {
+				r.Get("/", server.handleListWebhookDeliveries)
+				r.Route("/{deliveryID}", func(r chi.Router) {
+					r.Get("/", server.handleGetWebhookDelivery)
+					r.With(maintainer).Post("/replay", server.handleReplayWebhookDelivery)
 				})
 			})
 
 			r.Route("/settings", func(r chi.Router) {
 				r.Get("/", server.handleListSettings)
-				r.Get("/backup", server.handleExportBackup)
-				r.Post("/restore", server.handleImportBackup)
-				r.Put("/{key}", server.handleUpdateSetting)
+				r.With(admin).Get("/backup", server.handleExportBackup)
+				r.With(admin).Post("/restore", server.handleImportBackup)
+				r.With(admin).Put("/{key}", server.handleUpdateSetting)
 			})
 
 			r.Route("/update", func(r chi.Router) {
 				r.Get("/", server.handleGetLatestRelease)
 				r.Get("/now-version", server.handleGetUpdateStatus)
-				r.Post("/", server.handleApplyUpdate)
+				r.With(admin).Post("/", server.handleApplyUpdate)
 			})
 
+			// 当前登录账号的资料
 			r.Route("/admin", func(r chi.Router) {
+				r.Use(requireSession)
 				r.Get("/profile", server.handleGetAdminProfile)
 				r.Put("/username", server.handleChangeAdminUsername)
 				r.Put("/password", server.handleChangeAdminPassword)
+				r.Route("/2fa", func(r chi.Router) {
+					r.Post("/setup", server.handleTwoFactorSetup)
+					r.Post("/enable", server.handleEnableTwoFactor)
+					r.Post("/disable", server.handleDisableTwoFactor)
+					r.Post("/recovery-codes", server.handleRegenerateRecoveryCodes)
+				})
 			})
 
+			// 当前账号的登录会话
+			r.Route("/sessions", func(r chi.Router) {
+				r.Use(requireSession)
+				r.Get("/", server.handleListSessions)
+				r.Delete("/", server.handleDeleteSessions)
+				r.Delete("/{sessionID}", server.handleDeleteSession)
+			})
+
+			// 当前账号的个人 API 令牌，只能在登录会话中管理
+			r.Route("/tokens", func(r chi.Router) {
+				r.Use(requireSession)
+				r.Get("/", server.handleListAPITokens)
+				r.Post("/", server.handleCreateAPIToken)
+				r.Delete("/{tokenID}", server.handleDeleteAPIToken)
+			})
+
+			r.Route("/users", func(r chi.Router) {
+				r.Use(admin)
+				r.Get("/", server.handleListUsers)
+				r.Post("/", server.handleCreateUser)
+				r.Route("/{userID}", func(r chi.Router) {
+					r.Get("/", server.handleGetUser)
+					r.Put("/", server.handleUpdateUser)
+					r.Delete("/", server.handleDeleteUser)
+					r.Get("/permissions", server.handleListUserPermissions)
+					r.Put("/permissions", server.handleSetUserPermissions)
+					r.Delete("/2fa", server.handleResetUserTwoFactor)
+					r.Delete("/sessions", server.handleDeleteUserSessions)
+				})
+			})
+
+			r.With(admin).Get("/audit-events", server.handleListAuditEvents)
+
 			r.Get("/runs", server.handleListAllRuns)
-			r.Delete("/runs", server.handleClearRuns)
+			r.With(admin).Delete("/runs", server.handleClearRuns)
+			r.Get("/runs/search", server.handleSearchRuns)
 			r.Get("/runs/{runID}", server.handleGetRun)
 			r.Get("/runs/{runID}/log", server.handleGetRunLog)
-			r.Post("/runs/{runID}/cancel", server.handleCancelRun)
+			r.Get("/runs/{runID}/log/download", server.handleDownloadRunLog)
+			r.Get("/runs/{runID}/artifact", server.handleDownloadRunArtifact)
+			r.Post("/runs/{runID}/stream-ticket", server.handleCreateStreamTicket)
+			r.With(server.requireRunRole(model.RoleDeployer)).Post("/runs/{runID}/cancel", server.handleCancelRun)
 			r.Get("/stats", server.handleStats)
 			r.Get("/dashboard/home", server.handleHomeDashboard)
 			r.Get("/system/info", server.handleSystemInfo)
 		})
 
-		// 流式接口移到认证组外面，支持查询参数传递token
+		// 流式接口在认证组外面，浏览器使用 stream-ticket 接口签发的一次性票据
 		r.Get("/runs/{runID}/stream", server.handleStreamRun)
 	})
 
@@ -149,6 +239,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-Artifact-SHA256, X-Total-Count, X-Next-Cursor")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -179,7 +270,7 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	runs, err := s.store.ListAllRuns(ctx, 0, 1000)
+	runCount, err := s.store.CountRuns(ctx, model.RunFilter{})
 	if err != nil {
 		s.writeError(w, err)
 		return
@@ -194,7 +285,7 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	stats := map[string]int{
 		"host_count":           len(hosts),
 		"project_count":        len(projects),
-		"run_count":            len(runs),
+		"run_count":            int(runCount),
 		"notify_channel_count": len(channels),
 	}
 
@@ -243,6 +334,7 @@ func (s *Server) handleCreateHost(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "host.create", "host", host.ID, host.Name, nil, host)
 	writeJSON(w, http.StatusCreated, host)
 }
 
@@ -281,11 +373,17 @@ func (s *Server) handleUpdateHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := s.store.GetHost(r.Context(), hostID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	host, err := s.store.UpdateHost(r.Context(), hostID, input)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "host.update", "host", host.ID, host.Name, before, host)
 	writeJSON(w, http.StatusOK, host)
 }
 
@@ -295,10 +393,16 @@ func (s *Server) handleDeleteHost(w http.ResponseWriter, r *http.Request) {
 		s.writeBadRequest(w, err)
 		return
 	}
+	before, err := s.store.GetHost(r.Context(), hostID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	if err = s.store.DeleteHost(r.Context(), hostID); err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "host.delete", "host", hostID, before.Name, before, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -316,6 +420,7 @@ func (s *Server) handleReorderHosts(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "host.reorder", "host", nil, "", nil, input)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -348,6 +453,7 @@ func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "project.create", "project", project.Project.ID, project.Project.Name, nil, project)
 	writeJSON(w, http.StatusCreated, project)
 }
 
@@ -394,11 +500,17 @@ func (s *Server) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := s.store.GetProjectDetail(r.Context(), projectID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	project, err := s.store.UpdateProjectDetail(r.Context(), projectID, input)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "project.update", "project", projectID, project.Project.Name, before, project)
 	writeJSON(w, http.StatusOK, project)
 }
 
@@ -408,10 +520,16 @@ func (s *Server) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
 		s.writeBadRequest(w, err)
 		return
 	}
+	before, err := s.store.GetProjectDetail(r.Context(), projectID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	if err = s.store.DeleteProject(r.Context(), projectID); err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "project.delete", "project", projectID, before.Project.Name, before, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -429,6 +547,7 @@ func (s *Server) handleReorderProjects(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "project.reorder", "project", nil, "", nil, input)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -454,6 +573,7 @@ func (s *Server) handleCloneProject(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "project.clone", "project", project.Project.ID, project.Project.Name, map[string]int64{"source_project_id": projectID}, project)
 	writeJSON(w, http.StatusCreated, project)
 }
 
@@ -474,11 +594,19 @@ func (s *Server) handleUpsertDeployConfig(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	var before any
+	if existing, err := s.store.GetDeployConfigByProjectID(r.Context(), projectID); err == nil {
+		before = existing
+	} else if !errors.Is(err, store.ErrNotFound) {
+		s.writeError(w, err)
+		return
+	}
 	config, err := s.store.UpsertDeployConfig(r.Context(), projectID, input)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "deploy_config.update", "project", projectID, "", before, config)
 	writeJSON(w, http.StatusOK, config)
 }
 
@@ -508,14 +636,13 @@ func (s *Server) handleListProjectRuns(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := parseRunListLimit(r, 50)
-
-	runs, err := s.store.ListRunsByProject(r.Context(), projectID, limit)
+	query, err := parseRunListQuery(r)
 	if err != nil {
-		s.writeError(w, err)
+		s.writeBadRequest(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, runs)
+	query.Filter.ProjectID = projectID
+	s.writeRunPage(w, r, query)
 }
 
 func (s *Server) handleListAllRuns(w http.ResponseWriter, r *http.Request) {
@@ -523,22 +650,61 @@ func (s *Server) handleListAllRuns(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
-	// 解析分页参数，默认显示前50条记录
-	offset := 0
-	limit := parseRunListLimit(r, 50)
 
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if parsed, err := strconv.Atoi(offsetStr); err == nil && parsed >= 0 {
-			offset = parsed
+	query, err := parseRunListQuery(r)
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	s.writeRunPage(w, r, query)
+}
+
+// writeRunPage keeps the plain array body older clients expect and reports the
+// total count and next page cursor in response headers.
+func (s *Server) writeRunPage(w http.ResponseWriter, r *http.Request, query model.RunListQuery) {
+	page, err := s.store.ListRunPage(r.Context(), query)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	writeJSON(w, http.StatusOK, page.Runs)
+}
+
+// handleSearchRuns finds runs whose logs contain every term of ?q=, optionally
+// limited to ?project=.
+func (s *Server) handleSearchRuns(w http.ResponseWriter, r *http.Request) {
+	query := model.RunSearchQuery{
+		Query: strings.TrimSpace(r.URL.Query().Get("q")),
+		Limit: parseRunListLimit(r, 20),
+	}
+	if query.Query == "" {
+		s.writeBadRequest(w, errors.New("q is required"))
+		return
+	}
+	if project := r.URL.Query().Get("project"); project != "" {
+		projectID, err := strconv.ParseInt(project, 10, 64)
+		if err != nil || projectID <= 0 {
+			s.writeBadRequest(w, errors.New("project must be a positive integer"))
+			return
 		}
+		query.ProjectID = projectID
 	}
 
-	runs, err := s.store.ListAllRuns(r.Context(), offset, limit)
+	results, err := s.store.SearchRunLogs(r.Context(), query)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, runs)
+	writeJSON(w, http.StatusOK, results)
 }
 
 func (s *Server) handleTriggerProject(w http.ResponseWriter, r *http.Request) {
@@ -548,11 +714,12 @@ func (s *Server) handleTriggerProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	run, err := s.executor.Trigger(r.Context(), projectID, model.TriggerTypeManual, "manual")
+	run, err := s.executor.TriggerManual(r.Context(), projectID, GetUsername(r))
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "run.trigger", "run", run.ID, run.ProjectName, nil, map[string]any{"project_id": projectID})
 	writeJSON(w, http.StatusAccepted, run)
 }
 
@@ -586,67 +753,146 @@ func (s *Server) handleGetRunLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	runLog, err := s.store.GetRunLog(r.Context(), runID)
+	logQuery, err := parseRunLogQuery(r)
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+
+	runLog, err := s.store.GetRunLog(r.Context(), runID, logQuery)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+
+	// format=entries 返回结构化日志，format=text 以纯文本导出，默认保持原有的 log_text 响应
+	switch r.URL.Query().Get("format") {
+	case "":
+		runLog.Entries = nil
+	case "entries":
+		runLog.LogText = ""
+		if runLog.Entries == nil {
+			runLog.Entries = []model.RunLogEntry{}
+		}
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, runLog.LogText)
+		return
+	default:
+		s.writeBadRequest(w, errors.New("format must be one of entries, text"))
+		return
+	}
 	writeJSON(w, http.StatusOK, runLog)
 }
 
-func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
+// handleDownloadRunLog exports the full plain-text log; ?format=gzip returns
+// it gzip compressed.
+func (s *Server) handleDownloadRunLog(w http.ResponseWriter, r *http.Request) {
 	runID, err := parseInt64Param(r, "runID")
 	if err != nil {
 		s.writeBadRequest(w, err)
 		return
 	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "gzip" {
+		s.writeBadRequest(w, errors.New("format must be one of text, gzip"))
+		return
+	}
+	if _, err := s.store.GetRunSummary(r.Context(), runID); err != nil {
+		s.writeError(w, err)
+		return
+	}
 
-	run, err := s.executor.CancelRun(r.Context(), runID)
+	// 先读出第一页再发送响应头，读取失败时还能返回错误状态
+	page, cursor, more, err := s.store.RunLogExportPage(r.Context(), runID, -1)
 	if err != nil {
-		s.writeBadRequest(w, err)
+		s.writeError(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, run)
+
+	filename := fmt.Sprintf("run-%d.log", runID)
+	var body io.Writer = w
+	if format == "gzip" {
+		filename += ".gz"
+		w.Header().Set("Content-Type", "application/gzip")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	if format == "gzip" {
+		gzipWriter := gzip.NewWriter(w)
+		defer gzipWriter.Close()
+		body = gzipWriter
+	}
+	for {
+		if _, err := io.WriteString(body, page); err != nil {
+			return
+		}
+		if !more {
+			return
+		}
+		// 响应头已发出，后续页读取失败时只能记录日志并截断响应
+		if page, cursor, more, err = s.store.RunLogExportPage(r.Context(), runID, cursor); err != nil {
+			s.logger.Error("export run log failed", "run_id", runID, "error", err)
+			return
+		}
+	}
 }
 
-func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
-	token := chi.URLParam(r, "token")
-	if strings.TrimSpace(token) == "" {
-		s.writeBadRequest(w, errors.New("missing webhook token"))
+// handleDownloadRunArtifact serves the retained artifact archive of a run.
+func (s *Server) handleDownloadRunArtifact(w http.ResponseWriter, r *http.Request) {
+	runID, err := parseInt64Param(r, "runID")
+	if err != nil {
+		s.writeBadRequest(w, err)
 		return
 	}
-
-	project, err := s.store.GetProjectByWebhookToken(r.Context(), token)
+	run, err := s.store.GetRunSummary(r.Context(), runID)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
 
-	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	file, err := os.Open(s.executor.ArtifactPath(runID))
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "artifact is not retained for this run"})
+		return
+	}
 	if err != nil {
-		s.writeBadRequest(w, fmt.Errorf("read webhook body: %w", err))
+		s.writeError(w, err)
 		return
 	}
+	defer file.Close()
 
-	branch, triggerRef, err := extractWebhookBranch(r.Context(), body, r.Header)
+	info, err := file.Stat()
 	if err != nil {
-		s.writeBadRequest(w, err)
+		s.writeError(w, err)
 		return
 	}
-	if branch != "" && branch != project.Branch {
-		s.writeBadRequest(w, fmt.Errorf("branch mismatch: expected %s got %s", project.Branch, branch))
-		return
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("run-%d.tgz", runID)))
+	if run.ArtifactSHA256 != "" {
+		w.Header().Set("X-Artifact-SHA256", run.ArtifactSHA256)
 	}
-	if triggerRef == "" {
-		triggerRef = branch
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
+	runID, err := parseInt64Param(r, "runID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
 	}
 
-	run, err := s.executor.Trigger(r.Context(), project.ID, model.TriggerTypeWebhook, triggerRef)
+	run, err := s.executor.CancelRun(r.Context(), runID, GetUsername(r))
 	if err != nil {
-		s.writeError(w, err)
+		s.writeBadRequest(w, err)
 		return
 	}
-	writeJSON(w, http.StatusAccepted, run)
+	s.audit(r, "run.cancel", "run", run.ID, run.ProjectName, nil, map[string]any{"status": run.Status})
+	writeJSON(w, http.StatusOK, run)
 }
 
 func (s *Server) writeBadRequest(w http.ResponseWriter, err error) {
@@ -654,14 +900,21 @@ func (s *Server) writeBadRequest(w http.ResponseWriter, err error) {
 }
 
 func (s *Server) writeError(w http.ResponseWriter, err error) {
+	statusCode := errorStatusCode(err)
+	if statusCode == http.StatusInternalServerError {
+		s.logger.Error("request failed", "error", err)
+	}
+	writeJSON(w, statusCode, map[string]string{"error": err.Error()})
+}
+
+func errorStatusCode(err error) int {
 	switch {
 	case errors.Is(err, store.ErrNotFound):
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return http.StatusNotFound
 	case store.IsConstraintError(err):
-		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return http.StatusConflict
 	default:
-		s.logger.Error("request failed", "error", err)
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return http.StatusInternalServerError
 	}
 }
 
@@ -700,6 +953,137 @@ func parseRunListLimit(r *http.Request, defaultLimit int) int {
 	return limit
 }
 
+// parseRunListQuery reads the run filters together with ?sort=created|started_at|duration,
+// ?order=asc|desc, ?cursor= and the legacy ?limit= / ?offset= parameters.
+func parseRunListQuery(r *http.Request) (model.RunListQuery, error) {
+	filter, err := parseRunFilter(r)
+	if err != nil {
+		return model.RunListQuery{}, err
+	}
+	query := model.RunListQuery{
+		Filter: filter,
+		Sort:   r.URL.Query().Get("sort"),
+		Cursor: r.URL.Query().Get("cursor"),
+		Limit:  parseRunListLimit(r, 50),
+	}
+
+	switch query.Sort {
+	case "", model.RunSortCreated, model.RunSortStarted, model.RunSortDuration:
+	default:
+		return model.RunListQuery{}, errors.New("sort must be one of created, started_at, duration")
+	}
+	switch r.URL.Query().Get("order") {
+	case "", "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		return model.RunListQuery{}, errors.New("order must be asc or desc")
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if parsed, err := strconv.Atoi(offsetStr); err == nil && parsed >= 0 {
+			query.Offset = parsed
+		}
+	}
+	return query, nil
+}
+
+// parseRunLogQuery reads ?offset= (first line, zero based) and ?tail= (last N lines).
+func parseRunLogQuery(r *http.Request) (model.RunLogQuery, error) {
+	var logQuery model.RunLogQuery
+	for name, target := range map[string]*int64{"offset": &logQuery.Offset, "tail": &logQuery.Tail} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return model.RunLogQuery{}, fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		*target = parsed
+	}
+
+	logQuery.Stage = strings.TrimSpace(r.URL.Query().Get("stage"))
+	logQuery.Source = strings.TrimSpace(r.URL.Query().Get("source"))
+	switch logQuery.Source {
+	case "", model.LogSourceSystem, model.LogSourceStdout, model.LogSourceStderr, model.LogSourceRemote:
+	default:
+		return model.RunLogQuery{}, errors.New("source must be one of system, stdout, stderr, remote")
+	}
+	return logQuery, nil
+}
+
+// parseRunFilter reads the run list filters: ?project=, ?status= (comma
+// separated), ?trigger=, ?branch=, ?commit= (SHA prefix), ?author= and the
+// ?from= / ?to= creation date range.
+func parseRunFilter(r *http.Request) (model.RunFilter, error) {
+	query := r.URL.Query()
+	filter := model.RunFilter{
+		TriggerType:  strings.TrimSpace(query.Get("trigger")),
+		Branch:       strings.TrimSpace(query.Get("branch")),
+		CommitPrefix: strings.TrimSpace(query.Get("commit")),
+		Author:       strings.TrimSpace(query.Get("author")),
+	}
+
+	if project := strings.TrimSpace(query.Get("project")); project != "" {
+		projectID, err := strconv.ParseInt(project, 10, 64)
+		if err != nil || projectID <= 0 {
+			return model.RunFilter{}, errors.New("project must be a positive integer")
+		}
+		filter.ProjectID = projectID
+	}
+	for _, status := range strings.Split(query.Get("status"), ",") {
+		status = strings.TrimSpace(status)
+		switch status {
+		case "":
+			continue
+		case model.RunStatusQueued, model.RunStatusRunning, model.RunStatusSuccess, model.RunStatusFailed, model.RunStatusSkipped:
+			filter.Statuses = append(filter.Statuses, status)
+		default:
+			return model.RunFilter{}, fmt.Errorf("unsupported status %q", status)
+		}
+	}
+	switch filter.TriggerType {
+	case "", model.TriggerTypeWebhook, model.TriggerTypeManual, model.TriggerTypePullRequest:
+	default:
+		return model.RunFilter{}, fmt.Errorf("unsupported trigger %q", filter.TriggerType)
+	}
+	for _, c := range filter.CommitPrefix {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return model.RunFilter{}, errors.New("commit must be a hexadecimal sha prefix")
+		}
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseRunDateParam(query.Get("from"), false); err != nil {
+		return model.RunFilter{}, fmt.Errorf("from: %w", err)
+	}
+	if filter.CreatedTo, err = parseRunDateParam(query.Get("to"), true); err != nil {
+		return model.RunFilter{}, fmt.Errorf("to: %w", err)
+	}
+	return filter, nil
+}
+
+// parseRunDateParam accepts RFC3339 timestamps or YYYY-MM-DD dates in server
+// local time. A date used as the upper bound includes that whole day.
+func parseRunDateParam(value string, endOfRange bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("must be an RFC3339 time or a YYYY-MM-DD date")
+	}
+	if endOfRange {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return parsed, nil
+}
+
 func validateHostInput(input model.HostUpsert, requirePassword bool) error {
 	if strings.TrimSpace(input.Name) == "" {
 		return errors.New("host name is required")
@@ -775,6 +1159,49 @@ func validateProjectInput(input model.ProjectUpsert, current *model.Project) err
 		}
 	}
 
+	if err := validatePathFilters("path_includes", input.PathIncludes); err != nil {
+		return err
+	}
+	if err := validatePathFilters("path_excludes", input.PathExcludes); err != nil {
+		return err
+	}
+
+	return validateCommitStatusInput(input, current)
+}
+
+// validateCommitStatusInput checks the provider, API URL and token that are
+// effective after applying input on top of the current project.
+func validateCommitStatusInput(input model.ProjectUpsert, current *model.Project) error {
+	provider, apiURL, token := "", "", ""
+	if current != nil {
+		provider, apiURL, token = current.CommitStatusProvider, current.CommitStatusAPIURL, current.CommitStatusToken
+	}
+	if input.CommitStatusProvider != nil {
+		provider = strings.TrimSpace(*input.CommitStatusProvider)
+	}
+	if input.CommitStatusAPIURL != nil {
+		apiURL = strings.TrimSpace(*input.CommitStatusAPIURL)
+	}
+	if input.CommitStatusToken != nil {
+		token = strings.TrimSpace(*input.CommitStatusToken)
+	}
+
+	switch provider {
+	case model.CommitStatusProviderNone:
+		return nil
+	case model.CommitStatusProviderGitHub, model.CommitStatusProviderGitLab, model.CommitStatusProviderGitea:
+	default:
+		return errors.New("commit_status_provider must be one of github/gitlab/gitea")
+	}
+	if apiURL != "" && !strings.HasPrefix(apiURL, "http://") && !strings.HasPrefix(apiURL, "https://") {
+		return errors.New("commit_status_api_url must start with http:// or https://")
+	}
+	if token == "" {
+		return errors.New("commit_status_token is required when commit_status_provider is set")
+	}
+	if _, _, err := gitprovider.ParseRepoURL(input.RepoURL); err != nil {
+		return fmt.Errorf("commit status: %w", err)
+	}
 	return nil
 }
 
@@ -816,52 +1243,6 @@ func validateDeployConfigInput(input model.DeployConfigUpsert) error {
 	return nil
 }
 
-type webhookPayload struct {
-	Ref    string `json:"ref"`
-	Branch string `json:"branch"`
-	After  string `json:"after"`
-	Push   struct {
-		Changes []struct {
-			New struct {
-				Name string `json:"name"`
-			} `json:"new"`
-		} `json:"changes"`
-	} `json:"push"`
-}
-
-func extractWebhookBranch(ctx context.Context, body []byte, headers http.Header) (branch string, triggerRef string, err error) {
-	if len(body) == 0 {
-		ref := headers.Get("X-Git-Ref")
-		return normalizeRef(ref), ref, nil
-	}
-
-	var payload webhookPayload
-	if err = json.Unmarshal(body, &payload); err != nil {
-		return "", "", fmt.Errorf("invalid webhook payload: %w", err)
-	}
-
-	switch {
-	case payload.Ref != "":
-		return normalizeRef(payload.Ref), payload.Ref, nil
-	case payload.Branch != "":
-		return strings.TrimSpace(payload.Branch), payload.Branch, nil
-	case len(payload.Push.Changes) > 0 && payload.Push.Changes[0].New.Name != "":
-		name := payload.Push.Changes[0].New.Name
-		return name, name, nil
-	case headers.Get("X-Git-Ref") != "":
-		ref := headers.Get("X-Git-Ref")
-		return normalizeRef(ref), ref, nil
-	default:
-		return "", "", nil
-	}
-}
-
-func normalizeRef(ref string) string {
-	ref = strings.TrimSpace(ref)
-	ref = strings.TrimPrefix(ref, "refs/heads/")
-	return ref
-}
-
 // 通知渠道管理处理器
 
 func (s *Server) handleListNotificationChannels(w http.ResponseWriter, r *http.Request) {
@@ -890,6 +1271,7 @@ func (s *Server) handleCreateNotificationChannel(w http.ResponseWriter, r *http.
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "notification_channel.create", "notification_channel", channel.ID, channel.Name, nil, channel)
 	writeJSON(w, http.StatusCreated, channel)
 }
 
@@ -926,11 +1308,17 @@ func (s *Server) handleUpdateNotificationChannel(w http.ResponseWriter, r *http.
 		return
 	}
 
+	before, err := s.store.GetNotificationChannel(r.Context(), channelID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	channel, err := s.store.UpdateNotificationChannel(r.Context(), channelID, input)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "notification_channel.update", "notification_channel", channel.ID, channel.Name, before, channel)
 	writeJSON(w, http.StatusOK, channel)
 }
 
@@ -941,10 +1329,16 @@ func (s *Server) handleDeleteNotificationChannel(w http.ResponseWriter, r *http.
 		return
 	}
 
+	before, err := s.store.GetNotificationChannel(r.Context(), channelID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	if err = s.store.DeleteNotificationChannel(r.Context(), channelID); err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "notification_channel.delete", "notification_channel", channelID, before.Name, before, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -959,6 +1353,7 @@ func (s *Server) handleSetDefaultNotificationChannel(w http.ResponseWriter, r *h
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "notification_channel.set_default", "notification_channel", channelID, "", nil, nil)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -976,6 +1371,7 @@ func (s *Server) handleReorderNotificationChannels(w http.ResponseWriter, r *htt
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "notification_channel.reorder", "notification_channel", nil, "", nil, input)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1008,6 +1404,7 @@ func (s *Server) handleTestNotificationChannel(w http.ResponseWriter, r *http.Re
 	}
 
 	s.logger.Info("测试通知发送成功", "channel_id", channelID)
+	s.audit(r, "notification_channel.test", "notification_channel", channelID, channel.Name, nil, nil)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
@@ -1074,33 +1471,40 @@ func (s *Server) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取管理员用户
-	admin, err := s.store.GetAdminUser(r.Context())
-	if err != nil {
-		s.writeError(w, err)
+	username := strings.TrimSpace(input.Username)
+	// 尝试在验证密码前就计为一次失败，并发的请求也会被限制
+	attempt, wait := s.loginThrottle.begin(r, username)
+	if wait > 0 {
+		writeTooManyLoginAttempts(w, wait)
 		return
 	}
 
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(input.Password)); err != nil {
-		s.writeBadRequest(w, errors.New("invalid username or password"))
+	// 配置了 LDAP 时先通过目录验证，目录拒绝或不可用时回退到本地账号
+	method := "ldap"
+	user, err := s.authenticateLDAP(r.Context(), username, input.Password)
+	if errors.Is(err, errLDAPNotUsed) {
+		method = "password"
+		user, err = s.authenticateLocal(r.Context(), username, input.Password)
+	}
+	if errors.Is(err, errInvalidLogin) {
+		s.loginFailed(r, attempt, username, 0, err.Error())
+		s.writeBadRequest(w, err)
+		return
+	}
+	s.loginThrottle.release(attempt)
+	if err != nil {
+		s.writeError(w, err)
 		return
 	}
 
-	// 生成JWT token
-	jwtManager := auth.NewJWTManager(s.config.Secret)
-	token, err := jwtManager.GenerateToken(admin.ID, admin.Username, 24*time.Hour) // 24小时有效期
+	// 启用了两步验证的账号先拿到挑战令牌，验证码通过后才签发 JWT
+	response, err := s.loginResponse(r, user, method)
 	if err != nil {
 		s.logger.Error("failed to generate token", "error", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to generate token"})
 		return
 	}
 
-	response := model.LoginResponse{
-		Token:    token,
-		Username: admin.Username,
-	}
-
 	writeJSON(w, http.StatusOK, response)
 }
 
@@ -0,0 +1,185 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/auth"
+	"devops-pipeline/internal/model"
+	"devops-pipeline/internal/store"
+)
+
+const maxUserAgentLength = 512
+
+var errRefreshTokenInvalid = errors.New("session has ended, please sign in again")
+
+// handleRefreshSession exchanges a refresh token for a new access token and
+// a new refresh token. The old refresh token stops working, so a copy that
+// was stolen and used first locks the real client out instead of quietly
+// sharing the session.
+func (s *Server) handleRefreshSession(w http.ResponseWriter, r *http.Request) {
+	var input model.RefreshRequest
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if !strings.HasPrefix(input.RefreshToken, auth.RefreshTokenPrefix) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": errRefreshTokenInvalid.Error()})
+		return
+	}
+	oldHash := auth.HashAPIToken(input.RefreshToken)
+	session, err := s.store.GetUserSessionByTokenHash(r.Context(), oldHash)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !time.Now().Before(session.ExpiresAt)) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": errRefreshTokenInvalid.Error()})
+		return
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	user, err := s.store.GetUser(r.Context(), session.UserID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && user.Disabled) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": errRefreshTokenInvalid.Error()})
+		return
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	refreshToken, refreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	err = s.store.RotateUserSession(r.Context(), session.ID, oldHash, refreshHash, time.Now().Add(sessionIdleTTL))
+	if errors.Is(err, store.ErrNotFound) {
+		// 并发刷新时只有一个请求能换到新令牌
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": errRefreshTokenInvalid.Error()})
+		return
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	token, err := s.jwtManager.GenerateToken(user.ID, user.Username, session.ID, accessTokenTTL)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.LoginResponse{
+		Token:                  token,
+		RefreshToken:           refreshToken,
+		ExpiresIn:              int(accessTokenTTL.Seconds()),
+		Username:               user.Username,
+		Role:                   user.Role,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+	})
+}
+
+// handleLogout ends the session of a refresh token. It succeeds for unknown
+// tokens as well, so a client can always clear its state.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	var input model.RefreshRequest
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if strings.HasPrefix(input.RefreshToken, auth.RefreshTokenPrefix) {
+		session, err := s.store.GetUserSessionByTokenHash(r.Context(), auth.HashAPIToken(input.RefreshToken))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			s.writeError(w, err)
+			return
+		}
+		if err == nil {
+			if err := s.store.DeleteUserSession(r.Context(), session.UserID, session.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+				s.writeError(w, err)
+				return
+			}
+			username := ""
+			if user, err := s.store.GetUser(r.Context(), session.UserID); err == nil {
+				username = user.Username
+			}
+			s.auditLogin(r, "auth.logout", username, session.UserID, nil)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.store.ListUserSessions(r.Context(), GetUserID(r))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	current := currentSessionID(r)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := parseInt64Param(r, "sessionID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if err := s.store.DeleteUserSession(r.Context(), GetUserID(r), sessionID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "session.revoke", "user_session", sessionID, "", nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteSessions signs the account out everywhere, including the
+// session making the request.
+func (s *Server) handleDeleteSessions(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	revoked, err := s.store.DeleteUserSessions(r.Context(), user.ID, 0)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "session.revoke_all", "user", user.ID, user.Username, nil, map[string]int64{"revoked": revoked})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteUserSessions lets an admin sign another account out everywhere.
+func (s *Server) handleDeleteUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseInt64Param(r, "userID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	target, err := s.store.GetUser(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	revoked, err := s.store.DeleteUserSessions(r.Context(), userID, currentSessionID(r))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "user.sessions_revoke", "user", userID, target.Username, nil, map[string]int64{"revoked": revoked})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endOtherSessions revokes the sessions of userID after its credentials
+// changed. The session making the request is kept, so changing one's own
+// password does not sign the current browser out.
+func (s *Server) endOtherSessions(r *http.Request, userID int64) error {
+	_, err := s.store.DeleteUserSessions(r.Context(), userID, currentSessionID(r))
+	return err
+}
+
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+	return strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+}
@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"devops-pipeline/internal/auth"
+)
+
+func TestGenerateRefreshToken(t *testing.T) {
+	token, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("generate refresh token: %v", err)
+	}
+	if !strings.HasPrefix(token, auth.RefreshTokenPrefix) || hash != auth.HashAPIToken(token) {
+		t.Fatalf("unexpected token %q with hash %q", token, hash)
+	}
+	if auth.IsAPIToken(token) {
+		t.Fatal("expected a refresh token not to be accepted as an api token")
+	}
+	other, _, err := auth.GenerateRefreshToken()
+	if err != nil || other == token {
+		t.Fatalf("expected distinct refresh tokens, got %q twice (%v)", token, err)
+	}
+}
+
+func TestTruncateUserAgentKeepsValidUTF8(t *testing.T) {
+	short := "Mozilla/5.0"
+	if got := truncateUserAgent(short); got != short {
+		t.Fatalf("expected %q unchanged, got %q", short, got)
+	}
+	long := strings.Repeat("浏", maxUserAgentLength)
+	got := truncateUserAgent(long)
+	if len(got) > maxUserAgentLength || !utf8.ValidString(got) {
+		t.Fatalf("unexpected truncation to %d bytes, valid utf8 %v", len(got), utf8.ValidString(got))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"devops-pipeline/internal/model"
+	"devops-pipeline/internal/store"
 	"devops-pipeline/internal/update"
 	"devops-pipeline/internal/version"
 
@@ -40,11 +41,23 @@ func (s *Server) handleUpdateSetting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 管理员自己先启用两步验证，避免开启要求后才发现无法完成验证
+	if key == model.SettingTwoFactorRequired && strings.TrimSpace(input.Value) == "true" && !CurrentUser(r).TOTPEnabled {
+		s.writeBadRequest(w, errors.New("enable two-factor authentication for your own account before requiring it"))
+		return
+	}
+
+	before, err := s.store.GetSettingValue(r.Context(), key)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	setting, err := s.store.SetSetting(r.Context(), key, strings.TrimSpace(input.Value))
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "setting.update", "setting", key, key, map[string]string{"value": before}, map[string]string{"value": setting.Value})
 
 	if key == model.SettingRunRetentionDays {
 		if err := s.store.ApplyRunRetention(r.Context()); err != nil {
@@ -52,6 +65,18 @@ func (s *Server) handleUpdateSetting(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if key == model.SettingArtifactRetentionDays {
+		if err := s.executor.PruneArtifacts(r.Context()); err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
+	if key == model.SettingAuditRetentionDays {
+		if err := s.store.ApplyAuditRetention(r.Context()); err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
 
 	writeJSON(w, http.StatusOK, setting)
 }
@@ -73,20 +98,47 @@ func (s *Server) handleImportBackup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result, err := s.store.ImportBackup(r.Context(), backup)
+	if errors.Is(err, store.ErrSchemaTooNew) {
+		s.writeBadRequest(w, err)
+		return
+	}
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "backup.restore", "backup", nil, "", nil, map[string]any{
+		"schema_version": backup.Meta.SchemaVersion,
+		"rows_affected":  result.RowsAffected,
+	})
 	writeJSON(w, http.StatusOK, result)
 }
 
 func (s *Server) handleGetAdminProfile(w http.ResponseWriter, r *http.Request) {
-	admin, err := s.store.GetAdminUser(r.Context())
+	user := CurrentUser(r)
+	permissions, err := s.store.ListProjectPermissions(r.Context(), user.ID)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, model.AccountProfile{Username: admin.Username})
+	required, err := s.twoFactorRequired(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	recoveryCodesLeft, err := s.store.CountRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.AccountProfile{
+		Username:               user.Username,
+		Role:                   user.Role,
+		Permissions:            permissions,
+		TOTPEnabled:            user.TOTPEnabled,
+		RecoveryCodesLeft:      recoveryCodesLeft,
+		TwoFactorRequired:      required,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+	})
 }
 
 func (s *Server) handleChangeAdminUsername(w http.ResponseWriter, r *http.Request) {
@@ -102,10 +154,16 @@ func (s *Server) handleChangeAdminUsername(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := s.store.UpdateAdminUsername(r.Context(), input.NewUsername); err != nil {
+	previous := GetUsername(r)
+	if err := s.store.UpdateUsername(r.Context(), GetUserID(r), input.NewUsername); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.endOtherSessions(r, GetUserID(r)); err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "account.username", "user", GetUserID(r), input.NewUsername, map[string]string{"username": previous}, map[string]string{"username": input.NewUsername})
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -120,17 +178,13 @@ func (s *Server) handleChangeAdminPassword(w http.ResponseWriter, r *http.Reques
 		s.writeBadRequest(w, errors.New("old_password and new_password are required"))
 		return
 	}
-	if len(input.NewPassword) < 6 {
-		s.writeBadRequest(w, errors.New("new password must be at least 6 characters"))
+	if err := validatePassword(input.NewPassword); err != nil {
+		s.writeBadRequest(w, err)
 		return
 	}
 
-	admin, err := s.store.GetAdminUser(r.Context())
-	if err != nil {
-		s.writeError(w, err)
-		return
-	}
-	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(input.OldPassword)); err != nil {
+	user := CurrentUser(r)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.OldPassword)); err != nil {
 		s.writeBadRequest(w, errors.New("old password is incorrect"))
 		return
 	}
@@ -140,10 +194,15 @@ func (s *Server) handleChangeAdminPassword(w http.ResponseWriter, r *http.Reques
 		s.writeError(w, err)
 		return
 	}
-	if err := s.store.UpdateAdminPassword(r.Context(), string(passwordHash)); err != nil {
+	if err := s.store.UpdateUserPassword(r.Context(), user.ID, string(passwordHash)); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.endOtherSessions(r, user.ID); err != nil {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "account.password", "user", user.ID, user.Username, user, model.User{ID: user.ID, Username: user.Username, PasswordHash: string(passwordHash), Role: user.Role, Disabled: user.Disabled})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -154,6 +213,7 @@ func (s *Server) handleClearRuns(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "run.clear", "run", nil, "", nil, map[string]int64{"cleared": affected})
 	writeJSON(w, http.StatusOK, map[string]int64{"cleared": affected})
 }
 
@@ -201,13 +261,14 @@ func (s *Server) handleApplyUpdate(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, err)
 		return
 	}
+	s.audit(r, "system.update", "system", nil, "", map[string]string{"version": version.Current()}, result)
 	writeJSON(w, http.StatusOK, result)
 	update.ScheduleRestartAndExit()
 }
 
 func validateSettingKey(key string) error {
 	switch key {
-	case model.SettingDockerMirrorURL, model.SettingGitDockerImage, model.SettingBuildCacheDirs, model.SettingPublicBaseURL, model.SettingProxyURL, model.SettingRunRetentionDays:
+	case model.SettingDockerMirrorURL, model.SettingGitDockerImage, model.SettingBuildCacheDirs, model.SettingPublicBaseURL, model.SettingProxyURL, model.SettingRunRetentionDays, model.SettingSkipCIMarkers, model.SettingWebhookDeliveryRetention, model.SettingArtifactRetentionDays, model.SettingAuditRetentionDays, model.SettingTwoFactorRequired:
 		return nil
 	default:
 		return errors.New("unsupported setting key")
@@ -225,7 +286,7 @@ func (s *Server) getProxyURL(r *http.Request) string {
 func validateSettingValue(key, value string) error {
 	value = strings.TrimSpace(value)
 	switch key {
-	case model.SettingDockerMirrorURL, model.SettingProxyURL, model.SettingPublicBaseURL:
+	case model.SettingDockerMirrorURL, model.SettingProxyURL, model.SettingPublicBaseURL, model.SettingSkipCIMarkers:
 		return nil
 	case model.SettingGitDockerImage:
 		if value == "" {
@@ -252,6 +313,29 @@ func validateSettingValue(key, value string) error {
 			return errors.New("run_retention_days must be a positive integer")
 		}
 		return nil
+	case model.SettingWebhookDeliveryRetention:
+		count, err := strconv.Atoi(value)
+		if err != nil || count <= 0 {
+			return errors.New("webhook_delivery_retention must be a positive integer")
+		}
+		return nil
+	case model.SettingArtifactRetentionDays:
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return errors.New("artifact_retention_days must be a non-negative integer")
+		}
+		return nil
+	case model.SettingAuditRetentionDays:
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return errors.New("audit_retention_days must be a non-negative integer")
+		}
+		return nil
+	case model.SettingTwoFactorRequired:
+		if value != "true" && value != "false" {
+			return errors.New("two_factor_required must be true or false")
+		}
+		return nil
 	default:
 		return errors.New("unsupported setting key")
 	}
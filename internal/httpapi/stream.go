@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,42 +15,33 @@ import (
 )
 
 func (s *Server) handleStreamRun(w http.ResponseWriter, r *http.Request) {
-	// 支持从查询参数获取JWT token（用于EventSource）
-	token := r.URL.Query().Get("token")
-	if token != "" {
-		// 验证token
-		_, err := s.jwtManager.ValidateToken(token)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-	} else {
-		// 检查Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Token required", http.StatusUnauthorized)
-			return
-		}
-		parts := strings.SplitN(authHeader, " ", 2)
-		if !(len(parts) == 2 && parts[0] == "Bearer") {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
-			return
-		}
-		tokenString := parts[1]
-		_, err := s.jwtManager.ValidateToken(tokenString)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
+	runID, err := parseInt64Param(r, "runID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	// 日志流只接受一次性票据：EventSource 不能设置请求头，其他客户端也走同样的流程
+	if err := s.authenticateStream(r, runID); err != nil {
+		switch {
+		case errors.Is(err, errStreamTicketInvalid), errors.Is(err, errStreamTokenInURL), errors.Is(err, errStreamAuthRequired):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			http.Error(w, errStreamTicketInvalid.Error(), http.StatusUnauthorized)
 		}
+		return
 	}
-
-	runID, err := parseInt64Param(r, "runID")
+	next, err := parseStreamResumeOffset(r)
 	if err != nil {
 		s.writeBadRequest(w, err)
 		return
 	}
 
-	run, err := s.store.GetRun(r.Context(), runID)
+	// 先订阅再读取历史日志，避免两者之间产生的新行丢失；重复的行按序号去重
+	hub := s.executor.LogHub()
+	sub := hub.Subscribe(runID)
+	defer sub.Close()
+
+	run, err := s.store.GetRunSummary(r.Context(), runID)
 	if err != nil {
 		s.writeError(w, err)
 		return
@@ -70,14 +62,29 @@ func (s *Server) handleStreamRun(w http.ResponseWriter, r *http.Request) {
 	if err = writeRunEvent(w, run); err != nil {
 		return
 	}
+	if next, err = s.writeStoredLogLines(r.Context(), w, runID, next); err != nil {
+		return
+	}
 	flusher.Flush()
 
-	if isTerminalStatus(run.Status) {
+	finish := func() {
+		if next, err = s.writeStoredLogLines(r.Context(), w, runID, next); err != nil {
+			return
+		}
+		if run, err = s.store.GetRunSummary(r.Context(), runID); err == nil {
+			_ = writeRunEvent(w, run)
+		}
+		_, _ = fmt.Fprint(w, "event: end\ndata: {}\n\n")
+		flusher.Flush()
+	}
+
+	if isTerminalStatus(run.Status) && !hub.Active(runID) {
+		finish()
 		return
 	}
 
-	lastUpdatedAt := run.UpdatedAt
-	pollTicker := time.NewTicker(1 * time.Second)
+	// 兜底轮询：订阅缓冲区满时事件会被丢弃，定期从数据库补齐日志和状态
+	pollTicker := time.NewTicker(5 * time.Second)
 	heartbeatTicker := time.NewTicker(15 * time.Second)
 	defer pollTicker.Stop()
 	defer heartbeatTicker.Stop()
@@ -86,27 +93,51 @@ func (s *Server) handleStreamRun(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-r.Context().Done():
 			return
-		case <-pollTicker.C:
-			run, err = s.store.GetRun(context.Background(), runID)
-			if err != nil {
-				if errors.Is(err, store.ErrNotFound) || errors.Is(err, context.Canceled) {
+		case event := <-sub.C:
+			switch {
+			case event.Done:
+				finish()
+				return
+			case event.Status:
+				run, err = s.store.GetRunSummary(r.Context(), runID)
+				if err != nil {
+					s.logStreamError(runID, err)
 					return
 				}
-				s.logger.Error("stream get run failed", "run_id", runID, "error", err)
-				return
-			}
-
-			if !run.UpdatedAt.Equal(lastUpdatedAt) {
-				lastUpdatedAt = run.UpdatedAt
 				if err = writeRunEvent(w, run); err != nil {
 					return
 				}
-				flusher.Flush()
+			default:
+				if len(event.Lines) > 0 && event.Lines[0].Seq > next {
+					if next, err = s.writeStoredLogLines(r.Context(), w, runID, next); err != nil {
+						return
+					}
+				}
+				for _, line := range event.Lines {
+					if line.Seq < next {
+						continue
+					}
+					if err = writeLogEvent(w, line); err != nil {
+						return
+					}
+					next = line.Seq + 1
+				}
 			}
-
-			if isTerminalStatus(run.Status) {
+			flusher.Flush()
+		case <-pollTicker.C:
+			run, err = s.store.GetRunSummary(r.Context(), runID)
+			if err != nil {
+				s.logStreamError(runID, err)
+				return
+			}
+			if isTerminalStatus(run.Status) && !hub.Active(runID) {
+				finish()
+				return
+			}
+			if next, err = s.writeStoredLogLines(r.Context(), w, runID, next); err != nil {
 				return
 			}
+			flusher.Flush()
 		case <-heartbeatTicker.C:
 			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
 				return
@@ -116,6 +147,54 @@ func (s *Server) handleStreamRun(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) logStreamError(runID int64, err error) {
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, context.Canceled) {
+		return
+	}
+	s.logger.Error("stream get run failed", "run_id", runID, "error", err)
+}
+
+// parseStreamResumeOffset returns the first line to send: the line after the
+// Last-Event-ID sent by a reconnecting EventSource, or ?offset=.
+func parseStreamResumeOffset(r *http.Request) (int64, error) {
+	if lastEventID := strings.TrimSpace(r.Header.Get("Last-Event-ID")); lastEventID != "" {
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || seq < 0 {
+			return 0, errors.New("invalid Last-Event-ID")
+		}
+		return seq + 1, nil
+	}
+	logQuery, err := parseRunLogQuery(r)
+	if err != nil {
+		return 0, err
+	}
+	return logQuery.Offset, nil
+}
+
+// writeStoredLogLines sends persisted lines from offset on and returns the
+// next offset to stream from.
+func (s *Server) writeStoredLogLines(ctx context.Context, w http.ResponseWriter, runID, offset int64) (int64, error) {
+	runLog, err := s.store.GetRunLog(ctx, runID, model.RunLogQuery{Offset: offset})
+	if err != nil {
+		return offset, err
+	}
+	for _, entry := range runLog.Entries {
+		if err := writeLogEvent(w, entry); err != nil {
+			return offset, err
+		}
+	}
+	return runLog.NextOffset, nil
+}
+
+func writeLogEvent(w http.ResponseWriter, entry model.RunLogEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", entry.Seq, body)
+	return err
+}
+
 func writeRunEvent(w http.ResponseWriter, run model.PipelineRun) error {
 	body, err := json.Marshal(run)
 	if err != nil {
@@ -129,5 +208,5 @@ func writeRunEvent(w http.ResponseWriter, run model.PipelineRun) error {
 }
 
 func isTerminalStatus(status string) bool {
-	return status == model.RunStatusSuccess || status == model.RunStatusFailed
+	return status == model.RunStatusSuccess || status == model.RunStatusFailed || status == model.RunStatusSkipped
 }
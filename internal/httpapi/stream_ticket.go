@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"devops-pipeline/internal/model"
+	"devops-pipeline/internal/store"
+)
+
+// streamTicketTTL 只需覆盖从申请票据到浏览器建立 EventSource 连接的时间
+const streamTicketTTL = 30 * time.Second
+
+var (
+	errStreamTicketInvalid = errors.New("stream ticket is invalid or has expired")
+	errStreamTokenInURL    = errors.New("tokens are not accepted in the url, request a stream ticket instead")
+	errStreamAuthRequired  = errors.New("stream ticket required")
+)
+
+type streamTicket struct {
+	userID    int64
+	runID     int64
+	expiresAt time.Time
+}
+
+// streamTickets hands out single-use credentials for the log stream.
+// EventSource cannot set headers, so the stream URL has to carry the
+// credential; a ticket that expires within seconds, works once and only for
+// one run is harmless when the URL ends up in a proxy or access log. Tickets
+// live in memory and are lost on restart, which only forces a new request.
+type streamTickets struct {
+	mu      sync.Mutex
+	tickets map[string]streamTicket
+	now     func() time.Time
+}
+
+func newStreamTickets() *streamTickets {
+	return &streamTickets{tickets: make(map[string]streamTicket), now: time.Now}
+}
+
+// issue returns a new ticket for userID to stream runID.
+func (t *streamTickets) issue(userID, runID int64) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(buf)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	// 票据很少，每次签发时顺带清理即可
+	for key, existing := range t.tickets {
+		if !now.Before(existing.expiresAt) {
+			delete(t.tickets, key)
+		}
+	}
+	t.tickets[ticket] = streamTicket{userID: userID, runID: runID, expiresAt: now.Add(streamTicketTTL)}
+	return ticket, nil
+}
+
+// redeem consumes a ticket and returns the user it was issued to. A ticket
+// presented for another run is consumed as well, so it cannot be retried.
+func (t *streamTickets) redeem(ticket string, runID int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	issued, ok := t.tickets[ticket]
+	if !ok {
+		return 0, false
+	}
+	delete(t.tickets, ticket)
+	if issued.runID != runID || !t.now().Before(issued.expiresAt) {
+		return 0, false
+	}
+	return issued.userID, true
+}
+
+func (s *Server) handleCreateStreamTicket(w http.ResponseWriter, r *http.Request) {
+	runID, err := parseInt64Param(r, "runID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if _, err := s.store.GetRunSummary(r.Context(), runID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	ticket, err := s.streamTickets.issue(GetUserID(r), runID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, model.StreamTicket{Ticket: ticket, ExpiresIn: int(streamTicketTTL.Seconds())})
+}
+
+// authenticateStream redeems the stream ticket in the query string. There is
+// no other way in: tickets are only issued behind the same checks as every
+// other authenticated route, such as a pending password change or two-factor
+// enrollment. Login tokens in the query string are refused with a hint so
+// they do not leak into logs.
+func (s *Server) authenticateStream(r *http.Request, runID int64) error {
+	if r.URL.Query().Has("token") {
+		return errStreamTokenInURL
+	}
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		return errStreamAuthRequired
+	}
+	userID, ok := s.streamTickets.redeem(ticket, runID)
+	if !ok {
+		return errStreamTicketInvalid
+	}
+	user, err := s.store.GetUser(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && user.Disabled) {
+		return errAccountUnavailable
+	}
+	return err
+}
@@ -0,0 +1,294 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/auth"
+	"devops-pipeline/internal/model"
+)
+
+const (
+	totpIssuer        = "Jimuqu DevOps"
+	loginChallengeTTL = 5 * time.Minute
+)
+
+var (
+	errInvalidTwoFactorCode  = errors.New("invalid verification code")
+	errLoginChallengeExpired = errors.New("login has expired, please sign in again")
+	errTwoFactorRequired     = errors.New("two-factor authentication is required and cannot be disabled")
+)
+
+// twoFactorEnrollmentPaths 是必须启用两步验证但尚未启用的账号仍可访问的接口
+var twoFactorEnrollmentPaths = []string{"/api/v1/admin/profile", "/api/v1/admin/password", "/api/v1/admin/2fa/"}
+
+func (s *Server) twoFactorRequired(ctx context.Context) (bool, error) {
+	value, err := s.store.GetSettingValue(ctx, model.SettingTwoFactorRequired)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(value) == "true", nil
+}
+
+// requireTwoFactorEnrolled blocks login sessions of accounts without a
+// second factor while the two_factor_required setting is on, except for the
+// endpoints needed to enrol. API tokens are not affected; they can only be
+// created from a session.
+func (s *Server) requireTwoFactorEnrolled(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiTokenScope(r) != "" || CurrentUser(r).TOTPEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if pathAllowed(r.URL.Path, twoFactorEnrollmentPaths) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		required, err := s.twoFactorRequired(r.Context())
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if required {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "two-factor authentication must be enabled for this account"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleTwoFactorLogin is the second login step. It accepts a TOTP code or
+// one of the account's recovery codes.
+func (s *Server) handleTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var input model.TwoFactorLoginRequest
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	challenge, err := s.jwtManager.ParseLoginChallenge(input.Challenge)
+	if err != nil {
+		s.writeBadRequest(w, errLoginChallengeExpired)
+		return
+	}
+	user, err := s.store.GetUser(r.Context(), challenge.UserID)
+	if err != nil || user.Disabled || !user.TOTPEnabled {
+		s.writeBadRequest(w, errLoginChallengeExpired)
+		return
+	}
+	attempt, wait := s.loginThrottle.begin(r, user.Username)
+	if wait > 0 {
+		writeTooManyLoginAttempts(w, wait)
+		return
+	}
+	usedRecoveryCode, err := s.verifySecondFactor(r.Context(), user.ID, input.Code, true)
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		s.loginFailed(r, attempt, user.Username, user.ID, err.Error())
+		s.writeBadRequest(w, err)
+		return
+	}
+	s.loginThrottle.release(attempt)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	secondFactor := "totp"
+	if usedRecoveryCode {
+		secondFactor = "recovery_code"
+	}
+	response, err := s.sessionResponse(r, user, map[string]string{"method": challenge.Method, "second_factor": secondFactor})
+	if err != nil {
+		s.logger.Error("failed to generate token", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to generate token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// verifySecondFactor checks a TOTP code of an enrolled account and marks it
+// as used. With allowRecovery a recovery code is accepted as well and is
+// consumed; usedRecoveryCode reports which kind matched.
+func (s *Server) verifySecondFactor(ctx context.Context, userID int64, code string, allowRecovery bool) (usedRecoveryCode bool, err error) {
+	totp, err := s.store.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !totp.Enabled {
+		return false, errInvalidTwoFactorCode
+	}
+	if step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now()); ok {
+		recorded, err := s.store.RecordTOTPStep(ctx, userID, step)
+		if err != nil {
+			return false, err
+		}
+		if !recorded {
+			return false, errInvalidTwoFactorCode
+		}
+		return false, nil
+	}
+	if allowRecovery && strings.TrimSpace(code) != "" {
+		used, err := s.store.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(code))
+		if err != nil {
+			return false, err
+		}
+		if used {
+			return true, nil
+		}
+	}
+	return false, errInvalidTwoFactorCode
+}
+
+// handleTwoFactorSetup starts enrolment with a new secret. The secret only
+// takes effect once a code from the authenticator app is confirmed.
+func (s *Server) handleTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.store.SetPendingTOTPSecret(r.Context(), user.ID, secret); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPProvisioningURI(totpIssuer, user.Username, secret),
+	})
+}
+
+func (s *Server) handleEnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input model.TwoFactorCodeInput
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	user := CurrentUser(r)
+	totp, err := s.store.GetUserTOTP(r.Context(), user.ID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if totp.Enabled || totp.Secret == "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "start two-factor setup before enabling it"})
+		return
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, input.Code, time.Now())
+	if !ok {
+		s.writeBadRequest(w, errInvalidTwoFactorCode)
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.store.EnableTOTP(r.Context(), user.ID, step, hashes); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	// 其他会话没有经过第二步验证，全部下线
+	if err := s.endOtherSessions(r, user.ID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "account.2fa_enable", "user", user.ID, user.Username, nil, nil)
+	writeJSON(w, http.StatusOK, model.RecoveryCodes{Codes: codes})
+}
+
+// handleDisableTwoFactor turns the second factor off after confirming a
+// current code, so a stolen session alone cannot remove it.
+func (s *Server) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input model.TwoFactorCodeInput
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	required, err := s.twoFactorRequired(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if required {
+		s.writeBadRequest(w, errTwoFactorRequired)
+		return
+	}
+	user := CurrentUser(r)
+	if _, err := s.verifySecondFactor(r.Context(), user.ID, input.Code, true); err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			s.writeBadRequest(w, err)
+			return
+		}
+		s.writeError(w, err)
+		return
+	}
+	if err := s.store.DisableTOTP(r.Context(), user.ID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.endOtherSessions(r, user.ID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "account.2fa_disable", "user", user.ID, user.Username, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRegenerateRecoveryCodes replaces all recovery codes, for example
+// after most of them were used. It needs a current TOTP code.
+func (s *Server) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var input model.TwoFactorCodeInput
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	user := CurrentUser(r)
+	if _, err := s.verifySecondFactor(r.Context(), user.ID, input.Code, false); err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			s.writeBadRequest(w, err)
+			return
+		}
+		s.writeError(w, err)
+		return
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.store.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "account.2fa_recovery_codes", "user", user.ID, user.Username, nil, nil)
+	writeJSON(w, http.StatusOK, model.RecoveryCodes{Codes: codes})
+}
+
+// handleResetUserTwoFactor lets an admin remove the second factor of an
+// account that lost its authenticator and recovery codes.
+func (s *Server) handleResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseInt64Param(r, "userID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	target, err := s.store.GetUser(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.store.DisableTOTP(r.Context(), userID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.endOtherSessions(r, userID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "user.2fa_reset", "user", userID, target.Username, map[string]bool{"totp_enabled": target.TOTPEnabled}, map[string]bool{"totp_enabled": false})
+	w.WriteHeader(http.StatusNoContent)
+}
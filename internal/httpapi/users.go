@@ -0,0 +1,271 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"devops-pipeline/internal/config"
+	"devops-pipeline/internal/model"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.ListUsers(r.Context())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseInt64Param(r, "userID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	user, err := s.store.GetUser(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var input model.UserCreateInput
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	input.Username = strings.TrimSpace(input.Username)
+	if input.Username == "" {
+		s.writeBadRequest(w, errors.New("username is required"))
+		return
+	}
+	if err := validateRole(input.Role); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if err := validatePassword(input.Password); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	user, err := s.store.CreateUser(r.Context(), input.Username, string(passwordHash), input.Role)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "user.create", "user", user.ID, user.Username, nil, user)
+	writeJSON(w, http.StatusCreated, user)
+}
+
+func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseInt64Param(r, "userID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	var input model.UserUpdateInput
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if err := validateRole(input.Role); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+
+	var passwordHash string
+	if input.Password != "" {
+		if err := validatePassword(input.Password); err != nil {
+			s.writeBadRequest(w, err)
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		passwordHash = string(hash)
+	}
+
+	before, err := s.store.GetUser(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	relink := input.AuthSource != "" && input.AuthSource != before.AuthSource
+	if relink {
+		if err := validateAuthSourceChange(input, userID == GetUserID(r)); err != nil {
+			s.writeBadRequest(w, err)
+			return
+		}
+	}
+	user, err := s.store.UpdateUser(r.Context(), userID, input.Role, input.Disabled, passwordHash)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if relink {
+		if err := s.store.LinkUser(r.Context(), userID, input.AuthSource, ""); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if user, err = s.store.GetUser(r.Context(), userID); err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
+	// 重置密码或停用账号后，已登录的会话立即失效
+	if passwordHash != "" || (user.Disabled && !before.Disabled) {
+		if err := s.endOtherSessions(r, userID); err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
+	s.audit(r, "user.update", "user", user.ID, user.Username, before, user)
+	writeJSON(w, http.StatusOK, user)
+}
+
+// validateAuthSourceChange checks an administrator handing an account to
+// another source. Accounts handed back to local need a password, since the
+// external ones only have a random hash.
+func validateAuthSourceChange(input model.UserUpdateInput, self bool) error {
+	if !model.ValidAuthSource(input.AuthSource) {
+		return fmt.Errorf("unknown auth source %q", input.AuthSource)
+	}
+	if self {
+		return errors.New("cannot change the source of the account you are signed in with")
+	}
+	if input.AuthSource == model.AuthSourceLocal && input.Password == "" {
+		return errors.New("a password is required to make the account a local account")
+	}
+	return nil
+}
+
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseInt64Param(r, "userID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if userID == GetUserID(r) {
+		s.writeBadRequest(w, errors.New("cannot delete the account you are signed in with"))
+		return
+	}
+	before, err := s.store.GetUser(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.store.DeleteUser(r.Context(), userID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "user.delete", "user", userID, before.Username, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListUserPermissions(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseInt64Param(r, "userID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if _, err := s.store.GetUser(r.Context(), userID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	permissions, err := s.store.ListProjectPermissions(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, permissions)
+}
+
+func (s *Server) handleSetUserPermissions(w http.ResponseWriter, r *http.Request) {
+	userID, err := parseInt64Param(r, "userID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	var input model.ProjectPermissionsInput
+	if err := decodeJSON(r.Body, &input); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	if err := validateProjectPermissions(input.Permissions); err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+	for _, permission := range input.Permissions {
+		if _, err := s.store.GetProject(r.Context(), permission.ProjectID); err != nil {
+			s.writeError(w, err)
+			return
+		}
+	}
+
+	before, err := s.store.ListProjectPermissions(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.store.SetProjectPermissions(r.Context(), userID, input.Permissions); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	permissions, err := s.store.ListProjectPermissions(r.Context(), userID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.audit(r, "user.permissions", "user", userID, "", map[string]any{"permissions": before}, map[string]any{"permissions": permissions})
+	writeJSON(w, http.StatusOK, permissions)
+}
+
+func validateRole(role string) error {
+	if !model.ValidRole(role) {
+		return fmt.Errorf("role must be one of %s, %s, %s, %s", model.RoleAdmin, model.RoleMaintainer, model.RoleDeployer, model.RoleViewer)
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < 6 {
+		return errors.New("password must be at least 6 characters")
+	}
+	if password == config.DefaultAdminPassword {
+		return errors.New("the default password cannot be used")
+	}
+	return nil
+}
+
+// validateProjectPermissions checks a replacement permission set. Admin is a
+// global role only, a project grant tops out at maintainer.
+func validateProjectPermissions(permissions []model.ProjectPermission) error {
+	seen := make(map[int64]bool, len(permissions))
+	for _, permission := range permissions {
+		if permission.ProjectID <= 0 {
+			return errors.New("project_id is required")
+		}
+		if seen[permission.ProjectID] {
+			return fmt.Errorf("project %d is listed more than once", permission.ProjectID)
+		}
+		seen[permission.ProjectID] = true
+		if !model.ValidRole(permission.Role) || permission.Role == model.RoleAdmin {
+			return fmt.Errorf("project role must be one of %s, %s, %s", model.RoleMaintainer, model.RoleDeployer, model.RoleViewer)
+		}
+	}
+	return nil
+}
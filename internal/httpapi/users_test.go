@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"devops-pipeline/internal/model"
+)
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     int
+	}{
+		{role: model.RoleAdmin, required: model.RoleAdmin, want: http.StatusNoContent},
+		{role: model.RoleMaintainer, required: model.RoleAdmin, want: http.StatusForbidden},
+		{role: model.RoleMaintainer, required: model.RoleDeployer, want: http.StatusNoContent},
+		{role: model.RoleViewer, required: model.RoleDeployer, want: http.StatusForbidden},
+		{role: "", required: model.RoleViewer, want: http.StatusForbidden},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), UserKey, model.User{ID: 1, Role: tt.role}))
+		rec := httptest.NewRecorder()
+		RequireRole(tt.required)(next).ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Fatalf("role %q requiring %q: got status %d want %d", tt.role, tt.required, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestHigherRoleCombinesGlobalAndProjectGrant(t *testing.T) {
+	if got := model.HigherRole(model.RoleViewer, model.RoleDeployer); got != model.RoleDeployer {
+		t.Fatalf("expected project grant to raise viewer, got %q", got)
+	}
+	if got := model.HigherRole(model.RoleMaintainer, model.RoleViewer); got != model.RoleMaintainer {
+		t.Fatalf("expected project grant not to lower maintainer, got %q", got)
+	}
+	if got := model.HigherRole(model.RoleViewer, ""); got != model.RoleViewer {
+		t.Fatalf("expected missing grant to keep the global role, got %q", got)
+	}
+}
+
+func TestValidateProjectPermissions(t *testing.T) {
+	valid := []model.ProjectPermission{
+		{ProjectID: 1, Role: model.RoleDeployer},
+		{ProjectID: 2, Role: model.RoleMaintainer},
+	}
+	if err := validateProjectPermissions(valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	invalid := map[string][]model.ProjectPermission{
+		"admin grant":  {{ProjectID: 1, Role: model.RoleAdmin}},
+		"unknown role": {{ProjectID: 1, Role: "owner"}},
+		"missing id":   {{Role: model.RoleViewer}},
+		"duplicate":    {{ProjectID: 1, Role: model.RoleViewer}, {ProjectID: 1, Role: model.RoleDeployer}},
+	}
+	for name, permissions := range invalid {
+		if err := validateProjectPermissions(permissions); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestExternalLoginDoesNotClaimOtherAccounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   model.User
+		source string
+		want   bool
+	}{
+		{name: "local password account", user: model.User{AuthSource: model.AuthSourceLocal}, source: model.AuthSourceOIDC, want: false},
+		{name: "handed to oidc", user: model.User{AuthSource: model.AuthSourceOIDC}, source: model.AuthSourceOIDC, want: true},
+		{name: "linked to another subject", user: model.User{AuthSource: model.AuthSourceOIDC, ExternalID: "other"}, source: model.AuthSourceOIDC, want: false},
+		{name: "ldap account", user: model.User{AuthSource: model.AuthSourceLDAP}, source: model.AuthSourceOIDC, want: false},
+		{name: "local account for directory login", user: model.User{AuthSource: model.AuthSourceLocal}, source: model.AuthSourceLDAP, want: false},
+		{name: "handed to ldap", user: model.User{AuthSource: model.AuthSourceLDAP}, source: model.AuthSourceLDAP, want: true},
+	}
+	for _, tt := range tests {
+		if got := externalUserClaimable(tt.user, tt.source); got != tt.want {
+			t.Fatalf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAuthSourceChange(t *testing.T) {
+	if err := validateAuthSourceChange(model.UserUpdateInput{AuthSource: model.AuthSourceOIDC}, false); err != nil {
+		t.Fatalf("expected handing an account to oidc to be allowed, got %v", err)
+	}
+	if err := validateAuthSourceChange(model.UserUpdateInput{AuthSource: "saml"}, false); err == nil {
+		t.Fatal("expected an unknown source to be rejected")
+	}
+	if err := validateAuthSourceChange(model.UserUpdateInput{AuthSource: model.AuthSourceOIDC}, true); err == nil {
+		t.Fatal("expected changing the own account to be rejected")
+	}
+	if err := validateAuthSourceChange(model.UserUpdateInput{AuthSource: model.AuthSourceLocal}, false); err == nil {
+		t.Fatal("expected a local account to require a password")
+	}
+}
@@ -0,0 +1,624 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"devops-pipeline/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type webhookCommit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+type webhookPayload struct {
+	Ref    string `json:"ref"`
+	Branch string `json:"branch"`
+	After  string `json:"after"`
+	Push   struct {
+		Changes []struct {
+			New struct {
+				Name string `json:"name"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+	CheckoutSHA string          `json:"checkout_sha"`
+	HeadCommit  *webhookCommit  `json:"head_commit"`
+	Commits     []webhookCommit `json:"commits"`
+	// GitLab 与 Gitea 在推送提交过多时会截断 commits，并通过这两个字段给出真实数量
+	TotalCommitsCount int `json:"total_commits_count"`
+	TotalCommits      int `json:"total_commits"`
+}
+
+// pullRequestPayload covers GitHub/Gitea pull_request events and GitLab
+// merge request hooks.
+type pullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int64  `json:"number"`
+	PullRequest struct {
+		Number int64 `json:"number"`
+		Base   struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	ObjectKind       string `json:"object_kind"`
+	ObjectAttributes struct {
+		IID          int64  `json:"iid"`
+		Action       string `json:"action"`
+		TargetBranch string `json:"target_branch"`
+		OldRev       string `json:"oldrev"`
+	} `json:"object_attributes"`
+}
+
+type webhookPullRequest struct {
+	Number     int64
+	Action     string
+	BaseBranch string
+	// HeadRef is the provider ref that always points at the PR head, so forks
+	// can be built without access to the source repository.
+	HeadRef   string
+	Buildable bool
+}
+
+// webhookPush is the normalized view of a push event shared by all providers.
+type webhookPush struct {
+	Branch     string
+	TriggerRef string
+	// ChangedFiles is only meaningful when FilesKnown is true; payloads without
+	// file lists (or with truncated commit lists) must never be filtered out.
+	ChangedFiles []string
+	FilesKnown   bool
+	// HeadCommitMessage is empty when the provider does not send commit
+	// details; the executor then checks skip markers after cloning.
+	HeadCommitMessage string
+}
+
+const (
+	// 超过该大小的请求体只保存前缀，且不能重放
+	maxStoredWebhookBody = 64 << 10
+	redactedHeaderValue  = "[redacted]"
+)
+
+// webhookOutcome is the result of running a delivery through the trigger
+// path; it carries both the HTTP response and what gets written to the log.
+type webhookOutcome struct {
+	StatusCode int
+	Response   any
+	Decision   string
+	Reason     string
+	ProjectID  *int64
+	RunID      *int64
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		s.writeBadRequest(w, fmt.Errorf("read webhook body: %w", err))
+		return
+	}
+
+	outcome := s.processWebhook(r.Context(), token, r.Header, body)
+	s.recordWebhookDelivery(r.Context(), r.Header, body, outcome, nil)
+	writeJSON(w, outcome.StatusCode, outcome.Response)
+}
+
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	filter := model.WebhookDeliveryFilter{
+		Decision: strings.TrimSpace(r.URL.Query().Get("decision")),
+		Limit:    parseRunListLimit(r, 50),
+	}
+	if value := r.URL.Query().Get("project_id"); value != "" {
+		projectID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			s.writeBadRequest(w, errors.New("invalid project_id"))
+			return
+		}
+		filter.ProjectID = projectID
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			s.writeBadRequest(w, errors.New("invalid offset"))
+			return
+		}
+		filter.Offset = offset
+	}
+
+	deliveries, err := s.store.ListWebhookDeliveries(r.Context(), filter)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+func (s *Server) handleGetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := parseInt64Param(r, "deliveryID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+
+	delivery, err := s.store.GetWebhookDelivery(r.Context(), deliveryID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// handleReplayWebhookDelivery runs a stored delivery through the same trigger
+// path again, using the project's current webhook token.
+func (s *Server) handleReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := parseInt64Param(r, "deliveryID")
+	if err != nil {
+		s.writeBadRequest(w, err)
+		return
+	}
+
+	delivery, err := s.store.GetWebhookDelivery(r.Context(), deliveryID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if delivery.BodyTruncated {
+		s.writeBadRequest(w, errors.New("webhook delivery body was truncated and cannot be replayed"))
+		return
+	}
+	if delivery.ProjectID == nil {
+		s.writeBadRequest(w, errors.New("webhook delivery is not linked to a project"))
+		return
+	}
+
+	project, err := s.store.GetProject(r.Context(), *delivery.ProjectID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	headers := http.Header(delivery.Headers).Clone()
+	body := []byte(delivery.Body)
+	outcome := s.processWebhook(r.Context(), project.WebhookToken, headers, body)
+	replay := s.recordWebhookDelivery(r.Context(), headers, body, outcome, &delivery.ID)
+	s.audit(r, "webhook_delivery.replay", "webhook_delivery", delivery.ID, project.Name, nil, map[string]any{"status_code": outcome.StatusCode})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"delivery":    replay,
+		"status_code": outcome.StatusCode,
+		"response":    outcome.Response,
+	})
+}
+
+func (s *Server) processWebhook(ctx context.Context, token string, headers http.Header, body []byte) webhookOutcome {
+	if strings.TrimSpace(token) == "" {
+		return rejectedWebhook(http.StatusBadRequest, nil, "missing webhook token")
+	}
+
+	project, err := s.store.GetProjectByWebhookToken(ctx, token)
+	if err != nil {
+		return s.failedWebhook(nil, err)
+	}
+	projectID := &project.ID
+
+	pullRequest, isPullRequest, err := parseWebhookPullRequest(body, headers)
+	if err != nil {
+		return rejectedWebhook(http.StatusBadRequest, projectID, err.Error())
+	}
+	if isPullRequest {
+		return s.processPullRequestWebhook(ctx, project, pullRequest)
+	}
+
+	push, err := parseWebhookPush(body, headers)
+	if err != nil {
+		return rejectedWebhook(http.StatusBadRequest, projectID, err.Error())
+	}
+	if push.Branch != "" && push.Branch != project.Branch {
+		return rejectedWebhook(http.StatusBadRequest, projectID, fmt.Sprintf("branch mismatch: expected %s got %s", project.Branch, push.Branch))
+	}
+	triggerRef := push.TriggerRef
+	if triggerRef == "" {
+		triggerRef = push.Branch
+	}
+
+	if push.FilesKnown && !pathFiltersAllow(project.PathIncludes, project.PathExcludes, push.ChangedFiles) {
+		reason := "no changed paths match the project path filters"
+		return webhookOutcome{
+			StatusCode: http.StatusOK,
+			Response:   map[string]string{"status": "skipped", "reason": reason},
+			Decision:   model.WebhookDecisionSkipped,
+			Reason:     reason,
+			ProjectID:  projectID,
+		}
+	}
+
+	marker, err := s.executor.MatchSkipMarker(ctx, project, push.HeadCommitMessage)
+	if err != nil {
+		return s.failedWebhook(projectID, err)
+	}
+	if marker != "" {
+		reason := fmt.Sprintf("head commit message contains skip marker %q", marker)
+		run, err := s.executor.RecordSkippedRun(ctx, project.ID, model.TriggerTypeWebhook, triggerRef, reason)
+		if err != nil {
+			return s.failedWebhook(projectID, err)
+		}
+		return webhookOutcome{
+			StatusCode: http.StatusOK,
+			Response: map[string]any{
+				"status": "skipped",
+				"reason": reason,
+				"run":    run,
+			},
+			Decision:  model.WebhookDecisionSkipped,
+			Reason:    reason,
+			ProjectID: projectID,
+			RunID:     &run.ID,
+		}
+	}
+
+	run, err := s.executor.Trigger(ctx, project.ID, model.TriggerTypeWebhook, triggerRef)
+	if err != nil {
+		return s.failedWebhook(projectID, err)
+	}
+	return webhookOutcome{
+		StatusCode: http.StatusAccepted,
+		Response:   run,
+		Decision:   model.WebhookDecisionAccepted,
+		Reason:     fmt.Sprintf("run created for %s", triggerRef),
+		ProjectID:  projectID,
+		RunID:      &run.ID,
+	}
+}
+
+func (s *Server) processPullRequestWebhook(ctx context.Context, project model.Project, pullRequest webhookPullRequest) webhookOutcome {
+	skipped := func(reason string) webhookOutcome {
+		return webhookOutcome{
+			StatusCode: http.StatusOK,
+			Response:   map[string]string{"status": "skipped", "reason": reason},
+			Decision:   model.WebhookDecisionSkipped,
+			Reason:     reason,
+			ProjectID:  &project.ID,
+		}
+	}
+
+	if !project.PRBuildsEnabled {
+		return skipped("pull request builds are disabled for this project")
+	}
+	if !pullRequest.Buildable {
+		return skipped(fmt.Sprintf("pull request action %q does not trigger a build", pullRequest.Action))
+	}
+	if pullRequest.BaseBranch != "" && pullRequest.BaseBranch != project.Branch {
+		return skipped(fmt.Sprintf("pull request targets %s, project builds %s", pullRequest.BaseBranch, project.Branch))
+	}
+
+	run, err := s.executor.TriggerPullRequest(ctx, project.ID, pullRequest.Number, pullRequest.HeadRef)
+	if err != nil {
+		return s.failedWebhook(&project.ID, err)
+	}
+	return webhookOutcome{
+		StatusCode: http.StatusAccepted,
+		Response:   run,
+		Decision:   model.WebhookDecisionAccepted,
+		Reason:     fmt.Sprintf("pull request #%d build created", pullRequest.Number),
+		ProjectID:  &project.ID,
+		RunID:      &run.ID,
+	}
+}
+
+func rejectedWebhook(statusCode int, projectID *int64, reason string) webhookOutcome {
+	return webhookOutcome{
+		StatusCode: statusCode,
+		Response:   map[string]string{"error": reason},
+		Decision:   model.WebhookDecisionRejected,
+		Reason:     reason,
+		ProjectID:  projectID,
+	}
+}
+
+// failedWebhook maps store and executor errors the same way writeError does;
+// client side errors such as an unknown token count as rejections.
+func (s *Server) failedWebhook(projectID *int64, err error) webhookOutcome {
+	statusCode := errorStatusCode(err)
+	if statusCode < http.StatusInternalServerError {
+		return rejectedWebhook(statusCode, projectID, err.Error())
+	}
+	s.logger.Error("webhook failed", "error", err)
+	return webhookOutcome{
+		StatusCode: statusCode,
+		Response:   map[string]string{"error": err.Error()},
+		Decision:   model.WebhookDecisionError,
+		Reason:     err.Error(),
+		ProjectID:  projectID,
+	}
+}
+
+func (s *Server) recordWebhookDelivery(ctx context.Context, headers http.Header, body []byte, outcome webhookOutcome, replayOfID *int64) *model.WebhookDelivery {
+	storedBody := body
+	if len(storedBody) > maxStoredWebhookBody {
+		storedBody = storedBody[:maxStoredWebhookBody]
+	}
+
+	delivery, err := s.store.CreateWebhookDelivery(ctx, model.WebhookDeliveryCreateInput{
+		ProjectID:     outcome.ProjectID,
+		Headers:       redactWebhookHeaders(headers),
+		Body:          string(storedBody),
+		BodySize:      int64(len(body)),
+		BodyTruncated: len(body) > maxStoredWebhookBody,
+		Decision:      outcome.Decision,
+		Reason:        outcome.Reason,
+		StatusCode:    outcome.StatusCode,
+		RunID:         outcome.RunID,
+		ReplayOfID:    replayOfID,
+	})
+	if err != nil {
+		s.logger.Error("record webhook delivery failed", "error", err)
+		return nil
+	}
+	return &delivery
+}
+
+// redactWebhookHeaders drops credentials and signatures before a delivery is
+// stored. Replays skip signature checks anyway since they go through the token.
+func redactWebhookHeaders(headers http.Header) map[string][]string {
+	redacted := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		if isSensitiveWebhookHeader(canonical) {
+			redacted[canonical] = []string{redactedHeaderValue}
+			continue
+		}
+		redacted[canonical] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+func isSensitiveWebhookHeader(name string) bool {
+	lowered := strings.ToLower(name)
+	switch lowered {
+	case "authorization", "proxy-authorization", "cookie", "x-gitlab-token", "x-gitee-token":
+		return true
+	}
+	return strings.Contains(lowered, "signature") || strings.Contains(lowered, "secret")
+}
+
+// parseWebhookPullRequest recognises PR/MR events by their event header or,
+// for GitLab, the object_kind field. The bool result is false for pushes.
+func parseWebhookPullRequest(body []byte, headers http.Header) (webhookPullRequest, bool, error) {
+	event := ""
+	for _, name := range []string{"X-GitHub-Event", "X-Gitea-Event", "X-Gogs-Event", "X-Gitlab-Event"} {
+		if value := strings.TrimSpace(headers.Get(name)); value != "" {
+			event = value
+			break
+		}
+	}
+	if len(body) == 0 || (event != "pull_request" && event != "Merge Request Hook" && event != "") {
+		return webhookPullRequest{}, false, nil
+	}
+
+	var payload pullRequestPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return webhookPullRequest{}, false, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	switch {
+	case event == "pull_request":
+		number := payload.Number
+		if number == 0 {
+			number = payload.PullRequest.Number
+		}
+		if number <= 0 {
+			return webhookPullRequest{}, false, errors.New("pull request event without number")
+		}
+		switch payload.Action {
+		case "opened", "reopened", "synchronize", "synchronized":
+		default:
+			return webhookPullRequest{Number: number, Action: payload.Action}, true, nil
+		}
+		return webhookPullRequest{
+			Number:     number,
+			Action:     payload.Action,
+			BaseBranch: normalizeRef(payload.PullRequest.Base.Ref),
+			HeadRef:    fmt.Sprintf("refs/pull/%d/head", number),
+			Buildable:  true,
+		}, true, nil
+	case event == "Merge Request Hook" || payload.ObjectKind == "merge_request":
+		attributes := payload.ObjectAttributes
+		if attributes.IID <= 0 {
+			return webhookPullRequest{}, false, errors.New("merge request event without iid")
+		}
+		// update 事件也会因标题、标签等变化触发，只有带 oldrev 的才是新的提交
+		buildable := attributes.Action == "open" || attributes.Action == "reopen" ||
+			(attributes.Action == "update" && attributes.OldRev != "")
+		return webhookPullRequest{
+			Number:     attributes.IID,
+			Action:     attributes.Action,
+			BaseBranch: attributes.TargetBranch,
+			HeadRef:    fmt.Sprintf("refs/merge-requests/%d/head", attributes.IID),
+			Buildable:  buildable,
+		}, true, nil
+	default:
+		return webhookPullRequest{}, false, nil
+	}
+}
+
+func parseWebhookPush(body []byte, headers http.Header) (webhookPush, error) {
+	if len(body) == 0 {
+		ref := headers.Get("X-Git-Ref")
+		return webhookPush{Branch: normalizeRef(ref), TriggerRef: ref}, nil
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return webhookPush{}, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	var push webhookPush
+	switch {
+	case payload.Ref != "":
+		push.Branch, push.TriggerRef = normalizeRef(payload.Ref), payload.Ref
+	case payload.Branch != "":
+		push.Branch, push.TriggerRef = strings.TrimSpace(payload.Branch), payload.Branch
+	case len(payload.Push.Changes) > 0 && payload.Push.Changes[0].New.Name != "":
+		name := payload.Push.Changes[0].New.Name
+		push.Branch, push.TriggerRef = name, name
+	case headers.Get("X-Git-Ref") != "":
+		ref := headers.Get("X-Git-Ref")
+		push.Branch, push.TriggerRef = normalizeRef(ref), ref
+	}
+
+	push.ChangedFiles, push.FilesKnown = payload.changedFiles()
+	if commit := payload.headCommit(); commit != nil {
+		push.HeadCommitMessage = commit.Message
+	}
+	return push, nil
+}
+
+// headCommit picks the commit the push points at: GitHub and Gitea send it as
+// head_commit, GitLab only lists commits so match after/checkout_sha instead.
+func (p webhookPayload) headCommit() *webhookCommit {
+	if p.HeadCommit != nil {
+		return p.HeadCommit
+	}
+	for _, sha := range []string{p.CheckoutSHA, p.After} {
+		if sha == "" {
+			continue
+		}
+		for i := range p.Commits {
+			if p.Commits[i].ID == sha {
+				return &p.Commits[i]
+			}
+		}
+	}
+	if len(p.Commits) > 0 {
+		return &p.Commits[len(p.Commits)-1]
+	}
+	return nil
+}
+
+// changedFiles collects the files touched by every commit in the push. The
+// second result reports whether the list is complete enough to filter on.
+func (p webhookPayload) changedFiles() ([]string, bool) {
+	commits := p.Commits
+	if len(commits) == 0 && p.HeadCommit != nil {
+		commits = []webhookCommit{*p.HeadCommit}
+	}
+	if len(commits) == 0 {
+		return nil, false
+	}
+	if p.TotalCommitsCount > len(commits) || p.TotalCommits > len(commits) {
+		return nil, false
+	}
+
+	seen := make(map[string]struct{})
+	var files []string
+	for _, commit := range commits {
+		for _, list := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+			for _, file := range list {
+				file = strings.TrimPrefix(strings.TrimSpace(file), "/")
+				if file == "" {
+					continue
+				}
+				if _, exists := seen[file]; exists {
+					continue
+				}
+				seen[file] = struct{}{}
+				files = append(files, file)
+			}
+		}
+	}
+	// 没有任何文件信息（例如只包含合并提交）时不做过滤
+	if len(files) == 0 {
+		return nil, false
+	}
+	return files, true
+}
+
+func normalizeRef(ref string) string {
+	ref = strings.TrimSpace(ref)
+	ref = strings.TrimPrefix(ref, "refs/heads/")
+	return ref
+}
+
+// pathFiltersAllow reports whether at least one changed file is selected by
+// the include globs (all files when empty) and not rejected by the excludes.
+func pathFiltersAllow(includes, excludes, files []string) bool {
+	if len(includes) == 0 && len(excludes) == 0 {
+		return true
+	}
+	for _, file := range files {
+		if len(includes) > 0 && !matchAnyPathGlob(includes, file) {
+			continue
+		}
+		if matchAnyPathGlob(excludes, file) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func matchAnyPathGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchPathGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathGlob matches a slash separated path against a glob where each
+// segment follows path.Match and "**" spans any number of segments. A pattern
+// ending in "/" matches everything below that directory.
+func matchPathGlob(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchPathSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchPathSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			rest := patterns[1:]
+			for i := 0; i <= len(names); i++ {
+				if matchPathSegments(rest, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		matched, err := path.Match(patterns[0], names[0])
+		if err != nil || !matched {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+func validatePathFilters(field string, patterns []string) error {
+	for _, pattern := range model.NormalizePathFilters(patterns) {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid %s pattern %q", field, pattern)
+			}
+		}
+	}
+	return nil
+}
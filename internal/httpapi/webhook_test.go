@@ -0,0 +1,258 @@
+package httpapi
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseWebhookPushGitHubCollectsChangedFiles(t *testing.T) {
+	body := []byte(`{
+		"ref": "refs/heads/main",
+		"commits": [
+			{"id": "a1", "added": ["services/api/main.go"], "removed": [], "modified": ["README.md"]},
+			{"id": "b2", "added": [], "removed": ["docs/old.md"], "modified": ["README.md"]}
+		],
+		"head_commit": {"id": "b2", "added": [], "removed": ["docs/old.md"], "modified": ["README.md"]}
+	}`)
+
+	push, err := parseWebhookPush(body, http.Header{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if push.Branch != "main" || push.TriggerRef != "refs/heads/main" {
+		t.Fatalf("unexpected branch: got %q ref %q", push.Branch, push.TriggerRef)
+	}
+	if !push.FilesKnown {
+		t.Fatalf("expected changed files to be known")
+	}
+	want := []string{"services/api/main.go", "README.md", "docs/old.md"}
+	if !reflect.DeepEqual(push.ChangedFiles, want) {
+		t.Fatalf("unexpected changed files: got %q want %q", push.ChangedFiles, want)
+	}
+}
+
+func TestParseWebhookPushTruncatedGitLabCommitsAreNotFiltered(t *testing.T) {
+	body := []byte(`{
+		"ref": "refs/heads/main",
+		"total_commits_count": 42,
+		"commits": [{"id": "a1", "added": [], "removed": [], "modified": ["docs/index.md"]}]
+	}`)
+
+	push, err := parseWebhookPush(body, http.Header{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if push.FilesKnown {
+		t.Fatalf("expected truncated commit list to disable path filtering, got %q", push.ChangedFiles)
+	}
+}
+
+func TestParseWebhookPushWithoutFileListsIsNotFiltered(t *testing.T) {
+	body := []byte(`{"push": {"changes": [{"new": {"name": "main"}}]}}`)
+
+	push, err := parseWebhookPush(body, http.Header{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if push.Branch != "main" {
+		t.Fatalf("unexpected branch: got %q", push.Branch)
+	}
+	if push.FilesKnown {
+		t.Fatalf("did not expect changed files without commit lists")
+	}
+}
+
+func TestMatchPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "services/api/**", name: "services/api/main.go", want: true},
+		{pattern: "services/api/**", name: "services/api", want: true},
+		{pattern: "services/api/", name: "services/api/internal/x.go", want: true},
+		{pattern: "services/api/**", name: "services/web/main.go", want: false},
+		{pattern: "**/*.md", name: "README.md", want: true},
+		{pattern: "**/*.md", name: "docs/guide/intro.md", want: true},
+		{pattern: "*.md", name: "docs/intro.md", want: false},
+		{pattern: "go.mod", name: "go.mod", want: true},
+		{pattern: "cmd/*/main.go", name: "cmd/server/main.go", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := matchPathGlob(tt.pattern, tt.name); got != tt.want {
+			t.Fatalf("matchPathGlob(%q, %q) = %v want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPathFiltersAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		includes []string
+		excludes []string
+		files    []string
+		want     bool
+	}{
+		{name: "no filters", files: []string{"docs/a.md"}, want: true},
+		{name: "include matches", includes: []string{"services/api/**"}, files: []string{"docs/a.md", "services/api/x.go"}, want: true},
+		{name: "include misses", includes: []string{"services/api/**"}, files: []string{"services/web/x.go"}, want: false},
+		{name: "only excluded files", excludes: []string{"**/*.md"}, files: []string{"README.md", "docs/a.md"}, want: false},
+		{name: "exclude leaves other files", excludes: []string{"**/*.md"}, files: []string{"README.md", "main.go"}, want: true},
+		{name: "include and exclude", includes: []string{"services/api/**"}, excludes: []string{"**/*_test.go"}, files: []string{"services/api/x_test.go"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathFiltersAllow(tt.includes, tt.excludes, tt.files); got != tt.want {
+				t.Fatalf("pathFiltersAllow() = %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWebhookPushHeadCommitMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "github head_commit",
+			body: `{"ref": "refs/heads/main", "head_commit": {"id": "b2", "message": "docs: typo [skip ci]"}}`,
+			want: "docs: typo [skip ci]",
+		},
+		{
+			name: "gitlab checkout_sha",
+			body: `{"ref": "refs/heads/main", "checkout_sha": "a1", "commits": [{"id": "a1", "message": "feat: api"}, {"id": "b2", "message": "older"}]}`,
+			want: "feat: api",
+		},
+		{
+			name: "no commit details",
+			body: `{"ref": "refs/heads/main"}`,
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			push, err := parseWebhookPush([]byte(tt.body), http.Header{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if push.HeadCommitMessage != tt.want {
+				t.Fatalf("unexpected head commit message: got %q want %q", push.HeadCommitMessage, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactWebhookHeaders(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("X-GitHub-Event", "push")
+	headers.Set("X-Hub-Signature-256", "sha256=abc")
+	headers.Set("X-Gitlab-Token", "secret-token")
+	headers.Set("Authorization", "Bearer abc")
+
+	redacted := redactWebhookHeaders(headers)
+
+	if got := redacted["X-Github-Event"]; len(got) != 1 || got[0] != "push" {
+		t.Fatalf("expected event header to be kept, got %q", got)
+	}
+	for _, name := range []string{"X-Hub-Signature-256", "X-Gitlab-Token", "Authorization"} {
+		if got := redacted[name]; len(got) != 1 || got[0] != redactedHeaderValue {
+			t.Fatalf("expected %s to be redacted, got %q", name, got)
+		}
+	}
+}
+
+func TestParseWebhookPullRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     string
+		value     string
+		body      string
+		wantPR    bool
+		want      webhookPullRequest
+		wantError bool
+	}{
+		{
+			name:   "github opened",
+			event:  "X-GitHub-Event",
+			value:  "pull_request",
+			body:   `{"action": "opened", "number": 12, "pull_request": {"number": 12, "base": {"ref": "main"}}}`,
+			wantPR: true,
+			want:   webhookPullRequest{Number: 12, Action: "opened", BaseBranch: "main", HeadRef: "refs/pull/12/head", Buildable: true},
+		},
+		{
+			name:   "gitea synchronized",
+			event:  "X-Gitea-Event",
+			value:  "pull_request",
+			body:   `{"action": "synchronized", "number": 3, "pull_request": {"number": 3, "base": {"ref": "main"}}}`,
+			wantPR: true,
+			want:   webhookPullRequest{Number: 3, Action: "synchronized", BaseBranch: "main", HeadRef: "refs/pull/3/head", Buildable: true},
+		},
+		{
+			name:   "github closed is not buildable",
+			event:  "X-GitHub-Event",
+			value:  "pull_request",
+			body:   `{"action": "closed", "number": 12}`,
+			wantPR: true,
+			want:   webhookPullRequest{Number: 12, Action: "closed"},
+		},
+		{
+			name:   "gitlab update with new commits",
+			event:  "X-Gitlab-Event",
+			value:  "Merge Request Hook",
+			body:   `{"object_kind": "merge_request", "object_attributes": {"iid": 7, "action": "update", "target_branch": "main", "oldrev": "abc"}}`,
+			wantPR: true,
+			want:   webhookPullRequest{Number: 7, Action: "update", BaseBranch: "main", HeadRef: "refs/merge-requests/7/head", Buildable: true},
+		},
+		{
+			name:   "gitlab update without new commits",
+			event:  "X-Gitlab-Event",
+			value:  "Merge Request Hook",
+			body:   `{"object_kind": "merge_request", "object_attributes": {"iid": 7, "action": "update", "target_branch": "main"}}`,
+			wantPR: true,
+			want:   webhookPullRequest{Number: 7, Action: "update", BaseBranch: "main", HeadRef: "refs/merge-requests/7/head"},
+		},
+		{
+			name:  "github push",
+			event: "X-GitHub-Event",
+			value: "push",
+			body:  `{"ref": "refs/heads/main"}`,
+		},
+		{
+			name:      "pull request without number",
+			event:     "X-GitHub-Event",
+			value:     "pull_request",
+			body:      `{"action": "opened"}`,
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := http.Header{}
+			headers.Set(tt.event, tt.value)
+
+			got, isPullRequest, err := parseWebhookPullRequest([]byte(tt.body), headers)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if isPullRequest != tt.wantPR {
+				t.Fatalf("unexpected pull request detection: got %v want %v", isPullRequest, tt.wantPR)
+			}
+			if got != tt.want {
+				t.Fatalf("unexpected pull request: got %+v want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Package logstream fans out run log lines from the executor to live
+// subscribers such as the SSE endpoint.
+package logstream
+
+import (
+	"sync"
+
+	"devops-pipeline/internal/model"
+)
+
+const subscriberBuffer = 256
+
+// Event is delivered to subscribers of a run. Exactly one of Lines, Status or
+// Done is set.
+type Event struct {
+	Lines  []model.RunLogEntry
+	Status bool // 运行状态发生变化，订阅方需重新读取运行信息
+	Done   bool // 执行器已结束该运行，之后不会再有新日志
+}
+
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[int64]map[*Subscription]struct{}
+	active map[int64]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs:   make(map[int64]map[*Subscription]struct{}),
+		active: make(map[int64]bool),
+	}
+}
+
+// Subscription receives events for one run. Events are dropped instead of
+// blocking the publisher when the buffer is full, so consumers must detect
+// gaps through RunLogEntry.Seq and reload missing lines from the store.
+type Subscription struct {
+	C <-chan Event
+
+	hub   *Hub
+	runID int64
+	ch    chan Event
+	once  sync.Once
+}
+
+func (h *Hub) Subscribe(runID int64) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, hub: h, runID: runID, ch: ch}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[runID] == nil {
+		h.subs[runID] = make(map[*Subscription]struct{})
+	}
+	h.subs[runID][sub] = struct{}{}
+	return sub
+}
+
+// Close unsubscribes; it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+		delete(s.hub.subs[s.runID], s)
+		if len(s.hub.subs[s.runID]) == 0 {
+			delete(s.hub.subs, s.runID)
+		}
+	})
+}
+
+// PublishLines announces persisted entries; their Seq must already be set.
+func (h *Hub) PublishLines(runID int64, entries []model.RunLogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	h.publish(runID, Event{Lines: entries})
+}
+
+func (h *Hub) PublishStatus(runID int64) {
+	h.publish(runID, Event{Status: true})
+}
+
+// Begin marks runID as being executed in this process.
+func (h *Hub) Begin(runID int64) {
+	h.mu.Lock()
+	h.active[runID] = true
+	h.mu.Unlock()
+}
+
+// End marks the run finished and notifies subscribers.
+func (h *Hub) End(runID int64) {
+	h.mu.Lock()
+	delete(h.active, runID)
+	h.mu.Unlock()
+	h.publish(runID, Event{Done: true})
+}
+
+// Active reports whether the executor may still write log lines for runID.
+func (h *Hub) Active(runID int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.active[runID]
+}
+
+func (h *Hub) publish(runID int64, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[runID] {
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package logstream
+
+import (
+	"testing"
+
+	"devops-pipeline/internal/model"
+)
+
+func entries(startSeq int64, texts ...string) []model.RunLogEntry {
+	result := make([]model.RunLogEntry, len(texts))
+	for i, text := range texts {
+		result[i] = model.RunLogEntry{Seq: startSeq + int64(i), Text: text}
+	}
+	return result
+}
+
+func TestHubDeliversLinesToRunSubscribers(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe(1)
+	defer sub.Close()
+	other := hub.Subscribe(2)
+	defer other.Close()
+
+	hub.PublishLines(1, entries(5, "a", "b"))
+
+	event := <-sub.C
+	if len(event.Lines) != 2 || event.Lines[0] != (model.RunLogEntry{Seq: 5, Text: "a"}) || event.Lines[1] != (model.RunLogEntry{Seq: 6, Text: "b"}) {
+		t.Fatalf("unexpected lines: %+v", event.Lines)
+	}
+	select {
+	case event := <-other.C:
+		t.Fatalf("did not expect event for another run: %+v", event)
+	default:
+	}
+}
+
+func TestHubDropsEventsForSlowSubscribers(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe(1)
+	defer sub.Close()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		hub.PublishLines(1, entries(int64(i), "x"))
+	}
+	if got := len(sub.C); got != subscriberBuffer {
+		t.Fatalf("unexpected buffered events: got %d want %d", got, subscriberBuffer)
+	}
+}
+
+func TestHubActiveAndEnd(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe(3)
+
+	hub.Begin(3)
+	if !hub.Active(3) {
+		t.Fatalf("expected run to be active")
+	}
+	hub.End(3)
+	if hub.Active(3) {
+		t.Fatalf("expected run to be inactive after End")
+	}
+	if event := <-sub.C; !event.Done {
+		t.Fatalf("expected done event, got %+v", event)
+	}
+
+	sub.Close()
+	sub.Close()
+	hub.PublishStatus(3)
+	if len(hub.subs) != 0 {
+		t.Fatalf("expected subscription to be removed")
+	}
+}
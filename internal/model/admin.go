@@ -2,12 +2,99 @@ package model
 
 import "time"
 
-type AdminUser struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+// 用户角色，权限依次递增
+const (
+	RoleViewer     = "viewer"
+	RoleDeployer   = "deployer"
+	RoleMaintainer = "maintainer"
+	RoleAdmin      = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:     1,
+	RoleDeployer:   2,
+	RoleMaintainer: 3,
+	RoleAdmin:      4,
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants everything required grants.
+// Unknown roles grant nothing.
+func RoleAtLeast(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// HigherRole returns whichever of a and b grants more.
+func HigherRole(a, b string) string {
+	if roleRanks[b] > roleRanks[a] {
+		return b
+	}
+	return a
+}
+
+// 账号来源：本地密码账号，或由 LDAP / OIDC 登录时创建的外部账号
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+	AuthSourceOIDC  = "oidc"
+)
+
+// ValidAuthSource reports whether source is one of the known account sources.
+func ValidAuthSource(source string) bool {
+	return source == AuthSourceLocal || source == AuthSourceLDAP || source == AuthSourceOIDC
+}
+
+// User is an account stored in admin_users. The table keeps its original
+// name from when only a single administrator existed.
+type User struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	Disabled     bool   `json:"disabled"`
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	// PasswordChangeRequired 为 true 时账号必须先修改密码才能使用其他功能
+	PasswordChangeRequired bool `json:"password_change_required"`
+	// AuthSource 记录账号来自哪里，外部账号只与同一来源、同一 ExternalID 的登录关联
+	AuthSource string `json:"auth_source"`
+	// ExternalID 是 OIDC 的 sub 或 LDAP 的登录名；为空表示等待该来源下一次同名登录认领
+	ExternalID string    `json:"external_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type UserCreateInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// UserUpdateInput changes an account. An empty Password keeps the current one.
+// A non-empty AuthSource different from the current one hands the account to
+// that source: the next login from it with the same username links to it.
+type UserUpdateInput struct {
+	Role       string `json:"role"`
+	Disabled   bool   `json:"disabled"`
+	Password   string `json:"password"`
+	AuthSource string `json:"auth_source"`
+}
+
+// ProjectPermission grants a user a role on one project on top of the
+// user's global role.
+type ProjectPermission struct {
+	ProjectID   int64  `json:"project_id"`
+	ProjectName string `json:"project_name,omitempty"`
+	Role        string `json:"role"`
+}
+
+type ProjectPermissionsInput struct {
+	Permissions []ProjectPermission `json:"permissions"`
 }
 
 type LoginRequest struct {
@@ -15,7 +102,133 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// LoginResponse either carries the session token or, for accounts with
+// two-factor authentication, a challenge for the second step.
 type LoginResponse struct {
-	Token    string `json:"token"`
+	Token    string `json:"token,omitempty"`
 	Username string `json:"username"`
-}
\ No newline at end of file
+	Role     string `json:"role,omitempty"`
+	// TwoFactorRequired 为 true 时需要用 Challenge 和验证码调用第二步登录
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
+	// PasswordChangeRequired 表示账号仍在使用默认密码，登录后需要先修改
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+	// RefreshToken 用于在访问令牌过期后换取新令牌，ExpiresIn 是访问令牌的有效秒数
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+}
+
+// StreamTicket is a single-use credential for the log stream of one run,
+// passed as ?ticket= because EventSource cannot send headers.
+type StreamTicket struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// RefreshRequest exchanges a refresh token for a new access token. The
+// refresh token is rotated on every use.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// UserSession is a login of one account on one device. Only a hash of its
+// refresh token is stored.
+type UserSession struct {
+	ID               int64     `json:"id"`
+	UserID           int64     `json:"user_id"`
+	UserAgent        string    `json:"user_agent"`
+	ClientIP         string    `json:"client_ip"`
+	RefreshTokenHash string    `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+	LastUsedAt       time.Time `json:"last_used_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	// Current 标记发起请求的会话
+	Current bool `json:"current"`
+}
+
+// TwoFactorLoginRequest completes a login with a TOTP code or a recovery code.
+type TwoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// TwoFactorSetup is returned when enrolment starts. The secret is only
+// active after it has been confirmed with a code.
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// TwoFactorCodeInput carries a TOTP code, or a recovery code where allowed.
+type TwoFactorCodeInput struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes are shown once; only their hashes are stored.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// SSOInfo tells the login page whether single sign-on is available.
+type SSOInfo struct {
+	Enabled     bool   `json:"enabled"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// API 令牌的作用域，令牌的权限不会超过所属账号的角色
+const (
+	APITokenScopeRead    = "read"
+	APITokenScopeTrigger = "trigger"
+	APITokenScopeFull    = "full"
+)
+
+// APITokenScopeRole returns the highest role a token of scope may act with,
+// or "" when scope is unknown.
+func APITokenScopeRole(scope string) string {
+	switch scope {
+	case APITokenScopeRead:
+		return RoleViewer
+	case APITokenScopeTrigger:
+		return RoleDeployer
+	case APITokenScopeFull:
+		return RoleAdmin
+	default:
+		return ""
+	}
+}
+
+// LowerRole returns whichever of a and b grants less.
+func LowerRole(a, b string) string {
+	if roleRanks[b] < roleRanks[a] {
+		return b
+	}
+	return a
+}
+
+// APIToken is a personal access token. Only a hash of the secret is stored;
+// TokenPrefix holds its first characters so users can tell tokens apart.
+type APIToken struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Name        string     `json:"name"`
+	Scope       string     `json:"scope"`
+	TokenPrefix string     `json:"token_prefix"`
+	TokenHash   string     `json:"-"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type APITokenCreateInput struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	// ExpiresInDays 为 0 时使用默认有效期
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// APITokenCreated is returned once when a token is created; the plain token
+// cannot be read again afterwards.
+type APITokenCreated struct {
+	APIToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// AuditEvent records one change made through the API. Changes holds the
+// fields that differ between the old and new state, with secrets redacted.
+type AuditEvent struct {
+	ID         int64                  `json:"id"`
+	ActorID    *int64                 `json:"actor_id"`
+	Actor      string                 `json:"actor"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	TargetName string                 `json:"target_name"`
+	RequestID  string                 `json:"request_id"`
+	ClientIP   string                 `json:"client_ip"`
+	Changes    map[string]AuditChange `json:"changes"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// AuditChange is the old and new value of one field. A missing side means the
+// field did not exist before (create) or after (delete).
+type AuditChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+type AuditEventCreateInput struct {
+	ActorID    *int64
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	TargetName string
+	RequestID  string
+	ClientIP   string
+	Changes    map[string]AuditChange
+}
+
+// AuditEventFilter narrows audit listings. Zero values leave a condition out.
+type AuditEventFilter struct {
+	Actor       string
+	Action      string
+	TargetType  string
+	TargetID    string
+	CreatedFrom time.Time // 创建时间下限（含）
+	CreatedTo   time.Time // 创建时间上限（不含）
+	Offset      int
+	Limit       int
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"path"
 	"strings"
 	"time"
@@ -15,14 +16,22 @@ const (
 	RunStatusRunning = "running"
 	RunStatusSuccess = "success"
 	RunStatusFailed  = "failed"
+	// RunStatusSkipped 表示触发已收到但因跳过标记未执行
+	RunStatusSkipped = "skipped"
 
-	TriggerTypeWebhook = "webhook"
-	TriggerTypeManual  = "manual"
+	TriggerTypeWebhook     = "webhook"
+	TriggerTypeManual      = "manual"
+	TriggerTypePullRequest = "pull_request" // PR/MR 校验构建，不部署
 
 	GitAuthTypeNone     = "none"
 	GitAuthTypeUsername = "username" // 用户名密码认证
 	GitAuthTypeToken    = "token"    // Token认证
 	GitAuthTypeSSH      = "ssh"      // SSH密钥认证
+
+	CommitStatusProviderNone   = ""
+	CommitStatusProviderGitHub = "github"
+	CommitStatusProviderGitLab = "gitlab"
+	CommitStatusProviderGitea  = "gitea"
 )
 
 type Host struct {
@@ -47,23 +56,31 @@ type HostUpsert struct {
 }
 
 type Project struct {
-	ID              int64     `json:"id"`
-	SortOrder       int64     `json:"sort_order"`
-	Name            string    `json:"name"`
-	RepoURL         string    `json:"repo_url"`
-	Branch          string    `json:"branch"`
-	Description     string    `json:"description"`
-	WebhookToken    string    `json:"webhook_token"`
-	HasDeployConfig bool      `json:"has_deploy_config"`
-	GitAuthType     string    `json:"git_auth_type"` // none/username/token/ssh
-	GitUsername     string    `json:"git_username"`  // Git用户名（加密）
-	GitPassword     string    `json:"-"`             // Git密码/Token（加密）
-	GitSSHKey       string    `json:"-"`             // SSH私钥（加密）
-	HasGitAuth      bool      `json:"has_git_auth"`  // 是否配置了Git认证
-	HasGitPassword  bool      `json:"has_git_password"`
-	HasGitSSHKey    bool      `json:"has_git_ssh_key"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID                   int64     `json:"id"`
+	SortOrder            int64     `json:"sort_order"`
+	Name                 string    `json:"name"`
+	RepoURL              string    `json:"repo_url"`
+	Branch               string    `json:"branch"`
+	Description          string    `json:"description"`
+	WebhookToken         string    `json:"webhook_token"`
+	HasDeployConfig      bool      `json:"has_deploy_config"`
+	GitAuthType          string    `json:"git_auth_type"` // none/username/token/ssh
+	GitUsername          string    `json:"git_username"`  // Git用户名（加密）
+	GitPassword          string    `json:"-"`             // Git密码/Token（加密）
+	GitSSHKey            string    `json:"-"`             // SSH私钥（加密）
+	HasGitAuth           bool      `json:"has_git_auth"`  // 是否配置了Git认证
+	HasGitPassword       bool      `json:"has_git_password"`
+	HasGitSSHKey         bool      `json:"has_git_ssh_key"`
+	PathIncludes         []string  `json:"path_includes"` // 变更路径包含规则
+	PathExcludes         []string  `json:"path_excludes"` // 变更路径排除规则
+	SkipMarkers          []string  `json:"skip_markers"`  // 项目级跳过标记，与全局标记合并使用
+	PRBuildsEnabled      bool      `json:"pr_builds_enabled"`
+	CommitStatusProvider string    `json:"commit_status_provider"` // github/gitlab/gitea，为空表示不回写
+	CommitStatusAPIURL   string    `json:"commit_status_api_url"`  // 为空时根据仓库地址推断
+	CommitStatusToken    string    `json:"-"`
+	HasCommitStatusToken bool      `json:"has_commit_status_token"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
 }
 
 type ProjectUpsert struct {
@@ -75,18 +92,35 @@ type ProjectUpsert struct {
 	GitUsername *string `json:"git_username"`  // Git用户名
 	GitPassword *string `json:"git_password"`  // Git密码/Token
 	GitSSHKey   *string `json:"git_ssh_key"`   // SSH私钥
+	// PathIncludes/PathExcludes/SkipMarkers 为 nil 时更新项目会保留原有规则
+	PathIncludes []string `json:"path_includes"`
+	PathExcludes []string `json:"path_excludes"`
+	SkipMarkers  []string `json:"skip_markers"`
+	// PRBuildsEnabled 为 nil 时保持原值
+	PRBuildsEnabled *bool `json:"pr_builds_enabled"`
+	// 提交状态字段为 nil 时保持原值，Token 传空字符串表示清除
+	CommitStatusProvider *string `json:"commit_status_provider"`
+	CommitStatusAPIURL   *string `json:"commit_status_api_url"`
+	CommitStatusToken    *string `json:"commit_status_token"`
 }
 
 type ProjectDetailUpsert struct {
-	Name         string             `json:"name"`
-	RepoURL      string             `json:"repo_url"`
-	Branch       string             `json:"branch"`
-	Description  string             `json:"description"`
-	GitAuthType  string             `json:"git_auth_type"`
-	GitUsername  *string            `json:"git_username"`
-	GitPassword  *string            `json:"git_password"`
-	GitSSHKey    *string            `json:"git_ssh_key"`
-	DeployConfig DeployConfigUpsert `json:"deploy_config"`
+	Name                 string             `json:"name"`
+	RepoURL              string             `json:"repo_url"`
+	Branch               string             `json:"branch"`
+	Description          string             `json:"description"`
+	GitAuthType          string             `json:"git_auth_type"`
+	GitUsername          *string            `json:"git_username"`
+	GitPassword          *string            `json:"git_password"`
+	GitSSHKey            *string            `json:"git_ssh_key"`
+	PathIncludes         []string           `json:"path_includes"`
+	PathExcludes         []string           `json:"path_excludes"`
+	SkipMarkers          []string           `json:"skip_markers"`
+	PRBuildsEnabled      *bool              `json:"pr_builds_enabled"`
+	CommitStatusProvider *string            `json:"commit_status_provider"`
+	CommitStatusAPIURL   *string            `json:"commit_status_api_url"`
+	CommitStatusToken    *string            `json:"commit_status_token"`
+	DeployConfig         DeployConfigUpsert `json:"deploy_config"`
 }
 
 func (p ProjectDetailUpsert) ProjectUpsert() ProjectUpsert {
@@ -99,6 +133,15 @@ func (p ProjectDetailUpsert) ProjectUpsert() ProjectUpsert {
 		GitUsername: p.GitUsername,
 		GitPassword: p.GitPassword,
 		GitSSHKey:   p.GitSSHKey,
+
+		PathIncludes:    p.PathIncludes,
+		PathExcludes:    p.PathExcludes,
+		SkipMarkers:     p.SkipMarkers,
+		PRBuildsEnabled: p.PRBuildsEnabled,
+
+		CommitStatusProvider: p.CommitStatusProvider,
+		CommitStatusAPIURL:   p.CommitStatusAPIURL,
+		CommitStatusToken:    p.CommitStatusToken,
 	}
 }
 
@@ -162,35 +205,144 @@ type ExecutionBundle struct {
 }
 
 type PipelineRun struct {
-	ID            int64      `json:"id"`
-	ProjectID     int64      `json:"project_id"`
-	ProjectName   string     `json:"project_name"`
-	Branch        string     `json:"branch"`
-	Status        string     `json:"status"`
-	TriggerType   string     `json:"trigger_type"`
-	TriggerRef    string     `json:"trigger_ref"`
-	CommitID      string     `json:"commit_id"`
-	CommitMessage string     `json:"commit_message"`
-	Author        string     `json:"author"`
-	LogText       string     `json:"log_text"`
-	ErrorMessage  string     `json:"error_message"`
-	StartedAt     *time.Time `json:"started_at,omitempty"`
-	FinishedAt    *time.Time `json:"finished_at,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
+	ID                int64      `json:"id"`
+	ProjectID         int64      `json:"project_id"`
+	ProjectName       string     `json:"project_name"`
+	Branch            string     `json:"branch"`
+	Status            string     `json:"status"`
+	TriggerType       string     `json:"trigger_type"`
+	TriggerRef        string     `json:"trigger_ref"`
+	PullRequestNumber *int64     `json:"pull_request_number,omitempty"`
+	CommitID          string     `json:"commit_id"`
+	CommitMessage     string     `json:"commit_message"`
+	Author            string     `json:"author"`
+	TriggeredBy       string     `json:"triggered_by,omitempty"` // 手动触发的用户名
+	CancelledBy       string     `json:"cancelled_by,omitempty"` // 手动取消的用户名
+	ArtifactSize      int64      `json:"artifact_size,omitempty"`
+	ArtifactSHA256    string     `json:"artifact_sha256,omitempty"`
+	DurationMS        int64      `json:"duration_ms"`
+	LogText           string     `json:"log_text"`
+	ErrorMessage      string     `json:"error_message"`
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// RunFilter narrows run listings. Zero values leave a condition out.
+type RunFilter struct {
+	ProjectID    int64
+	Statuses     []string
+	TriggerType  string
+	Branch       string
+	CommitPrefix string    // 提交 SHA 前缀
+	Author       string    // 作者名，忽略大小写的模糊匹配
+	CreatedFrom  time.Time // 创建时间下限（含）
+	CreatedTo    time.Time // 创建时间上限（不含）
+}
+
+const (
+	RunSortCreated  = "created"
+	RunSortStarted  = "started_at"
+	RunSortDuration = "duration"
+)
+
+// RunListQuery selects one page of runs. Cursor is the NextCursor of the
+// previous page and must be used with the same Sort and Ascending values;
+// Offset is only honoured when Cursor is empty.
+type RunListQuery struct {
+	Filter    RunFilter
+	Sort      string
+	Ascending bool
+	Cursor    string
+	Offset    int
+	Limit     int
+}
+
+type RunPage struct {
+	Runs       []PipelineRun `json:"runs"`
+	Total      int64         `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// RunSearchQuery searches run log lines; every whitespace separated term of
+// Query must appear in a matching line.
+type RunSearchQuery struct {
+	Query     string
+	ProjectID int64
+	Limit     int
+}
+
+// RunLogMatch is a matching log line. Snippet is HTML escaped with the matched
+// terms wrapped in <mark>; Line is the one-based line number.
+type RunLogMatch struct {
+	Seq     int64  `json:"seq"`
+	Line    int64  `json:"line"`
+	Snippet string `json:"snippet"`
+}
+
+type RunSearchResult struct {
+	Run     PipelineRun   `json:"run"`
+	Matches []RunLogMatch `json:"matches"`
+}
+
+const (
+	LogSourceSystem = "system"
+	LogSourceStdout = "stdout"
+	LogSourceStderr = "stderr"
+	LogSourceRemote = "remote" // 远程主机上执行的命令输出
+
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// RunLogEntry is one structured log line. Seq is its zero-based position in
+// the run log; Time is zero for lines migrated from the plain-text log.
+type RunLogEntry struct {
+	Seq    int64     `json:"seq"`
+	Time   time.Time `json:"time,omitzero"`
+	Stage  string    `json:"stage,omitempty"`
+	Source string    `json:"source"`
+	Level  string    `json:"level"`
+	Text   string    `json:"text"`
+}
+
+// PlainText renders the entry in the classic "[timestamp] message" format.
+func (e RunLogEntry) PlainText() string {
+	if e.Time.IsZero() {
+		return e.Text
+	}
+	return fmt.Sprintf("[%s] %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Text)
 }
 
 type PipelineRunLog struct {
-	RunID     int64     `json:"run_id"`
-	LogText   string    `json:"log_text"`
-	UpdatedAt time.Time `json:"updated_at"`
+	RunID      int64         `json:"run_id"`
+	LogText    string        `json:"log_text,omitempty"`
+	Entries    []RunLogEntry `json:"entries,omitempty"`
+	Offset     int64         `json:"offset"`      // 本次读取的起始行号（从 0 开始）
+	NextOffset int64         `json:"next_offset"` // 下次增量读取时传入的 offset
+	TotalLines int64         `json:"total_lines"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// RunLogQuery selects a window of log lines. Stage and Source filter entries;
+// Tail, when positive, keeps only the last Tail matching lines at or after
+// Offset.
+type RunLogQuery struct {
+	Offset int64
+	Tail   int64
+	Stage  string
+	Source string
 }
 
 type RunCreateInput struct {
-	ProjectID   int64
-	Status      string
-	TriggerType string
-	TriggerRef  string
+	ProjectID         int64
+	Status            string
+	TriggerType       string
+	TriggerRef        string
+	PullRequestNumber *int64
+	TriggeredBy       string
 }
 
 type ReorderInput struct {
@@ -249,3 +401,56 @@ func NormalizeCacheDir(cacheDir string) string {
 
 	return cleaned
 }
+
+// NormalizePathFilters trims changed-path globs, strips leading "./" or "/" and
+// drops empty or duplicate entries. Patterns are always relative to the repo root.
+func NormalizePathFilters(patterns []string) []string {
+	normalized := make([]string, 0, len(patterns))
+	seen := make(map[string]struct{}, len(patterns))
+	for _, pattern := range patterns {
+		cleaned := strings.TrimSpace(strings.ReplaceAll(pattern, "\\", "/"))
+		cleaned = strings.TrimPrefix(cleaned, "./")
+		cleaned = strings.TrimLeft(cleaned, "/")
+		if cleaned == "" {
+			continue
+		}
+		if _, exists := seen[cleaned]; exists {
+			continue
+		}
+		seen[cleaned] = struct{}{}
+		normalized = append(normalized, cleaned)
+	}
+	return normalized
+}
+
+// NormalizeSkipMarkers trims commit message markers and drops empty or
+// duplicate (case-insensitive) entries.
+func NormalizeSkipMarkers(markers []string) []string {
+	normalized := make([]string, 0, len(markers))
+	seen := make(map[string]struct{}, len(markers))
+	for _, marker := range markers {
+		cleaned := strings.TrimSpace(marker)
+		if cleaned == "" {
+			continue
+		}
+		key := strings.ToLower(cleaned)
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+		normalized = append(normalized, cleaned)
+	}
+	return normalized
+}
+
+// FindSkipMarker returns the first marker contained in the commit message,
+// compared case-insensitively, or "" when the run should not be skipped.
+func FindSkipMarker(message string, markers []string) string {
+	lowered := strings.ToLower(message)
+	for _, marker := range NormalizeSkipMarkers(markers) {
+		if strings.Contains(lowered, strings.ToLower(marker)) {
+			return marker
+		}
+	}
+	return ""
+}
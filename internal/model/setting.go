@@ -6,21 +6,31 @@ import (
 )
 
 const (
-	SettingDockerMirrorURL  = "docker_mirror_url"
-	SettingGitDockerImage   = "git_docker_image"
-	SettingBuildCacheDirs   = "build_cache_dirs"
-	SettingPublicBaseURL    = "public_base_url"
-	SettingProxyURL         = "proxy_url"
-	SettingRunRetentionDays = "run_retention_days"
+	SettingDockerMirrorURL          = "docker_mirror_url"
+	SettingGitDockerImage           = "git_docker_image"
+	SettingBuildCacheDirs           = "build_cache_dirs"
+	SettingPublicBaseURL            = "public_base_url"
+	SettingProxyURL                 = "proxy_url"
+	SettingRunRetentionDays         = "run_retention_days"
+	SettingSkipCIMarkers            = "skip_ci_markers"
+	SettingWebhookDeliveryRetention = "webhook_delivery_retention"
+	SettingArtifactRetentionDays    = "artifact_retention_days"
+	SettingAuditRetentionDays       = "audit_retention_days"
+	SettingTwoFactorRequired        = "two_factor_required"
 )
 
 var DefaultSettings = map[string]string{
-	SettingDockerMirrorURL:  "",
-	SettingGitDockerImage:   "alpine/git:latest",
-	SettingBuildCacheDirs:   strings.Join(DefaultDeployCacheDirs(), "\n"),
-	SettingPublicBaseURL:    "",
-	SettingProxyURL:         "",
-	SettingRunRetentionDays: "30",
+	SettingDockerMirrorURL:          "",
+	SettingGitDockerImage:           "alpine/git:latest",
+	SettingBuildCacheDirs:           strings.Join(DefaultDeployCacheDirs(), "\n"),
+	SettingPublicBaseURL:            "",
+	SettingProxyURL:                 "",
+	SettingRunRetentionDays:         "30",
+	SettingSkipCIMarkers:            "[skip ci]\n[ci skip]",
+	SettingWebhookDeliveryRetention: "500",
+	SettingArtifactRetentionDays:    "0",
+	SettingAuditRetentionDays:       "365",
+	SettingTwoFactorRequired:        "false",
 }
 
 func ParseBuildCacheDirsSetting(value string) []string {
@@ -28,6 +38,11 @@ func ParseBuildCacheDirsSetting(value string) []string {
 	return NormalizeCacheDirs(strings.Split(normalizedValue, "\n"))
 }
 
+func ParseSkipCIMarkersSetting(value string) []string {
+	normalizedValue := strings.ReplaceAll(value, "\r\n", "\n")
+	return NormalizeSkipMarkers(strings.Split(normalizedValue, "\n"))
+}
+
 type Setting struct {
 	Key       string    `json:"key"`
 	Value     string    `json:"value"`
@@ -50,6 +65,15 @@ type ChangePasswordInput struct {
 
 type AccountProfile struct {
 	Username string `json:"username"`
+	Role     string `json:"role"`
+	// Permissions 是账号的项目级授权
+	Permissions []ProjectPermission `json:"permissions"`
+	TOTPEnabled bool                `json:"totp_enabled"`
+	// RecoveryCodesLeft 是尚未使用的恢复码数量
+	RecoveryCodesLeft int `json:"recovery_codes_left"`
+	// TwoFactorRequired 表示管理员要求所有账号启用两步验证
+	TwoFactorRequired      bool `json:"two_factor_required"`
+	PasswordChangeRequired bool `json:"password_change_required"`
 }
 
 type BackupMeta struct {
@@ -59,6 +83,33 @@ type BackupMeta struct {
 	Version       string `json:"version"`
 }
 
+// SchemaMigration describes one numbered schema migration; AppliedAt is nil
+// while it is still pending.
+type SchemaMigration struct {
+	Version    int        `json:"version"`
+	Name       string     `json:"name"`
+	DurationMS int64      `json:"duration_ms"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+}
+
+// TableCopyResult reports how many rows of one table were copied between
+// databases and the counts found on both sides afterwards.
+type TableCopyResult struct {
+	Table      string `json:"table"`
+	CopiedRows int64  `json:"copied_rows"`
+	SourceRows int64  `json:"source_rows"`
+	TargetRows int64  `json:"target_rows"`
+}
+
+// CipherColumnRotation reports, for one encrypted column, how many values
+// it holds and how many were re-encrypted with the current key.
+type CipherColumnRotation struct {
+	Table   string `json:"table"`
+	Column  string `json:"column"`
+	Values  int64  `json:"values"`
+	Rotated int64  `json:"rotated"`
+}
+
 type BackupHost struct {
 	ID        int64  `json:"id"`
 	SortOrder int64  `json:"sort_order"`
@@ -70,17 +121,24 @@ type BackupHost struct {
 }
 
 type BackupProject struct {
-	ID           int64   `json:"id"`
-	SortOrder    int64   `json:"sort_order"`
-	Name         string  `json:"name"`
-	RepoURL      string  `json:"repo_url"`
-	Branch       string  `json:"branch"`
-	Description  string  `json:"description"`
-	WebhookToken string  `json:"webhook_token"`
-	GitAuthType  string  `json:"git_auth_type"`
-	GitUsername  *string `json:"git_username,omitempty"`
-	GitPassword  *string `json:"git_password,omitempty"`
-	GitSSHKey    *string `json:"git_ssh_key,omitempty"`
+	ID                   int64    `json:"id"`
+	SortOrder            int64    `json:"sort_order"`
+	Name                 string   `json:"name"`
+	RepoURL              string   `json:"repo_url"`
+	Branch               string   `json:"branch"`
+	Description          string   `json:"description"`
+	WebhookToken         string   `json:"webhook_token"`
+	GitAuthType          string   `json:"git_auth_type"`
+	GitUsername          *string  `json:"git_username,omitempty"`
+	GitPassword          *string  `json:"git_password,omitempty"`
+	GitSSHKey            *string  `json:"git_ssh_key,omitempty"`
+	PathIncludes         []string `json:"path_includes,omitempty"`
+	PathExcludes         []string `json:"path_excludes,omitempty"`
+	SkipMarkers          []string `json:"skip_markers,omitempty"`
+	PRBuildsEnabled      bool     `json:"pr_builds_enabled,omitempty"`
+	CommitStatusProvider string   `json:"commit_status_provider,omitempty"`
+	CommitStatusAPIURL   string   `json:"commit_status_api_url,omitempty"`
+	CommitStatusToken    *string  `json:"commit_status_token,omitempty"`
 }
 
 type BackupDeployConfig struct {
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+const (
+	WebhookDecisionAccepted = "accepted" // 已创建部署任务
+	WebhookDecisionSkipped  = "skipped"  // 路径过滤或跳过标记
+	WebhookDecisionRejected = "rejected" // 令牌无效、分支不匹配或载荷无法解析
+	WebhookDecisionError    = "error"    // 服务端错误
+)
+
+type WebhookDelivery struct {
+	ID            int64               `json:"id"`
+	ProjectID     *int64              `json:"project_id"`
+	ProjectName   string              `json:"project_name"`
+	Headers       map[string][]string `json:"headers"`
+	Body          string              `json:"body,omitempty"`
+	BodySize      int64               `json:"body_size"`
+	BodyTruncated bool                `json:"body_truncated"`
+	Decision      string              `json:"decision"`
+	Reason        string              `json:"reason"`
+	StatusCode    int                 `json:"status_code"`
+	RunID         *int64              `json:"run_id"`
+	ReplayOfID    *int64              `json:"replay_of_id"`
+	CreatedAt     time.Time           `json:"created_at"`
+}
+
+type WebhookDeliveryCreateInput struct {
+	ProjectID     *int64
+	Headers       map[string][]string
+	Body          string
+	BodySize      int64
+	BodyTruncated bool
+	Decision      string
+	Reason        string
+	StatusCode    int
+	RunID         *int64
+	ReplayOfID    *int64
+}
+
+type WebhookDeliveryFilter struct {
+	ProjectID int64
+	Decision  string
+	Offset    int
+	Limit     int
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/model"
+)
+
+// ArtifactPath returns where the artifact archive of runID is kept locally.
+func (e *Executor) ArtifactPath(runID int64) string {
+	return filepath.Join(e.artifactRoot, fmt.Sprintf("run-%d.tgz", runID))
+}
+
+// artifactRetentionDays reads the artifact_retention_days setting; 0 means
+// archives are removed as soon as the run finishes.
+func (e *Executor) artifactRetentionDays(ctx context.Context) int {
+	value, err := e.store.GetSettingValue(ctx, model.SettingArtifactRetentionDays)
+	if err != nil {
+		e.logger.Warn("read artifact retention failed", "error", err)
+		return 0
+	}
+	days, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || days < 0 {
+		return 0
+	}
+	return days
+}
+
+// PruneArtifacts removes archives older than the artifact retention period.
+// Archives of runs that are still executing are left alone.
+func (e *Executor) PruneArtifacts(ctx context.Context) error {
+	days := e.artifactRetentionDays(ctx)
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	entries, err := os.ReadDir(e.artifactRoot)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read artifact dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		runID, ok := parseArtifactArchiveName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		e.cancelMutex.Lock()
+		_, running := e.cancelFuncs[runID]
+		e.cancelMutex.Unlock()
+		if running {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if days > 0 && info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := e.removeArtifact(ctx, runID); err != nil {
+			return fmt.Errorf("remove expired artifact %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// removeArtifact deletes the archive of runID and clears the artifact details
+// of the run, which tell clients the archive can be downloaded.
+func (e *Executor) removeArtifact(ctx context.Context, runID int64) error {
+	err := os.Remove(e.ArtifactPath(runID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return e.store.SetRunArtifact(ctx, runID, 0, "")
+}
+
+func parseArtifactArchiveName(name string) (int64, bool) {
+	if !strings.HasPrefix(name, "run-") || !strings.HasSuffix(name, ".tgz") {
+		return 0, false
+	}
+	runID, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, "run-"), ".tgz"), 10, 64)
+	if err != nil || runID <= 0 {
+		return 0, false
+	}
+	return runID, true
+}
+
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,23 @@
+package pipeline
+
+import "testing"
+
+func TestParseArtifactArchiveName(t *testing.T) {
+	tests := []struct {
+		name  string
+		runID int64
+		ok    bool
+	}{
+		{name: "run-12.tgz", runID: 12, ok: true},
+		{name: "run-12", ok: false},
+		{name: "run-abc.tgz", ok: false},
+		{name: "run-0.tgz", ok: false},
+		{name: "other-12.tgz", ok: false},
+	}
+	for _, tt := range tests {
+		runID, ok := parseArtifactArchiveName(tt.name)
+		if runID != tt.runID || ok != tt.ok {
+			t.Fatalf("parseArtifactArchiveName(%q) = %d, %v want %d, %v", tt.name, runID, ok, tt.runID, tt.ok)
+		}
+	}
+}
@@ -27,9 +27,12 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"devops-pipeline/internal/gitprovider"
+	"devops-pipeline/internal/logstream"
 	"devops-pipeline/internal/model"
 	"devops-pipeline/internal/notification"
 	"devops-pipeline/internal/store"
+	"devops-pipeline/internal/version"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -45,12 +48,24 @@ type Executor struct {
 	cancelFuncs   map[int64]context.CancelFunc
 	cancelMutex   sync.Mutex
 	notifySender  *notification.Sender
+	statusClient  *gitprovider.Client
+	logHub        *logstream.Hub
 }
 
 const maxCommandLogTokenSize = 1024 * 1024
 
 var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
 
+// skippedRunError stops a pipeline after clone when the head commit asks for
+// CI to be skipped; execute finalizes such runs as skipped instead of failed.
+type skippedRunError struct {
+	marker string
+}
+
+func (e *skippedRunError) Error() string {
+	return fmt.Sprintf("commit message contains skip marker %q", e.marker)
+}
+
 type pipelineResult struct {
 	Stage           string
 	CommitID        string
@@ -71,23 +86,53 @@ func NewExecutor(store *store.Store, logger *slog.Logger, workspaceRoot, artifac
 		},
 		cancelFuncs:  make(map[int64]context.CancelFunc),
 		notifySender: notification.New(logger),
+		statusClient: gitprovider.New(nil),
+		logHub:       logstream.NewHub(),
 	}
 }
 
-func (e *Executor) Trigger(ctx context.Context, projectID int64, triggerType, triggerRef string) (model.PipelineRun, error) {
-	if _, err := e.store.GetExecutionBundle(ctx, projectID); err != nil {
-		return model.PipelineRun{}, err
-	}
-
-	// 停止该项目的所有运行中的部署
-	e.cancelRunningDeployments(ctx, projectID)
+// LogHub exposes live run log events to streaming handlers.
+func (e *Executor) LogHub() *logstream.Hub {
+	return e.logHub
+}
 
-	run, err := e.store.CreateRun(ctx, model.RunCreateInput{
+func (e *Executor) Trigger(ctx context.Context, projectID int64, triggerType, triggerRef string) (model.PipelineRun, error) {
+	return e.trigger(ctx, model.RunCreateInput{
 		ProjectID:   projectID,
-		Status:      model.RunStatusQueued,
 		TriggerType: triggerType,
 		TriggerRef:  triggerRef,
 	})
+}
+
+// TriggerManual starts a run requested from the UI or API and records the
+// user who asked for it.
+func (e *Executor) TriggerManual(ctx context.Context, projectID int64, username string) (model.PipelineRun, error) {
+	return e.trigger(ctx, model.RunCreateInput{
+		ProjectID:   projectID,
+		TriggerType: model.TriggerTypeManual,
+		TriggerRef:  "manual",
+		TriggeredBy: username,
+	})
+}
+
+// TriggerPullRequest starts a build-only run for a pull/merge request. headRef
+// is the provider ref that holds the PR head, e.g. refs/pull/12/head.
+func (e *Executor) TriggerPullRequest(ctx context.Context, projectID, number int64, headRef string) (model.PipelineRun, error) {
+	return e.trigger(ctx, model.RunCreateInput{
+		ProjectID:         projectID,
+		TriggerType:       model.TriggerTypePullRequest,
+		TriggerRef:        headRef,
+		PullRequestNumber: &number,
+	})
+}
+
+func (e *Executor) trigger(ctx context.Context, input model.RunCreateInput) (model.PipelineRun, error) {
+	if _, err := e.store.GetExecutionBundle(ctx, input.ProjectID); err != nil {
+		return model.PipelineRun{}, err
+	}
+
+	input.Status = model.RunStatusQueued
+	run, err := e.store.CreateRun(ctx, input)
 	if err != nil {
 		return model.PipelineRun{}, err
 	}
@@ -100,11 +145,49 @@ func (e *Executor) Trigger(ctx context.Context, projectID int64, triggerType, tr
 	e.cancelFuncs[run.ID] = cancel
 	e.cancelMutex.Unlock()
 
-	go e.execute(runCtx, run.ID, projectID, triggerType, triggerRef)
+	go e.execute(runCtx, run.ID, input.ProjectID, input.TriggerType, input.TriggerRef)
 	return run, nil
 }
 
-func (e *Executor) CancelRun(ctx context.Context, runID int64) (model.PipelineRun, error) {
+// RecordSkippedRun stores a trigger that was received but intentionally not
+// executed, so the run history still shows that the webhook arrived.
+func (e *Executor) RecordSkippedRun(ctx context.Context, projectID int64, triggerType, triggerRef, reason string) (model.PipelineRun, error) {
+	run, err := e.store.CreateRun(ctx, model.RunCreateInput{
+		ProjectID:   projectID,
+		Status:      model.RunStatusSkipped,
+		TriggerType: triggerType,
+		TriggerRef:  triggerRef,
+	})
+	if err != nil {
+		return model.PipelineRun{}, err
+	}
+
+	if err := e.appendRunLog(ctx, run.ID, model.LogLevelInfo, "pipeline skipped: "+reason); err != nil {
+		return model.PipelineRun{}, err
+	}
+	if err := e.finalizeRun(ctx, run.ID, model.RunStatusSkipped, ""); err != nil {
+		return model.PipelineRun{}, err
+	}
+
+	return e.store.GetRun(ctx, run.ID)
+}
+
+// MatchSkipMarker returns the global or project skip marker found in the
+// commit message, or "" when the commit should be built.
+func (e *Executor) MatchSkipMarker(ctx context.Context, project model.Project, message string) (string, error) {
+	if strings.TrimSpace(message) == "" {
+		return "", nil
+	}
+	value, err := e.store.GetSettingValue(ctx, model.SettingSkipCIMarkers)
+	if err != nil {
+		return "", fmt.Errorf("load skip ci markers setting: %w", err)
+	}
+	markers := append(model.ParseSkipCIMarkersSetting(value), project.SkipMarkers...)
+	return model.FindSkipMarker(message, markers), nil
+}
+
+// CancelRun stops a queued or running run on behalf of username.
+func (e *Executor) CancelRun(ctx context.Context, runID int64, username string) (model.PipelineRun, error) {
 	run, err := e.store.GetRun(ctx, runID)
 	if err != nil {
 		return model.PipelineRun{}, err
@@ -123,13 +206,19 @@ func (e *Executor) CancelRun(ctx context.Context, runID int64) (model.PipelineRu
 	}
 	e.cancelMutex.Unlock()
 
+	if err := e.store.SetRunCancelledBy(ctx, runID, username); err != nil {
+		return model.PipelineRun{}, err
+	}
+
 	errorMessage := "deployment cancelled manually"
-	if err := e.store.FinalizeRun(ctx, runID, model.RunStatusFailed, errorMessage); err != nil {
+	if username != "" {
+		errorMessage = "deployment cancelled manually by " + username
+	}
+	if err := e.finalizeRun(ctx, runID, model.RunStatusFailed, errorMessage); err != nil {
 		return model.PipelineRun{}, err
 	}
 
-	logLine := fmt.Sprintf("[%s] %s\n", time.Now().Local().Format("2006-01-02 15:04:05"), errorMessage)
-	if err := e.store.AppendRunLog(ctx, runID, logLine); err != nil {
+	if err := e.appendRunLog(ctx, runID, model.LogLevelWarn, errorMessage); err != nil {
 		return model.PipelineRun{}, err
 	}
 
@@ -140,51 +229,111 @@ func (e *Executor) cleanupRunFiles(runID int64) {
 	paths := []string{
 		filepath.Join(e.workspaceRoot, fmt.Sprintf("run-%d", runID)),
 		filepath.Join(e.artifactRoot, fmt.Sprintf("run-%d", runID)),
-		filepath.Join(e.artifactRoot, fmt.Sprintf("run-%d.tgz", runID)),
 	}
-
 	for _, target := range paths {
 		if err := os.RemoveAll(target); err != nil {
 			e.logger.Warn("清理任务目录失败 (cleanup run files failed)", "run_id", runID, "path", target, "error", err)
 		}
 	}
+	// 开启制品保留时归档留到过期后再由 PruneArtifacts 清理
+	if e.artifactRetentionDays(context.Background()) == 0 {
+		if err := e.removeArtifact(context.Background(), runID); err != nil {
+			e.logger.Warn("清理任务目录失败 (cleanup run files failed)", "run_id", runID, "path", e.ArtifactPath(runID), "error", err)
+		}
+	}
+	if err := e.PruneArtifacts(context.Background()); err != nil {
+		e.logger.Warn("prune artifacts failed", "error", err)
+	}
+}
+
+// continueAfterCheckout decides whether a run goes ahead once its commit
+// message is known, and only then stops the runs it supersedes: a commit that
+// turns out to be skipped must not interrupt a deployment in progress.
+func (e *Executor) continueAfterCheckout(ctx context.Context, runID int64, project model.Project, triggerType, commitMessage string) error {
+	// 推送载荷中没有提交信息时，在克隆后根据实际的提交说明再判断一次
+	if triggerType == model.TriggerTypeWebhook {
+		marker, err := e.MatchSkipMarker(ctx, project, commitMessage)
+		if err != nil {
+			return err
+		}
+		if marker != "" {
+			return &skippedRunError{marker: marker}
+		}
+	}
+
+	current, err := e.store.GetRunSummary(ctx, runID)
+	if err != nil {
+		return fmt.Errorf("load run: %w", err)
+	}
+	e.cancelRunningDeployments(ctx, current)
+	return nil
 }
 
-func (e *Executor) cancelRunningDeployments(ctx context.Context, projectID int64) {
-	// 获取运行中的部署，只需要获取最近100条记录
-	runs, err := e.store.ListAllRuns(ctx, 0, 100)
+// cancelRunningDeployments stops earlier runs of the same project that current
+// supersedes. Pull request runs only replace earlier runs of the same PR and
+// never interrupt a deployment.
+// maxSupersededRuns bounds how many running runs of one project are examined;
+// the executor never has more than a handful in flight.
+const maxSupersededRuns = 100
+
+func (e *Executor) cancelRunningDeployments(ctx context.Context, current model.PipelineRun) {
+	runs, err := e.store.ListRuns(ctx, model.RunFilter{
+		ProjectID: current.ProjectID,
+		Statuses:  []string{model.RunStatusRunning},
+	}, 0, maxSupersededRuns)
 	if err != nil {
-		e.logger.Error("list runs for cancellation failed", "project_id", projectID, "error", err)
+		e.logger.Error("list runs for cancellation failed", "project_id", current.ProjectID, "error", err)
 		return
 	}
 
+	reason := "deployment cancelled by new deployment"
+	if current.TriggerType == model.TriggerTypePullRequest {
+		reason = "pull request build cancelled by newer push"
+	}
+
 	for _, run := range runs {
-		if run.ProjectID == projectID && run.Status == model.RunStatusRunning {
-			e.logger.Info("cancelling running deployment", "run_id", run.ID, "project_id", projectID)
-
-			// 调用取消函数
-			e.cancelMutex.Lock()
-			if cancel, exists := e.cancelFuncs[run.ID]; exists {
-				cancel()
-				delete(e.cancelFuncs, run.ID)
-			}
-			e.cancelMutex.Unlock()
+		if run.ProjectID != current.ProjectID || run.Status != model.RunStatusRunning || !supersedesRun(current, run) {
+			continue
+		}
+		e.logger.Info("cancelling running deployment", "run_id", run.ID, "project_id", current.ProjectID)
 
-			// 更新数据库状态
-			if err := e.store.FinalizeRun(ctx, run.ID, model.RunStatusFailed, "deployment cancelled by new deployment"); err != nil {
-				e.logger.Error("finalize cancelled run failed", "run_id", run.ID, "error", err)
-			}
+		// 调用取消函数
+		e.cancelMutex.Lock()
+		if cancel, exists := e.cancelFuncs[run.ID]; exists {
+			cancel()
+			delete(e.cancelFuncs, run.ID)
+		}
+		e.cancelMutex.Unlock()
 
-			// 记录取消日志
-			logLine := fmt.Sprintf("[%s] deployment cancelled by new deployment\n", time.Now().Local().Format("2006-01-02 15:04:05"))
-			if err := e.store.AppendRunLog(ctx, run.ID, logLine); err != nil {
-				e.logger.Error("append cancellation log failed", "run_id", run.ID, "error", err)
-			}
+		// 更新数据库状态
+		if err := e.finalizeRun(ctx, run.ID, model.RunStatusFailed, reason); err != nil {
+			e.logger.Error("finalize cancelled run failed", "run_id", run.ID, "error", err)
+		}
+
+		// 记录取消日志
+		if err := e.appendRunLog(ctx, run.ID, model.LogLevelWarn, reason); err != nil {
+			e.logger.Error("append cancellation log failed", "run_id", run.ID, "error", err)
 		}
 	}
 }
 
+// supersedesRun reports whether current replaces run. Only earlier runs are
+// replaced, since runs now reach this point after cloning and a newer run may
+// get there first.
+func supersedesRun(current, run model.PipelineRun) bool {
+	if run.ID >= current.ID {
+		return false
+	}
+	if current.TriggerType != model.TriggerTypePullRequest {
+		return run.TriggerType != model.TriggerTypePullRequest
+	}
+	return run.PullRequestNumber != nil && current.PullRequestNumber != nil && *run.PullRequestNumber == *current.PullRequestNumber
+}
+
 func (e *Executor) execute(ctx context.Context, runID, projectID int64, triggerType, triggerRef string) {
+	// End 需在日志写入器关闭之后执行，订阅方收到结束事件时日志已全部落库
+	e.logHub.Begin(runID)
+	defer e.logHub.End(runID)
 	defer e.cleanupRunFiles(runID)
 
 	// 清理取消函数
@@ -198,21 +347,20 @@ func (e *Executor) execute(ctx context.Context, runID, projectID int64, triggerT
 		e.logger.Error("mark run running failed", "run_id", runID, "error", err)
 		return
 	}
+	e.logHub.PublishStatus(runID)
 
 	bundle, err := e.store.GetExecutionBundle(ctx, projectID)
 	if err != nil {
-		_ = e.store.FinalizeRun(ctx, runID, model.RunStatusFailed, err.Error())
+		_ = e.finalizeRun(ctx, runID, model.RunStatusFailed, err.Error())
 		e.logger.Error("load execution bundle failed", "run_id", runID, "error", err)
 		return
 	}
 
-	logf := func(format string, args ...any) {
-		line := fmt.Sprintf("[%s] %s\n", time.Now().Local().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
-		if appendErr := e.store.AppendRunLog(ctx, runID, line); appendErr != nil {
-			e.logger.Error("append run log failed", "run_id", runID, "error", appendErr)
-		}
-		e.logger.Info("pipeline", "run_id", runID, "message", strings.TrimSpace(fmt.Sprintf(format, args...)))
-	}
+	logWriter := newRunLogWriter(e.store, e.logHub, e.logger, runID)
+	defer logWriter.Close()
+
+	runLog := newRunLogger(logWriter, e.logger, runID)
+	logf := runLog.logf
 
 	logf("pipeline start: project=%s branch=%s trigger=%s", bundle.Project.Name, bundle.Project.Branch, triggerType)
 	startedAt := time.Now()
@@ -226,39 +374,65 @@ func (e *Executor) execute(ctx context.Context, runID, projectID int64, triggerT
 	defer cancelTimeout()
 
 	// 使用带超时的context执行pipeline
-	result, execErr := e.runPipeline(timeoutCtx, runID, bundle, logf)
+	result, execErr := e.runPipeline(timeoutCtx, runID, bundle, triggerType, triggerRef, runLog)
 	result.DurationSeconds = int64(time.Since(startedAt).Seconds())
 	finalStatus := model.RunStatusSuccess
 	finalError := ""
 
+	var skipErr *skippedRunError
+	if errors.As(execErr, &skipErr) {
+		logf("pipeline skipped: %v", skipErr)
+		logWriter.Flush()
+		if err := e.finalizeRun(ctx, runID, model.RunStatusSkipped, ""); err != nil {
+			e.logger.Error("finalize run failed", "run_id", runID, "error", err)
+			return
+		}
+		logf("pipeline finalized with status=%s", model.RunStatusSkipped)
+		return
+	}
+
 	if execErr != nil {
 		// 检查是否是超时错误
 		if timeoutCtx.Err() == context.DeadlineExceeded {
 			finalStatus = model.RunStatusFailed
 			finalError = fmt.Sprintf("deployment timeout after %d seconds", bundle.DeployConfig.TimeoutSeconds)
-			logf("deployment timeout after %d seconds", bundle.DeployConfig.TimeoutSeconds)
+			runLog.errorf("deployment timeout after %d seconds", bundle.DeployConfig.TimeoutSeconds)
 		} else if ctx.Err() == context.Canceled {
-			// 被手动取消，不需要记录错误
+			// 被手动取消，不需要记录错误；运行上下文已取消，提交状态改用独立上下文回写
+			if err := e.reportCommitStatus(context.WithoutCancel(ctx), bundle.Project, runID, result.CommitID, gitprovider.StateFailure, "deployment cancelled"); err != nil {
+				e.logger.Warn("report commit status failed", "run_id", runID, "error", err)
+			}
 			return
 		} else {
 			finalStatus = model.RunStatusFailed
 			finalError = execErr.Error()
-			logf("pipeline failed at stage=%s: %v", displayStage(result.Stage), execErr)
+			runLog.errorf("pipeline failed at stage=%s: %v", displayStage(result.Stage), execErr)
 		}
 	} else {
 		logf("pipeline finished without stage error")
 	}
 
+	statusState, statusDescription := gitprovider.StateSuccess, "pipeline succeeded"
+	if finalStatus != model.RunStatusSuccess {
+		statusState, statusDescription = gitprovider.StateFailure, fmt.Sprintf("pipeline failed at stage %s", displayStage(result.Stage))
+	}
+	if err := e.reportCommitStatus(ctx, bundle.Project, runID, result.CommitID, statusState, statusDescription); err != nil {
+		runLog.warnf("commit status update failed: %v", err)
+	}
+
+	runLog.setStage("notification")
 	notifyStatus := finalStatus
 	notifyErr := e.sendNotification(ctx, bundle, runID, notifyStatus, finalError, triggerType, triggerRef, result, logf)
 	if notifyErr != nil {
-		logf("notification failed: %v", notifyErr)
-		logf("notification failure ignored, keeping deployment status=%s", finalStatus)
+		runLog.warnf("notification failed: %v", notifyErr)
+		runLog.warnf("notification failure ignored, keeping deployment status=%s", finalStatus)
 	} else {
 		logf("notification stage completed")
 	}
+	runLog.setStage("")
 
-	if err := e.store.FinalizeRun(ctx, runID, finalStatus, finalError); err != nil {
+	logWriter.Flush()
+	if err := e.finalizeRun(ctx, runID, finalStatus, finalError); err != nil {
 		e.logger.Error("finalize run failed", "run_id", runID, "error", err)
 		return
 	}
@@ -266,8 +440,37 @@ func (e *Executor) execute(ctx context.Context, runID, projectID int64, triggerT
 	logf("pipeline finalized with status=%s", finalStatus)
 }
 
-func (e *Executor) runPipeline(ctx context.Context, runID int64, bundle model.ExecutionBundle, logf func(string, ...any)) (pipelineResult, error) {
+// appendRunLog stores a system log entry outside of a running pipeline and
+// publishes it to live subscribers.
+func (e *Executor) appendRunLog(ctx context.Context, runID int64, level, text string) error {
+	entries := splitRunLogEntry(model.RunLogEntry{
+		Time:   time.Now(),
+		Source: model.LogSourceSystem,
+		Level:  level,
+		Text:   text,
+	})
+	if _, err := e.store.AppendRunLogEntries(ctx, runID, entries); err != nil {
+		return err
+	}
+	e.logHub.PublishLines(runID, entries)
+	return nil
+}
+
+func (e *Executor) finalizeRun(ctx context.Context, runID int64, status, errorMessage string) error {
+	if err := e.store.FinalizeRun(ctx, runID, status, errorMessage); err != nil {
+		return err
+	}
+	e.logHub.PublishStatus(runID)
+	return nil
+}
+
+func (e *Executor) runPipeline(ctx context.Context, runID int64, bundle model.ExecutionBundle, triggerType, triggerRef string, runLog *runLogger) (pipelineResult, error) {
 	result := pipelineResult{}
+	logf := runLog.logf
+	enterStage := func(stage string) {
+		result.Stage = stage
+		runLog.setStage(stage)
+	}
 	workspaceDir := filepath.Join(e.workspaceRoot, fmt.Sprintf("run-%d", runID))
 	sourceDir := filepath.Join(workspaceDir, "source")
 	artifactDir := filepath.Join(e.artifactRoot, fmt.Sprintf("run-%d", runID))
@@ -285,9 +488,15 @@ func (e *Executor) runPipeline(ctx context.Context, runID int64, bundle model.Ex
 		return result, fmt.Errorf("create artifact dir: %w", err)
 	}
 
-	result.Stage = "git-clone"
+	isPullRequest := triggerType == model.TriggerTypePullRequest
+	checkoutRef := ""
+	if isPullRequest {
+		checkoutRef = triggerRef
+	}
+
+	enterStage("git-clone")
 	logf("stage git-clone: cloning %s#%s", bundle.Project.RepoURL, bundle.Project.Branch)
-	if err := e.runGitCloneWithAuth(ctx, bundle.Project, sourceDir, logf); err != nil {
+	if err := e.runGitCloneWithAuth(ctx, bundle.Project, sourceDir, checkoutRef, logf); err != nil {
 		return result, fmt.Errorf("git clone failed: %w", err)
 	}
 
@@ -297,12 +506,23 @@ func (e *Executor) runPipeline(ctx context.Context, runID int64, bundle model.Ex
 		result.Author = commitInfo.Author
 		if result.CommitID != "" {
 			logf("git metadata: commit=%s author=%s", shortCommit(result.CommitID), result.Author)
+			if err := e.store.SetRunCommit(ctx, runID, result.CommitID, result.CommitMessage, result.Author); err != nil {
+				runLog.warnf("record run commit failed: %v", err)
+			}
 		}
 	} else {
-		logf("git metadata unavailable: %v", err)
+		runLog.warnf("git metadata unavailable: %v", err)
 	}
 
-	result.Stage = "build"
+	if err := e.continueAfterCheckout(ctx, runID, bundle.Project, triggerType, result.CommitMessage); err != nil {
+		return result, err
+	}
+
+	if err := e.reportCommitStatus(ctx, bundle.Project, runID, result.CommitID, gitprovider.StatePending, "pipeline running"); err != nil {
+		runLog.warnf("commit status update failed: %v", err)
+	}
+
+	enterStage("build")
 	logf("stage build: image=%s", bundle.DeployConfig.BuildImage)
 	cacheDirs, err := e.loadBuildCacheDirs(ctx)
 	if err != nil {
@@ -312,19 +532,26 @@ func (e *Executor) runPipeline(ctx context.Context, runID int64, bundle model.Ex
 		return result, fmt.Errorf("docker build stage failed: %w", err)
 	}
 
-	result.Stage = "artifact-filter"
+	// PR/MR 只做构建校验，不产出制品也不部署
+	if isPullRequest {
+		logf("pull request run: skipping artifact-filter and deploy stages")
+		enterStage("completed")
+		return result, nil
+	}
+
+	enterStage("artifact-filter")
 	logf("stage artifact-filter: mode=%s rules=%d", bundle.DeployConfig.ArtifactFilterMode, len(bundle.DeployConfig.ArtifactRules))
 	if err := filterArtifacts(sourceDir, artifactDir, bundle.DeployConfig.ArtifactFilterMode, bundle.DeployConfig.ArtifactRules); err != nil {
 		return result, fmt.Errorf("filter artifacts: %w", err)
 	}
 
-	result.Stage = "deploy"
+	enterStage("deploy")
 	logf("stage deploy: host=%s:%d", bundle.Host.Address, bundle.Host.Port)
-	if err := e.deployToRemote(bundle, artifactDir, runID, logf); err != nil {
+	if err := e.deployToRemote(ctx, bundle, artifactDir, runID, logf); err != nil {
 		return result, err
 	}
 
-	result.Stage = "completed"
+	enterStage("completed")
 	return result, nil
 }
 
@@ -361,8 +588,8 @@ func (e *Executor) runLocalCommandWithLogging(ctx context.Context, logf func(str
 		return fmt.Errorf("start command: %w", err)
 	}
 
-	go e.streamCommandOutput(stdoutPipe, logf)
-	go e.streamCommandOutput(stderrPipe, logf)
+	go e.streamCommandOutput(stdoutPipe, model.LogSourceStdout, logf)
+	go e.streamCommandOutput(stderrPipe, model.LogSourceStderr, logf)
 
 	if err := cmd.Wait(); err != nil {
 		return fmt.Errorf("command failed: %w", err)
@@ -645,7 +872,7 @@ func filterArtifacts(sourceDir, artifactDir, mode string, rules []string) error
 	})
 }
 
-func (e *Executor) deployToRemote(bundle model.ExecutionBundle, artifactDir string, runID int64, logf func(string, ...any)) error {
+func (e *Executor) deployToRemote(ctx context.Context, bundle model.ExecutionBundle, artifactDir string, runID int64, logf func(string, ...any)) error {
 	if err := validateRemoteDir(bundle.DeployConfig.RemoteSaveDir); err != nil {
 		return fmt.Errorf("invalid remote save dir: %w", err)
 	}
@@ -678,15 +905,24 @@ func (e *Executor) deployToRemote(bundle model.ExecutionBundle, artifactDir stri
 		sanitizeName(bundle.Project.Name),
 		fmt.Sprintf("run-%d", runID),
 	)
-	localArchivePath := filepath.Join(e.artifactRoot, fmt.Sprintf("run-%d.tgz", runID))
-	defer os.Remove(localArchivePath)
+	localArchivePath := e.ArtifactPath(runID)
 
 	logf("deploy preparing remote save dir: %s", saveRunDir)
 	archiveEntries, archiveSize, err := createArtifactArchive(artifactDir, localArchivePath)
 	if err != nil {
 		return fmt.Errorf("package artifacts: %w", err)
 	}
-	logf("artifact archive created: entries=%d size=%d bytes", archiveEntries, archiveSize)
+	archiveSHA256, err := fileSHA256(localArchivePath)
+	if err != nil {
+		return fmt.Errorf("checksum artifact archive: %w", err)
+	}
+	logf("artifact archive created: entries=%d size=%d bytes sha256=%s", archiveEntries, archiveSize, archiveSHA256)
+	// 运行记录上的制品信息表示归档可以下载，不保留归档时运行结束就会删除，不记录
+	if e.artifactRetentionDays(ctx) > 0 {
+		if err := e.store.SetRunArtifact(ctx, runID, archiveSize, archiveSHA256); err != nil {
+			logf("record run artifact failed: %v", err)
+		}
+	}
 
 	remoteArchivePath := path.Join(saveRunDir, "artifacts.tgz")
 	if err = uploadFile(sftpClient, localArchivePath, remoteArchivePath, logf); err != nil {
@@ -1038,8 +1274,8 @@ func runRemoteCommandWithLogging(client *ssh.Client, command string, logf func(s
 		return fmt.Errorf("start command: %w", err)
 	}
 
-	go streamCommandOutput(stdoutPipe, logf)
-	go streamCommandOutput(stderrPipe, logf)
+	go streamCommandOutput(stdoutPipe, model.LogSourceRemote, logf)
+	go streamCommandOutput(stderrPipe, model.LogSourceRemote, logf)
 
 	if err := session.Wait(); err != nil {
 		return fmt.Errorf("command failed: %w", err)
@@ -1355,7 +1591,10 @@ func sanitizeName(value string) string {
 	return value
 }
 
-func (e *Executor) runGitCloneWithAuth(ctx context.Context, project model.Project, sourceDir string, logf func(string, ...any)) error {
+// runGitCloneWithAuth clones the project branch into sourceDir. When
+// checkoutRef is set (pull request runs) that ref is fetched afterwards and
+// checked out as a detached HEAD.
+func (e *Executor) runGitCloneWithAuth(ctx context.Context, project model.Project, sourceDir, checkoutRef string, logf func(string, ...any)) error {
 	absWorkspaceDir, err := filepath.Abs(filepath.Dir(sourceDir))
 	if err != nil {
 		return fmt.Errorf("resolve git workspace dir: %w", err)
@@ -1386,6 +1625,7 @@ func (e *Executor) runGitCloneWithAuth(ctx context.Context, project model.Projec
 		containerSourceDir,
 	}
 	extraArgs := []string{}
+	configArgs := []string{}
 
 	switch project.GitAuthType {
 	case "", model.GitAuthTypeNone:
@@ -1408,14 +1648,35 @@ func (e *Executor) runGitCloneWithAuth(ctx context.Context, project model.Projec
 
 		containerKeyPath := "/tmp/git_ssh_key"
 		extraArgs = append(extraArgs, "-v", fmt.Sprintf("%s:%s:ro", filepath.ToSlash(sshKeyFile), containerKeyPath))
-		gitArgs = append([]string{
+		configArgs = []string{
 			"-c",
 			fmt.Sprintf("core.sshCommand=ssh -i %s -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null", containerKeyPath),
-		}, gitArgs...)
+		}
 	default:
 		return fmt.Errorf("unsupported git authentication type: %s", project.GitAuthType)
 	}
 
+	commands := [][]string{append(append([]string{}, configArgs...), gitArgs...)}
+	if checkoutRef != "" {
+		// 克隆时写入的 origin 已包含认证信息，SSH 认证则复用同一组 -c 参数
+		commands = append(commands,
+			append(append([]string{}, configArgs...), "-C", containerSourceDir, "fetch", "--depth", "1", "origin", checkoutRef),
+			[]string{"-C", containerSourceDir, "checkout", "--detach", "FETCH_HEAD"},
+		)
+	}
+
+	for _, command := range commands {
+		if err := e.runDockerGitWithFallback(ctx, absWorkspaceDir, candidateImages, command, envArgs, extraArgs, logf); err != nil {
+			return err
+		}
+	}
+	if checkoutRef != "" {
+		logf("stage git-clone: checked out %s", checkoutRef)
+	}
+	return nil
+}
+
+func (e *Executor) runDockerGitWithFallback(ctx context.Context, absWorkspaceDir string, candidateImages, gitArgs, envArgs, extraArgs []string, logf func(string, ...any)) error {
 	var lastErr error
 	for _, candidateImage := range candidateImages {
 		logf("stage git-clone: trying image source=%s", candidateImage)
@@ -1558,6 +1819,26 @@ func displayStage(stage string) string {
 	}
 }
 
+// reportCommitStatus posts the run state to the project's Git provider. It is a
+// no-op when commit statuses are not configured or the commit is unknown;
+// failures are returned for logging only and never fail the run.
+func (e *Executor) reportCommitStatus(ctx context.Context, project model.Project, runID int64, commitID, state, description string) error {
+	if project.CommitStatusProvider == model.CommitStatusProviderNone || commitID == "" {
+		return nil
+	}
+	return e.statusClient.SetCommitStatus(ctx, gitprovider.Target{
+		Provider: project.CommitStatusProvider,
+		APIURL:   project.CommitStatusAPIURL,
+		Token:    project.CommitStatusToken,
+		RepoURL:  project.RepoURL,
+	}, commitID, gitprovider.CommitStatus{
+		State:       state,
+		TargetURL:   e.buildRunURL(ctx, runID),
+		Description: description,
+		Context:     version.AppName,
+	})
+}
+
 func (e *Executor) buildRunURL(ctx context.Context, runID int64) string {
 	baseURL, err := e.store.GetSettingValue(ctx, model.SettingPublicBaseURL)
 	if err != nil {
@@ -1573,18 +1854,18 @@ func (e *Executor) buildRunURL(ctx context.Context, runID int64) string {
 	return fmt.Sprintf("%s/?view=logs&run_id=%d", baseURL, runID)
 }
 
-func (e *Executor) streamCommandOutput(reader io.Reader, logf func(string, ...any)) {
-	streamCommandOutput(reader, logf)
+func (e *Executor) streamCommandOutput(reader io.Reader, source string, logf func(string, ...any)) {
+	streamCommandOutput(reader, source, logf)
 }
 
-func streamCommandOutput(reader io.Reader, logf func(string, ...any)) {
+func streamCommandOutput(reader io.Reader, source string, logf func(string, ...any)) {
 	scanner := bufio.NewScanner(reader)
 	scanner.Buffer(make([]byte, 0, 64*1024), maxCommandLogTokenSize)
 	scanner.Split(scanCommandLines)
 	for scanner.Scan() {
 		line := sanitizeCommandLogLine(scanner.Text())
 		if line != "" {
-			logf("%s", line)
+			logf("%s", commandOutput{source: source, text: line})
 		}
 	}
 }
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	cryptoutil "devops-pipeline/internal/crypto"
+	"devops-pipeline/internal/model"
+	"devops-pipeline/internal/store"
+)
+
+func newTestExecutor(t *testing.T) (*Executor, *store.Store) {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := store.Open(store.DriverSQLite, filepath.Join(dir, "pipeline.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	st := store.New(db, cryptoutil.New("test"), store.DriverSQLite)
+	if err := st.Migrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewExecutor(st, logger, dir, dir, dir), st
+}
+
+// startTestRun creates a webhook run that the executor considers in flight
+// and reports whether its context was cancelled.
+func startTestRun(t *testing.T, e *Executor, st *store.Store, projectID int64) (model.PipelineRun, func() bool) {
+	t.Helper()
+	ctx := context.Background()
+	run, err := st.CreateRun(ctx, model.RunCreateInput{
+		ProjectID:   projectID,
+		Status:      model.RunStatusQueued,
+		TriggerType: model.TriggerTypeWebhook,
+		TriggerRef:  "refs/heads/main",
+	})
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := st.MarkRunRunning(ctx, run.ID); err != nil {
+		t.Fatalf("mark run running: %v", err)
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	e.cancelMutex.Lock()
+	e.cancelFuncs[run.ID] = cancel
+	e.cancelMutex.Unlock()
+	return run, func() bool { return runCtx.Err() != nil }
+}
+
+func TestSkippedCommitDoesNotCancelRunningDeployment(t *testing.T) {
+	ctx := context.Background()
+	e, st := newTestExecutor(t)
+	project, err := st.CreateProject(ctx, model.ProjectUpsert{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main"})
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+
+	deploying, cancelled := startTestRun(t, e, st, project.ID)
+	// 推送载荷里没有提交说明，克隆后才知道这是一个 [skip ci] 提交
+	skipped, _ := startTestRun(t, e, st, project.ID)
+	var skipErr *skippedRunError
+	if err := e.continueAfterCheckout(ctx, skipped.ID, project, model.TriggerTypeWebhook, "docs: typo [skip ci]"); !errors.As(err, &skipErr) {
+		t.Fatalf("expected the run to be skipped, got %v", err)
+	}
+	if cancelled() {
+		t.Fatal("expected the running deployment to keep running")
+	}
+	if run, err := st.GetRunSummary(ctx, deploying.ID); err != nil || run.Status != model.RunStatusRunning {
+		t.Fatalf("expected the deployment to stay running, got %q (%v)", run.Status, err)
+	}
+
+	next, _ := startTestRun(t, e, st, project.ID)
+	if err := e.continueAfterCheckout(ctx, next.ID, project, model.TriggerTypeWebhook, "feat: ship it"); err != nil {
+		t.Fatalf("continue after checkout: %v", err)
+	}
+	if !cancelled() {
+		t.Fatal("expected a newer deployment to cancel the running one")
+	}
+	if run, err := st.GetRunSummary(ctx, deploying.ID); err != nil || run.Status != model.RunStatusFailed {
+		t.Fatalf("expected the superseded deployment to fail, got %q (%v)", run.Status, err)
+	}
+}
+
+func TestSupersedesOnlyEarlierRuns(t *testing.T) {
+	current := model.PipelineRun{ID: 5, TriggerType: model.TriggerTypeWebhook}
+	if !supersedesRun(current, model.PipelineRun{ID: 4, TriggerType: model.TriggerTypeManual}) {
+		t.Fatal("expected an earlier deployment to be superseded")
+	}
+	if supersedesRun(current, model.PipelineRun{ID: 6, TriggerType: model.TriggerTypeWebhook}) {
+		t.Fatal("expected a newer run not to be superseded")
+	}
+	if supersedesRun(current, current) {
+		t.Fatal("expected a run not to supersede itself")
+	}
+	if supersedesRun(current, model.PipelineRun{ID: 4, TriggerType: model.TriggerTypePullRequest}) {
+		t.Fatal("expected a push not to cancel a pull request build")
+	}
+}
@@ -0,0 +1,238 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-pipeline/internal/logstream"
+	"devops-pipeline/internal/model"
+)
+
+const (
+	runLogFlushInterval = 500 * time.Millisecond
+	runLogBatchLines    = 200
+	// runLogFlushAttempts 是一批日志写入失败后最多尝试的次数，之后放弃并记录丢失的行数
+	runLogFlushAttempts = 5
+)
+
+// runLogStore is the part of the store the writer needs.
+type runLogStore interface {
+	AppendRunLogEntries(ctx context.Context, runID int64, entries []model.RunLogEntry) (int64, error)
+}
+
+// runLogWriter batches run log entries and writes them as chunks, either when
+// runLogBatchLines lines are pending or every runLogFlushInterval.
+type runLogWriter struct {
+	store  runLogStore
+	hub    *logstream.Hub
+	logger *slog.Logger
+	runID  int64
+
+	mu      sync.Mutex
+	pending []model.RunLogEntry
+	// failures 是连续写入失败的次数；失败期间只由定时器重试，不再按行数触发
+	failures int
+	// flushMu 保证分片按行的先后顺序写入
+	flushMu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newRunLogWriter(store runLogStore, hub *logstream.Hub, logger *slog.Logger, runID int64) *runLogWriter {
+	writer := &runLogWriter{
+		store:  store,
+		hub:    hub,
+		logger: logger,
+		runID:  runID,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go writer.loop()
+	return writer
+}
+
+func (w *runLogWriter) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(runLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.stop:
+			// 结束前把失败的批次重试完，重试次数同样有上限
+			for w.flush() {
+				time.Sleep(runLogFlushInterval)
+			}
+			return
+		}
+	}
+}
+
+// Append queues entry; embedded newlines in its text start new entries that
+// share the same metadata.
+func (w *runLogWriter) Append(entry model.RunLogEntry) {
+	entries := splitRunLogEntry(entry)
+
+	w.mu.Lock()
+	w.pending = append(w.pending, entries...)
+	full := len(w.pending) >= runLogBatchLines && w.failures == 0
+	w.mu.Unlock()
+
+	if full {
+		w.Flush()
+	}
+}
+
+// Flush writes all pending lines. It uses a background context so the tail of
+// a cancelled or timed out run is still persisted.
+func (w *runLogWriter) Flush() {
+	w.flush()
+}
+
+// flush writes the pending lines and reports whether a failed batch was put
+// back to be retried. Lines are only published to the live stream once they
+// are stored, so both see the same log.
+func (w *runLogWriter) flush() (retry bool) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	entries := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	if len(entries) == 0 {
+		return false
+	}
+	_, err := w.store.AppendRunLogEntries(context.Background(), w.runID, entries)
+
+	w.mu.Lock()
+	if err == nil {
+		w.failures = 0
+		w.mu.Unlock()
+		w.hub.PublishLines(w.runID, entries)
+		return false
+	}
+	w.failures++
+	attempt := w.failures
+	if attempt < runLogFlushAttempts {
+		// 放回队首，保持行的先后顺序
+		w.pending = append(entries, w.pending...)
+		w.mu.Unlock()
+		w.logger.Warn("append run log failed, will retry", "run_id", w.runID, "lines", len(entries), "attempt", attempt, "error", err)
+		return true
+	}
+	w.failures = 0
+	w.mu.Unlock()
+
+	w.logger.Error("append run log failed, lines dropped", "run_id", w.runID, "lines", len(entries), "attempts", attempt, "error", err)
+	w.recordLostLines(entries)
+	return false
+}
+
+// recordLostLines leaves a note in the run log where lines had to be
+// dropped. It is written once; if that fails too only the server log has it.
+func (w *runLogWriter) recordLostLines(lost []model.RunLogEntry) {
+	notice := []model.RunLogEntry{{
+		Time:   time.Now(),
+		Stage:  lost[len(lost)-1].Stage,
+		Source: model.LogSourceSystem,
+		Level:  model.LogLevelError,
+		Text:   fmt.Sprintf("%d log lines could not be saved after %d attempts and were lost", len(lost), runLogFlushAttempts),
+	}}
+	if _, err := w.store.AppendRunLogEntries(context.Background(), w.runID, notice); err != nil {
+		w.logger.Error("append run log notice failed", "run_id", w.runID, "error", err)
+		return
+	}
+	w.hub.PublishLines(w.runID, notice)
+}
+
+func splitRunLogEntry(entry model.RunLogEntry) []model.RunLogEntry {
+	lines := strings.Split(strings.TrimSuffix(entry.Text, "\n"), "\n")
+	entries := make([]model.RunLogEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = entry
+		entries[i].Text = line
+	}
+	return entries
+}
+
+// Close flushes the remaining lines, retrying a failed batch, and stops the
+// background flusher.
+func (w *runLogWriter) Close() {
+	close(w.stop)
+	<-w.done
+}
+
+// commandOutput is a line read from a command's output stream. Passing it as
+// the only argument of a logf call tags the entry with its source instead of
+// model.LogSourceSystem.
+type commandOutput struct {
+	source string
+	text   string
+}
+
+func (o commandOutput) String() string {
+	return o.text
+}
+
+// runLogger turns pipeline log calls into structured entries tagged with the
+// stage that is currently executing.
+type runLogger struct {
+	writer *runLogWriter
+	logger *slog.Logger
+	runID  int64
+
+	mu    sync.Mutex
+	stage string
+}
+
+func newRunLogger(writer *runLogWriter, logger *slog.Logger, runID int64) *runLogger {
+	return &runLogger{writer: writer, logger: logger, runID: runID}
+}
+
+func (l *runLogger) setStage(stage string) {
+	l.mu.Lock()
+	l.stage = stage
+	l.mu.Unlock()
+}
+
+func (l *runLogger) logf(format string, args ...any) {
+	l.log(model.LogLevelInfo, format, args...)
+}
+
+func (l *runLogger) warnf(format string, args ...any) {
+	l.log(model.LogLevelWarn, format, args...)
+}
+
+func (l *runLogger) errorf(format string, args ...any) {
+	l.log(model.LogLevelError, format, args...)
+}
+
+func (l *runLogger) log(level, format string, args ...any) {
+	l.mu.Lock()
+	stage := l.stage
+	l.mu.Unlock()
+
+	entry := model.RunLogEntry{
+		Time:   time.Now(),
+		Stage:  stage,
+		Source: model.LogSourceSystem,
+		Level:  level,
+		Text:   fmt.Sprintf(format, args...),
+	}
+	if len(args) == 1 {
+		if output, ok := args[0].(commandOutput); ok {
+			entry.Source = output.source
+		}
+	}
+	l.writer.Append(entry)
+	l.logger.Info("pipeline", "run_id", l.runID, "stage", stage, "level", level, "message", strings.TrimSpace(entry.Text))
+}
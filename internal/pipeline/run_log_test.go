@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"devops-pipeline/internal/logstream"
+	"devops-pipeline/internal/model"
+)
+
+// flakyRunLogStore fails the first failures appends and keeps the rest.
+type flakyRunLogStore struct {
+	failures int
+	stored   []model.RunLogEntry
+}
+
+func (s *flakyRunLogStore) AppendRunLogEntries(ctx context.Context, runID int64, entries []model.RunLogEntry) (int64, error) {
+	if s.failures > 0 {
+		s.failures--
+		return 0, errors.New("database is locked")
+	}
+	for i := range entries {
+		entries[i].Seq = int64(len(s.stored))
+		s.stored = append(s.stored, entries[i])
+	}
+	return int64(len(s.stored)), nil
+}
+
+// newTestRunLogWriter returns a writer without the background flusher, so
+// the test decides when to flush.
+func newTestRunLogWriter(store runLogStore) (*runLogWriter, *logstream.Subscription) {
+	hub := logstream.NewHub()
+	writer := &runLogWriter{
+		store:  store,
+		hub:    hub,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		runID:  1,
+	}
+	return writer, hub.Subscribe(1)
+}
+
+func TestRunLogWriterRetriesFailedBatch(t *testing.T) {
+	store := &flakyRunLogStore{failures: 2}
+	writer, sub := newTestRunLogWriter(store)
+	defer sub.Close()
+
+	writer.Append(model.RunLogEntry{Text: "one\ntwo"})
+	if !writer.flush() {
+		t.Fatal("expected the failed batch to be retried")
+	}
+	writer.Append(model.RunLogEntry{Text: "three"})
+	if !writer.flush() {
+		t.Fatal("expected the failed batch to be retried")
+	}
+	if writer.flush() {
+		t.Fatal("expected the third attempt to succeed")
+	}
+
+	var texts []string
+	for _, entry := range store.stored {
+		texts = append(texts, entry.Text)
+	}
+	if got := strings.Join(texts, ","); got != "one,two,three" {
+		t.Fatalf("expected the lines in order, got %q", got)
+	}
+	select {
+	case event := <-sub.C:
+		if len(event.Lines) != 3 {
+			t.Fatalf("expected the stored lines to be published, got %d", len(event.Lines))
+		}
+	default:
+		t.Fatal("expected the stored lines to be published")
+	}
+}
+
+func TestRunLogWriterGivesUpAndRecordsLostLines(t *testing.T) {
+	store := &flakyRunLogStore{failures: runLogFlushAttempts}
+	writer, sub := newTestRunLogWriter(store)
+	defer sub.Close()
+
+	writer.Append(model.RunLogEntry{Stage: "build", Text: "one\ntwo"})
+	for i := 1; i < runLogFlushAttempts; i++ {
+		if !writer.flush() {
+			t.Fatalf("attempt %d: expected a retry", i)
+		}
+	}
+	if writer.flush() {
+		t.Fatal("expected the writer to give up")
+	}
+	if len(writer.pending) != 0 {
+		t.Fatalf("expected the dropped lines to leave the queue, %d left", len(writer.pending))
+	}
+	if len(store.stored) != 1 || !strings.Contains(store.stored[0].Text, "2 log lines") || store.stored[0].Stage != "build" {
+		t.Fatalf("expected a notice about the lost lines, got %+v", store.stored)
+	}
+	if event := <-sub.C; len(event.Lines) != 1 {
+		t.Fatalf("expected the notice to be published, got %d lines", len(event.Lines))
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops-pipeline/internal/model"
+)
+
+const apiTokenSelectColumns = `id, user_id, name, scope, token_prefix, token_hash, expires_at, last_used_at, created_at`
+
+func (s *Store) CreateAPIToken(ctx context.Context, token model.APIToken) (model.APIToken, error) {
+	id, err := s.insertID(
+		ctx,
+		s.db,
+		`INSERT INTO api_tokens (user_id, name, scope, token_prefix, token_hash, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.UserID, token.Name, token.Scope, token.TokenPrefix, token.TokenHash,
+		token.ExpiresAt.UTC().Format(time.RFC3339Nano), nowString(),
+	)
+	if err != nil {
+		return model.APIToken{}, fmt.Errorf("create api token: %w", err)
+	}
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiTokenSelectColumns+` FROM api_tokens WHERE id = ?`, id)
+	return scanAPIToken(row)
+}
+
+// ListAPITokens returns the tokens owned by userID, newest first.
+func (s *Store) ListAPITokens(ctx context.Context, userID int64) ([]model.APIToken, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+apiTokenSelectColumns+` FROM api_tokens WHERE user_id = ? ORDER BY id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []model.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// GetAPITokenByHash looks a token up by the hash of its secret.
+func (s *Store) GetAPITokenByHash(ctx context.Context, tokenHash string) (model.APIToken, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiTokenSelectColumns+` FROM api_tokens WHERE token_hash = ?`, tokenHash)
+	return scanAPIToken(row)
+}
+
+// DeleteAPIToken revokes a token. Only the owner's tokens match.
+func (s *Store) DeleteAPIToken(ctx context.Context, userID, tokenID int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	return expectDeleted(result)
+}
+
+func (s *Store) TouchAPIToken(ctx context.Context, tokenID int64, usedAt time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`,
+		usedAt.UTC().Format(time.RFC3339Nano), tokenID,
+	)
+	if err != nil {
+		return fmt.Errorf("update api token last used: %w", err)
+	}
+	return nil
+}
+
+func scanAPIToken(scan scanner) (model.APIToken, error) {
+	var (
+		token        model.APIToken
+		expiresAtStr string
+		lastUsedAt   sql.NullString
+		createdAtStr string
+	)
+
+	err := scan.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Scope,
+		&token.TokenPrefix,
+		&token.TokenHash,
+		&expiresAtStr,
+		&lastUsedAt,
+		&createdAtStr,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.APIToken{}, ErrNotFound
+	}
+	if err != nil {
+		return model.APIToken{}, fmt.Errorf("scan api token: %w", err)
+	}
+
+	expiresAt, err := parseTime(expiresAtStr)
+	if err != nil {
+		return model.APIToken{}, err
+	}
+	createdAt, err := parseTime(createdAtStr)
+	if err != nil {
+		return model.APIToken{}, err
+	}
+	token.ExpiresAt = expiresAt
+	token.CreatedAt = createdAt
+	if lastUsedAt.Valid {
+		used, err := parseTime(lastUsedAt.String)
+		if err != nil {
+			return model.APIToken{}, err
+		}
+		token.LastUsedAt = &used
+	}
+
+	return token, nil
+}
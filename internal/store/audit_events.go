@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/model"
+)
+
+const auditEventSelectQuery = `SELECT id, actor_id, actor, action, target_type, target_id, target_name,
+		        request_id, client_ip, changes_json, created_at
+		 FROM audit_events`
+
+func (s *Store) CreateAuditEvent(ctx context.Context, input model.AuditEventCreateInput) error {
+	changes := input.Changes
+	if changes == nil {
+		changes = map[string]model.AuditChange{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("marshal audit changes: %w", err)
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO audit_events (actor_id, actor, action, target_type, target_id, target_name, request_id, client_ip, changes_json, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		input.ActorID,
+		input.Actor,
+		input.Action,
+		input.TargetType,
+		input.TargetID,
+		input.TargetName,
+		input.RequestID,
+		input.ClientIP,
+		string(changesJSON),
+		nowString(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit event: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents returns matching events newest first together with the
+// number of events matching filter regardless of paging.
+func (s *Store) ListAuditEvents(ctx context.Context, filter model.AuditEventFilter) ([]model.AuditEvent, int64, error) {
+	where, args := auditEventFilterClause(filter)
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count audit events: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		auditEventSelectQuery+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, filter.Limit, filter.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]model.AuditEvent, 0)
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+func auditEventFilterClause(filter model.AuditEventFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		// 以 . 结尾时按前缀匹配，如 host. 匹配所有主机相关操作
+		if strings.HasSuffix(filter.Action, ".") {
+			conditions = append(conditions, "action LIKE ? ESCAPE '!'")
+			args = append(args, escapeLikePattern(filter.Action)+"%")
+		} else {
+			conditions = append(conditions, "action = ?")
+			args = append(args, filter.Action)
+		}
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.UTC().Format(time.RFC3339Nano))
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.CreatedTo.UTC().Format(time.RFC3339Nano))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ApplyAuditRetention deletes audit events older than the
+// audit_retention_days setting. 0 keeps events forever.
+func (s *Store) ApplyAuditRetention(ctx context.Context) error {
+	value, err := s.GetSettingValue(ctx, model.SettingAuditRetentionDays)
+	if err != nil {
+		return err
+	}
+
+	days, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || days <= 0 {
+		return nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days).UTC().Format(time.RFC3339Nano)
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM audit_events WHERE created_at < ?`, cutoff); err != nil {
+		return fmt.Errorf("delete expired audit events: %w", err)
+	}
+	return nil
+}
+
+func scanAuditEvent(scan scanner) (model.AuditEvent, error) {
+	var (
+		event           model.AuditEvent
+		actorID         sql.NullInt64
+		changesJSON     string
+		createdAtString string
+	)
+
+	err := scan.Scan(
+		&event.ID,
+		&actorID,
+		&event.Actor,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&event.TargetName,
+		&event.RequestID,
+		&event.ClientIP,
+		&changesJSON,
+		&createdAtString,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.AuditEvent{}, ErrNotFound
+	}
+	if err != nil {
+		return model.AuditEvent{}, fmt.Errorf("scan audit event: %w", err)
+	}
+
+	if actorID.Valid {
+		event.ActorID = &actorID.Int64
+	}
+	if err := json.Unmarshal([]byte(changesJSON), &event.Changes); err != nil {
+		return model.AuditEvent{}, fmt.Errorf("unmarshal audit changes: %w", err)
+	}
+	event.CreatedAt, err = parseTime(createdAtString)
+	if err != nil {
+		return model.AuditEvent{}, err
+	}
+	return event, nil
+}
@@ -2,7 +2,6 @@ package store
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 
@@ -30,9 +29,14 @@ func (s *Store) ExportBackup(ctx context.Context, repoURL, version string) (mode
 		return model.BackupData{}, err
 	}
 
+	schemaVersion, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return model.BackupData{}, err
+	}
+
 	backup := model.BackupData{
 		Meta: model.BackupMeta{
-			SchemaVersion: 1,
+			SchemaVersion: schemaVersion,
 			ExportedAt:    nowString(),
 			RepoURL:       repoURL,
 			Version:       version,
@@ -63,17 +67,24 @@ func (s *Store) ExportBackup(ctx context.Context, repoURL, version string) (mode
 
 		bundle := model.BackupProjectBundle{
 			Project: model.BackupProject{
-				ID:           detail.Project.ID,
-				SortOrder:    detail.Project.SortOrder,
-				Name:         detail.Project.Name,
-				RepoURL:      detail.Project.RepoURL,
-				Branch:       detail.Project.Branch,
-				Description:  detail.Project.Description,
-				WebhookToken: detail.Project.WebhookToken,
-				GitAuthType:  detail.Project.GitAuthType,
-				GitUsername:  optionalString(detail.Project.GitUsername),
-				GitPassword:  optionalString(detail.Project.GitPassword),
-				GitSSHKey:    optionalString(detail.Project.GitSSHKey),
+				ID:                   detail.Project.ID,
+				SortOrder:            detail.Project.SortOrder,
+				Name:                 detail.Project.Name,
+				RepoURL:              detail.Project.RepoURL,
+				Branch:               detail.Project.Branch,
+				Description:          detail.Project.Description,
+				WebhookToken:         detail.Project.WebhookToken,
+				GitAuthType:          detail.Project.GitAuthType,
+				GitUsername:          optionalString(detail.Project.GitUsername),
+				GitPassword:          optionalString(detail.Project.GitPassword),
+				GitSSHKey:            optionalString(detail.Project.GitSSHKey),
+				PathIncludes:         detail.Project.PathIncludes,
+				PathExcludes:         detail.Project.PathExcludes,
+				SkipMarkers:          detail.Project.SkipMarkers,
+				PRBuildsEnabled:      detail.Project.PRBuildsEnabled,
+				CommitStatusProvider: detail.Project.CommitStatusProvider,
+				CommitStatusAPIURL:   detail.Project.CommitStatusAPIURL,
+				CommitStatusToken:    optionalString(detail.Project.CommitStatusToken),
 			},
 		}
 
@@ -112,6 +123,11 @@ func (s *Store) ExportBackup(ctx context.Context, repoURL, version string) (mode
 }
 
 func (s *Store) ImportBackup(ctx context.Context, backup model.BackupData) (model.BackupRestoreResult, error) {
+	// 备份只包含业务数据，旧版本导出的备份可以直接导入；更新版本导出的备份可能含有本版本不认识的字段
+	if latest := s.LatestSchemaVersion(); backup.Meta.SchemaVersion > latest {
+		return model.BackupRestoreResult{}, fmt.Errorf("backup schema version %d, this build supports up to %d: %w", backup.Meta.SchemaVersion, latest, ErrSchemaTooNew)
+	}
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return model.BackupRestoreResult{}, fmt.Errorf("begin backup import transaction: %w", err)
@@ -126,7 +142,9 @@ func (s *Store) ImportBackup(ctx context.Context, backup model.BackupData) (mode
 		"settings":              0,
 	}
 
+	// 项目级授权随项目一起清空，账号本身不在备份范围内
 	for _, statement := range []string{
+		`DELETE FROM project_permissions`,
 		`DELETE FROM pipeline_runs`,
 		`DELETE FROM deploy_configs`,
 		`DELETE FROM projects`,
@@ -207,11 +225,15 @@ func (s *Store) ImportBackup(ctx context.Context, backup model.BackupData) (mode
 		if err != nil {
 			return model.BackupRestoreResult{}, fmt.Errorf("encrypt git ssh key: %w", err)
 		}
+		commitStatusTokenCipher, err := s.cipher.Encrypt(valueOrEmpty(project.CommitStatusToken))
+		if err != nil {
+			return model.BackupRestoreResult{}, fmt.Errorf("encrypt commit status token: %w", err)
+		}
 
 		if _, err := tx.ExecContext(
 			ctx,
-			`INSERT INTO projects (id, sort_order, name, repo_url, branch, description, webhook_token, git_auth_type, git_username_cipher, git_password_cipher, git_ssh_key_cipher, created_at, updated_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			`INSERT INTO projects (id, sort_order, name, repo_url, branch, description, webhook_token, git_auth_type, git_username_cipher, git_password_cipher, git_ssh_key_cipher, path_includes_json, path_excludes_json, skip_markers_json, pr_builds_enabled, commit_status_provider, commit_status_api_url, commit_status_token_cipher, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			project.ID,
 			project.SortOrder,
 			project.Name,
@@ -223,6 +245,13 @@ func (s *Store) ImportBackup(ctx context.Context, backup model.BackupData) (mode
 			gitUsernameCipher,
 			gitPasswordCipher,
 			gitSSHKeyCipher,
+			mustMarshal(model.NormalizePathFilters(project.PathIncludes)),
+			mustMarshal(model.NormalizePathFilters(project.PathExcludes)),
+			mustMarshal(model.NormalizeSkipMarkers(project.SkipMarkers)),
+			boolToInt(project.PRBuildsEnabled),
+			project.CommitStatusProvider,
+			project.CommitStatusAPIURL,
+			commitStatusTokenCipher,
 			now,
 			now,
 		); err != nil {
@@ -294,7 +323,15 @@ func optionalString(value string) *string {
 	return &next
 }
 
-func (s *Store) resetAutoIncrement(ctx context.Context, tx *sql.Tx, table string) error {
+func (s *Store) resetAutoIncrement(ctx context.Context, tx *dbTx, table string) error {
+	if s.isPostgres() {
+		// 导入时写入了显式 id，需要把序列推进到当前最大值之后
+		statement := fmt.Sprintf(`SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s`, table, table)
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("reset postgres sequence for %s: %w", table, err)
+		}
+		return nil
+	}
 	if s.isMySQL() {
 		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s AUTO_INCREMENT = 1`, table)); err != nil {
 			return fmt.Errorf("reset mysql auto increment for %s: %w", table, err)
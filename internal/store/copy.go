@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"devops-pipeline/internal/model"
+)
+
+// copyTable 描述一张需要在数据库之间搬迁的表，按外键依赖顺序排列。
+// run_log_search 是派生的检索索引，各驱动结构不同，复制完成后在目标库重建；
+// schema_migrations 由目标库自己的迁移写入。
+type copyTable struct {
+	name    string
+	orderBy string
+	// hasID 的表复制后需要重置自增序列
+	hasID bool
+}
+
+var copyTables = []copyTable{
+	{name: "hosts", orderBy: "id", hasID: true},
+	{name: "projects", orderBy: "id", hasID: true},
+	{name: "notification_channels", orderBy: "id", hasID: true},
+	{name: "deploy_configs", orderBy: "id", hasID: true},
+	{name: "pipeline_runs", orderBy: "id", hasID: true},
+	{name: "webhook_deliveries", orderBy: "id", hasID: true},
+	{name: "run_log_chunks", orderBy: "id", hasID: true},
+	{name: "admin_users", orderBy: "id", hasID: true},
+	{name: "project_permissions", orderBy: "user_id, project_id"},
+	{name: "api_tokens", orderBy: "id", hasID: true},
+	{name: "user_recovery_codes", orderBy: "id", hasID: true},
+	{name: "user_sessions", orderBy: "id", hasID: true},
+	{name: "settings", orderBy: "`key`"},
+	{name: "audit_events", orderBy: "id", hasID: true},
+}
+
+const copyBatchRows = 500
+
+// CopyProgress is called after every committed batch with the number of rows
+// copied so far for table.
+type CopyProgress func(table string, copied int64)
+
+// CopyDatabase copies every table from src into dst, keeping primary keys,
+// then re-sequences auto-increment ids, rebuilds the log search index and
+// compares row counts. dst is migrated first and must not contain data.
+func CopyDatabase(ctx context.Context, src, dst *Store, progress CopyProgress) ([]model.TableCopyResult, error) {
+	sourceVersion, err := src.SchemaVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read source schema version: %w", err)
+	}
+	if latest := src.LatestSchemaVersion(); sourceVersion != latest {
+		return nil, fmt.Errorf("source database is at schema version %d, migrate it to %d first", sourceVersion, latest)
+	}
+	if err := dst.Migrate(ctx); err != nil {
+		return nil, fmt.Errorf("migrate target database: %w", err)
+	}
+	for _, table := range copyTables {
+		count, err := dst.countTableRows(ctx, table.name)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("target table %s already has %d rows, copy needs an empty database", table.name, count)
+		}
+	}
+
+	results := make([]model.TableCopyResult, 0, len(copyTables))
+	for _, table := range copyTables {
+		copied, err := copyTableRows(ctx, src, dst, table, progress)
+		if err != nil {
+			return nil, fmt.Errorf("copy %s: %w", table.name, err)
+		}
+		results = append(results, model.TableCopyResult{Table: table.name, CopiedRows: copied})
+	}
+
+	if err := dst.resequenceCopiedTables(ctx); err != nil {
+		return nil, err
+	}
+	if err := dst.indexPendingRunLogChunks(ctx); err != nil {
+		return nil, fmt.Errorf("rebuild run log search index: %w", err)
+	}
+
+	// 源库在复制期间仍可能被写入，最后逐表核对行数
+	var mismatched []string
+	for i, table := range copyTables {
+		sourceRows, err := src.countTableRows(ctx, table.name)
+		if err != nil {
+			return nil, err
+		}
+		targetRows, err := dst.countTableRows(ctx, table.name)
+		if err != nil {
+			return nil, err
+		}
+		results[i].SourceRows = sourceRows
+		results[i].TargetRows = targetRows
+		if sourceRows != targetRows {
+			mismatched = append(mismatched, fmt.Sprintf("%s (source %d, target %d)", table.name, sourceRows, targetRows))
+		}
+	}
+	if len(mismatched) > 0 {
+		return results, fmt.Errorf("row counts differ after copy: %s", strings.Join(mismatched, ", "))
+	}
+	return results, nil
+}
+
+func copyTableRows(ctx context.Context, src, dst *Store, table copyTable, progress CopyProgress) (int64, error) {
+	rows, err := src.db.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s ORDER BY %s`, table.name, table.orderBy))
+	if err != nil {
+		return 0, fmt.Errorf("read source rows: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	quoted := make([]string, len(columns))
+	indexedColumn := -1
+	for i, column := range columns {
+		quoted[i] = "`" + column + "`"
+		if table.name == "run_log_chunks" && column == "search_indexed" {
+			indexedColumn = i
+		}
+	}
+	statement := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, table.name, strings.Join(quoted, ", "), placeholders(len(columns)))
+
+	var (
+		copied int64
+		tx     *dbTx
+	)
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return copied, fmt.Errorf("scan source row: %w", err)
+		}
+		for i, value := range values {
+			// MySQL 文本协议返回 []byte，统一按字符串写入
+			if raw, ok := value.([]byte); ok {
+				values[i] = string(raw)
+			}
+		}
+		if indexedColumn >= 0 {
+			// 检索索引在目标库重建
+			values[indexedColumn] = 0
+		}
+
+		if tx == nil {
+			if tx, err = dst.db.BeginTx(ctx, nil); err != nil {
+				return copied, fmt.Errorf("begin target transaction: %w", err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, statement, values...); err != nil {
+			return copied, fmt.Errorf("insert row: %w", err)
+		}
+		copied++
+		if copied%copyBatchRows == 0 {
+			if err := tx.Commit(); err != nil {
+				return copied, fmt.Errorf("commit batch: %w", err)
+			}
+			tx = nil
+			if progress != nil {
+				progress(table.name, copied)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return copied, err
+	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return copied, fmt.Errorf("commit batch: %w", err)
+		}
+		tx = nil
+	}
+	if progress != nil {
+		progress(table.name, copied)
+	}
+	return copied, nil
+}
+
+func (s *Store) resequenceCopiedTables(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin resequence transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range copyTables {
+		if !table.hasID {
+			continue
+		}
+		if err := s.resetAutoIncrement(ctx, tx, table.name); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit resequence transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) countTableRows(ctx context.Context, table string) (int64, error) {
+	var count int64
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, table)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count %s rows: %w", table, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,29 @@
+package store
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCopyTablesCoverSchema(t *testing.T) {
+	created := regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\w+)`)
+	copied := make(map[string]bool, len(copyTables))
+	for _, table := range copyTables {
+		copied[table.name] = true
+	}
+
+	s := &Store{driver: DriverSQLite}
+	for _, migration := range s.schemaMigrations() {
+		for _, driver := range []string{DriverSQLite, DriverMySQL, DriverPostgres} {
+			for _, statement := range migration.statements[driver] {
+				match := created.FindStringSubmatch(statement)
+				if match == nil || match[1] == "run_log_search" {
+					continue
+				}
+				if !copied[match[1]] {
+					t.Fatalf("table %s created by migration %d is not copied by CopyDatabase", match[1], migration.version)
+				}
+			}
+		}
+	}
+}
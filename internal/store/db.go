@@ -9,16 +9,18 @@ import (
 	cryptoutil "devops-pipeline/internal/crypto"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 )
 
 const (
-	DriverSQLite = "sqlite"
-	DriverMySQL  = "mysql"
+	DriverSQLite   = "sqlite"
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
 )
 
 type Store struct {
-	db     *sql.DB
+	db     *dbConn
 	cipher *cryptoutil.Cipher
 	driver string
 }
@@ -57,6 +59,25 @@ func Open(driver, source string) (*sql.DB, error) {
 			return nil, fmt.Errorf("ping mysql: %w", err)
 		}
 
+		return db, nil
+	case DriverPostgres:
+		if strings.TrimSpace(source) == "" {
+			return nil, fmt.Errorf("open postgres: APP_DB_SOURCE is required")
+		}
+
+		db, err := sql.Open(DriverPostgres, source)
+		if err != nil {
+			return nil, fmt.Errorf("open postgres: %w", err)
+		}
+
+		db.SetMaxOpenConns(10)
+		db.SetMaxIdleConns(5)
+		db.SetConnMaxLifetime(30 * time.Minute)
+
+		if err := db.Ping(); err != nil {
+			return nil, fmt.Errorf("ping postgres: %w", err)
+		}
+
 		return db, nil
 	default:
 		return nil, fmt.Errorf("unsupported db driver: %s", driver)
@@ -64,7 +85,8 @@ func Open(driver, source string) (*sql.DB, error) {
 }
 
 func New(db *sql.DB, cipher *cryptoutil.Cipher, driver string) *Store {
-	return &Store{db: db, cipher: cipher, driver: normalizeDriver(driver)}
+	driver = normalizeDriver(driver)
+	return &Store{db: &dbConn{DB: db, driver: driver}, cipher: cipher, driver: driver}
 }
 
 func normalizeDriver(driver string) string {
@@ -73,6 +95,8 @@ func normalizeDriver(driver string) string {
 		return DriverSQLite
 	case DriverMySQL:
 		return DriverMySQL
+	case DriverPostgres, "postgresql", "pg":
+		return DriverPostgres
 	default:
 		return strings.ToLower(strings.TrimSpace(driver))
 	}
@@ -85,3 +109,7 @@ func (s *Store) isSQLite() bool {
 func (s *Store) isMySQL() bool {
 	return s.driver == DriverMySQL
 }
+
+func (s *Store) isPostgres() bool {
+	return s.driver == DriverPostgres
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func TestDeployConfigUpsertQuerySQLite(t *testing.T) {
-	query := deployConfigUpsertQuery(false)
+	query := deployConfigUpsertQuery(DriverSQLite)
 
 	if !strings.Contains(query, "ON CONFLICT(project_id) DO UPDATE SET") {
 		t.Fatalf("expected sqlite upsert query, got %q", query)
@@ -20,7 +20,7 @@ func TestDeployConfigUpsertQuerySQLite(t *testing.T) {
 }
 
 func TestDeployConfigUpsertQueryMySQL(t *testing.T) {
-	query := deployConfigUpsertQuery(true)
+	query := deployConfigUpsertQuery(DriverMySQL)
 
 	if !strings.Contains(query, "ON DUPLICATE KEY UPDATE") {
 		t.Fatalf("expected mysql upsert query, got %q", query)
@@ -36,6 +36,57 @@ func TestDeployConfigUpsertQueryMySQL(t *testing.T) {
 	}
 }
 
+func TestDeployConfigUpsertQueryPostgres(t *testing.T) {
+	query := rebindQuery(DriverPostgres, deployConfigUpsertQuery(DriverPostgres))
+
+	if !strings.Contains(query, "ON CONFLICT(project_id) DO UPDATE SET") {
+		t.Fatalf("expected postgres upsert query, got %q", query)
+	}
+	if strings.Contains(query, "ON DUPLICATE KEY UPDATE") {
+		t.Fatalf("did not expect mysql upsert clause, got %q", query)
+	}
+	if strings.Contains(query, "?") || !strings.Contains(query, "$18)") {
+		t.Fatalf("expected numbered placeholders, got %q", query)
+	}
+}
+
+func TestRebindQueryPostgres(t *testing.T) {
+	query := "SELECT `key` FROM settings WHERE `key` = ? AND note LIKE '?%' ESCAPE '!' AND id IN (?, ?)"
+
+	got := rebindQuery(DriverPostgres, query)
+	want := `SELECT "key" FROM settings WHERE "key" = $1 AND note LIKE '?%' ESCAPE '!' AND id IN ($2, $3)`
+	if got != want {
+		t.Fatalf("unexpected rebound query:\n got %q\nwant %q", got, want)
+	}
+	if got := rebindQuery(DriverMySQL, query); got != query {
+		t.Fatalf("expected mysql query to be unchanged, got %q", got)
+	}
+}
+
+func TestColumnExistsQuery(t *testing.T) {
+	tests := []struct {
+		driver   string
+		contains string
+		args     int
+	}{
+		{driver: DriverSQLite, contains: "PRAGMA table_info(projects)", args: 0},
+		{driver: DriverMySQL, contains: "TABLE_SCHEMA = DATABASE()", args: 2},
+		{driver: DriverPostgres, contains: "table_schema = current_schema()", args: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			query, args := columnExistsQuery(tt.driver, "projects", "sort_order")
+			if !strings.Contains(query, tt.contains) {
+				t.Fatalf("expected %q in query, got %q", tt.contains, query)
+			}
+			if len(args) != tt.args {
+				t.Fatalf("unexpected args: %v", args)
+			}
+		})
+	}
+}
+
 func TestCloneDeployConfigInsertQuery(t *testing.T) {
 	query := cloneDeployConfigInsertQuery()
 
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// 查询统一使用 ? 占位符和反引号标识符（SQLite 与 MySQL 均可识别）。
+// PostgreSQL 需要 $1、$2 形式的占位符和双引号标识符，由 dbConn / dbTx 在执行前改写。
+
+type dbConn struct {
+	*sql.DB
+	driver string
+}
+
+type dbTx struct {
+	*sql.Tx
+	driver string
+}
+
+func (d *dbConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.DB.ExecContext(ctx, rebindQuery(d.driver, query), args...)
+}
+
+func (d *dbConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.DB.QueryContext(ctx, rebindQuery(d.driver, query), args...)
+}
+
+func (d *dbConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.DB.QueryRowContext(ctx, rebindQuery(d.driver, query), args...)
+}
+
+func (d *dbConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dbTx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{Tx: tx, driver: d.driver}, nil
+}
+
+func (t *dbTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, rebindQuery(t.driver, query), args...)
+}
+
+func (t *dbTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, rebindQuery(t.driver, query), args...)
+}
+
+func (t *dbTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, rebindQuery(t.driver, query), args...)
+}
+
+// rebindQuery rewrites query for driver. Only PostgreSQL needs rewriting:
+// ? placeholders become $n and backtick-quoted identifiers become
+// double-quoted. Characters inside string literals are left untouched.
+func rebindQuery(driver, query string) string {
+	if driver != DriverPostgres {
+		return query
+	}
+
+	var (
+		builder  strings.Builder
+		index    int
+		inString bool
+	)
+	builder.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+			builder.WriteByte(c)
+		case inString:
+			builder.WriteByte(c)
+		case c == '?':
+			index++
+			builder.WriteByte('$')
+			builder.WriteString(strconv.Itoa(index))
+		case c == '`':
+			builder.WriteByte('"')
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+// insertID runs an INSERT and returns the generated id. lib/pq does not
+// implement LastInsertId, so PostgreSQL reads it back with RETURNING.
+func (s *Store) insertID(ctx context.Context, executor execQueryRowContext, query string, args ...any) (int64, error) {
+	if s.isPostgres() {
+		var id int64
+		if err := executor.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	result, err := executor.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
@@ -6,6 +6,13 @@ import (
 	"strings"
 
 	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// PostgreSQL SQLSTATE codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	postgresUniqueViolation     pq.ErrorCode = "23505"
+	postgresForeignKeyViolation pq.ErrorCode = "23503"
 )
 
 type conflictError struct {
@@ -51,6 +58,11 @@ func isProjectRepoBranchConflict(err error) bool {
 		return mysqlErr.Number == 1062 && strings.Contains(mysqlErr.Message, "uniq_projects_repo_branch")
 	}
 
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == postgresUniqueViolation && pqErr.Constraint == "uniq_projects_repo_branch"
+	}
+
 	message := strings.ToLower(err.Error())
 	return strings.Contains(message, "unique constraint failed: projects.repo_url, projects.branch")
 }
@@ -65,6 +77,11 @@ func isUniqueConstraintError(err error) bool {
 		return mysqlErr.Number == 1062
 	}
 
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == postgresUniqueViolation
+	}
+
 	message := strings.ToLower(err.Error())
 	return strings.Contains(message, "unique constraint failed") || strings.Contains(message, "duplicate entry")
 }
@@ -79,6 +96,11 @@ func isForeignKeyConstraintError(err error) bool {
 		return mysqlErr.Number == 1451 || mysqlErr.Number == 1452
 	}
 
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == postgresForeignKeyViolation
+	}
+
 	message := strings.ToLower(err.Error())
 	return strings.Contains(message, "foreign key constraint failed") || strings.Contains(message, "cannot delete or update a parent row") || strings.Contains(message, "cannot add or update a child row")
 }
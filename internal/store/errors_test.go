@@ -2,9 +2,11 @@ package store
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
 )
 
 func TestWrapProjectMutationErrorReturnsConflict(t *testing.T) {
@@ -22,6 +24,18 @@ func TestWrapProjectMutationErrorReturnsConflict(t *testing.T) {
 	}
 }
 
+func TestWrapProjectMutationErrorReturnsConflictForPostgres(t *testing.T) {
+	err := wrapProjectMutationError("insert", &pq.Error{
+		Code:       "23505",
+		Message:    `duplicate key value violates unique constraint "uniq_projects_repo_branch"`,
+		Constraint: "uniq_projects_repo_branch",
+	})
+
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+}
+
 func TestWrapProjectMutationErrorPassesThroughOtherErrors(t *testing.T) {
 	original := errors.New("boom")
 	err := wrapProjectMutationError("insert", original)
@@ -62,6 +76,27 @@ func TestIsConstraintError(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "postgres unique",
+			err: fmt.Errorf("insert host: %w", &pq.Error{
+				Code:       "23505",
+				Constraint: "uniq_projects_webhook_token",
+			}),
+			want: true,
+		},
+		{
+			name: "postgres foreign key",
+			err: &pq.Error{
+				Code:       "23503",
+				Constraint: "fk_deploy_configs_host",
+			},
+			want: true,
+		},
+		{
+			name: "postgres not null",
+			err:  &pq.Error{Code: "23502"},
+			want: false,
+		},
 		{
 			name: "sqlite unique",
 			err:  errors.New("UNIQUE constraint failed: projects.repo_url, projects.branch"),
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"devops-pipeline/internal/model"
+)
+
+const cipherColumnSuffix = "_cipher"
+
+type cipherColumns struct {
+	table   string
+	columns []string
+}
+
+// EncryptionKeyID returns the id of the key new values are encrypted with.
+func (s *Store) EncryptionKeyID() string {
+	return s.cipher.KeyID()
+}
+
+// RotateEncryptionKey re-encrypts every *_cipher column with the current key
+// of the store's cipher. Values are decrypted with any configured key, so the
+// previous keys must still be configured. All tables are rewritten in one
+// transaction: a value that cannot be decrypted aborts the rotation and
+// leaves the database unchanged.
+func (s *Store) RotateEncryptionKey(ctx context.Context) ([]model.CipherColumnRotation, error) {
+	// 先在事务外读取表结构，SQLite 只有一个连接，事务打开后不能再用 s.db 查询
+	tables, err := s.cipherColumns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin key rotation transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var results []model.CipherColumnRotation
+	for _, table := range tables {
+		tableResults, err := s.rotateTable(ctx, tx, table)
+		if err != nil {
+			return nil, fmt.Errorf("rotate %s: %w", table.table, err)
+		}
+		results = append(results, tableResults...)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit key rotation transaction: %w", err)
+	}
+	return results, nil
+}
+
+// cipherColumns finds the encrypted columns of the copied tables by name, so
+// columns added by later migrations are rotated without being listed here.
+func (s *Store) cipherColumns(ctx context.Context) ([]cipherColumns, error) {
+	var tables []cipherColumns
+	for _, table := range copyTables {
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s WHERE 1 = 0`, table.name))
+		if err != nil {
+			return nil, fmt.Errorf("read %s columns: %w", table.name, err)
+		}
+		columns, err := rows.Columns()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s columns: %w", table.name, err)
+		}
+
+		found := cipherColumns{table: table.name}
+		for _, column := range columns {
+			if strings.HasSuffix(column, cipherColumnSuffix) {
+				found.columns = append(found.columns, column)
+			}
+		}
+		if len(found.columns) == 0 {
+			continue
+		}
+		if !table.hasID {
+			return nil, fmt.Errorf("table %s has encrypted columns but no id to update them by", table.name)
+		}
+		tables = append(tables, found)
+	}
+	return tables, nil
+}
+
+func (s *Store) rotateTable(ctx context.Context, tx *dbTx, table cipherColumns) ([]model.CipherColumnRotation, error) {
+	type encryptedRow struct {
+		id     int64
+		values []sql.NullString
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT id, %s FROM %s ORDER BY id`, strings.Join(table.columns, ", "), table.table))
+	if err != nil {
+		return nil, fmt.Errorf("read rows: %w", err)
+	}
+	var pending []encryptedRow
+	for rows.Next() {
+		row := encryptedRow{values: make([]sql.NullString, len(table.columns))}
+		dest := []any{&row.id}
+		for i := range row.values {
+			dest = append(dest, &row.values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		pending = append(pending, row)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("read rows: %w", err)
+	}
+	rows.Close()
+
+	results := make([]model.CipherColumnRotation, len(table.columns))
+	for i, column := range table.columns {
+		results[i] = model.CipherColumnRotation{Table: table.table, Column: column}
+	}
+	for _, row := range pending {
+		for i, column := range table.columns {
+			value := row.values[i].String
+			if value == "" {
+				continue
+			}
+			results[i].Values++
+			if s.cipher.IsCurrent(value) {
+				continue
+			}
+			plain, err := s.cipher.Decrypt(value)
+			if err != nil {
+				return nil, fmt.Errorf("decrypt %s of row %d: %w", column, row.id, err)
+			}
+			encrypted, err := s.cipher.Encrypt(plain)
+			if err != nil {
+				return nil, fmt.Errorf("encrypt %s of row %d: %w", column, row.id, err)
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, table.table, column), encrypted, row.id); err != nil {
+				return nil, fmt.Errorf("update %s of row %d: %w", column, row.id, err)
+			}
+			results[i].Rotated++
+		}
+	}
+	return results, nil
+}
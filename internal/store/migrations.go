@@ -1,13 +1,10 @@
 package store
 
-import "fmt"
-
-func (s *Store) migrationStatements() []string {
-	if s.isMySQL() {
-		return mysqlMigrationStatements()
-	}
-	return sqliteMigrationStatements()
-}
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
 
 func sqliteMigrationStatements() []string {
 	return []string{
@@ -34,6 +31,13 @@ func sqliteMigrationStatements() []string {
 			git_username_cipher TEXT NOT NULL DEFAULT '',
 			git_password_cipher TEXT NOT NULL DEFAULT '',
 			git_ssh_key_cipher TEXT NOT NULL DEFAULT '',
+			path_includes_json TEXT NOT NULL DEFAULT '[]',
+			path_excludes_json TEXT NOT NULL DEFAULT '[]',
+			skip_markers_json TEXT NOT NULL DEFAULT '[]',
+			pr_builds_enabled INTEGER NOT NULL DEFAULT 0,
+			commit_status_provider TEXT NOT NULL DEFAULT '',
+			commit_status_api_url TEXT NOT NULL DEFAULT '',
+			commit_status_token_cipher TEXT NOT NULL DEFAULT '',
 			created_at TEXT NOT NULL,
 			updated_at TEXT NOT NULL,
 			UNIQUE(repo_url, branch)
@@ -79,6 +83,13 @@ func sqliteMigrationStatements() []string {
 			status TEXT NOT NULL,
 			trigger_type TEXT NOT NULL,
 			trigger_ref TEXT NOT NULL DEFAULT '',
+			pull_request_number INTEGER,
+			commit_id TEXT NOT NULL DEFAULT '',
+			commit_message TEXT NOT NULL DEFAULT '',
+			author TEXT NOT NULL DEFAULT '',
+			artifact_size INTEGER NOT NULL DEFAULT 0,
+			artifact_sha256 TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
 			log_text TEXT NOT NULL DEFAULT '',
 			error_message TEXT NOT NULL DEFAULT '',
 			started_at TEXT,
@@ -100,6 +111,40 @@ func sqliteMigrationStatements() []string {
 			created_at TEXT NOT NULL,
 			updated_at TEXT NOT NULL
 		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			project_id INTEGER,
+			headers_json TEXT NOT NULL DEFAULT '{}',
+			body TEXT NOT NULL DEFAULT '',
+			body_size INTEGER NOT NULL DEFAULT 0,
+			body_truncated INTEGER NOT NULL DEFAULT 0,
+			decision TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			status_code INTEGER NOT NULL DEFAULT 0,
+			run_id INTEGER,
+			replay_of_id INTEGER,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE SET NULL,
+			FOREIGN KEY(run_id) REFERENCES pipeline_runs(id) ON DELETE SET NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS run_log_chunks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			run_id INTEGER NOT NULL,
+			start_seq INTEGER NOT NULL,
+			line_count INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			content_format TEXT NOT NULL DEFAULT 'text',
+			search_indexed INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL,
+			UNIQUE(run_id, start_seq),
+			FOREIGN KEY(run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+		);`,
+		// rowid 编码为 run_id<<32 | seq，删除任务时可以按 rowid 区间清理索引
+		`CREATE VIRTUAL TABLE IF NOT EXISTS run_log_search USING fts5(text);`,
+		`CREATE TRIGGER IF NOT EXISTS run_log_search_cleanup AFTER DELETE ON pipeline_runs
+		BEGIN
+			DELETE FROM run_log_search WHERE rowid BETWEEN old.id * 4294967296 AND old.id * 4294967296 + 4294967295;
+		END;`,
 	}
 }
 
@@ -128,6 +173,13 @@ func mysqlMigrationStatements() []string {
 			git_username_cipher TEXT NOT NULL,
 			git_password_cipher TEXT NOT NULL,
 			git_ssh_key_cipher LONGTEXT NOT NULL,
+			path_includes_json LONGTEXT NOT NULL,
+			path_excludes_json LONGTEXT NOT NULL,
+			skip_markers_json LONGTEXT NOT NULL,
+			pr_builds_enabled TINYINT(1) NOT NULL DEFAULT 0,
+			commit_status_provider VARCHAR(32) NOT NULL DEFAULT '',
+			commit_status_api_url VARCHAR(512) NOT NULL DEFAULT '',
+			commit_status_token_cipher TEXT NOT NULL,
 			created_at VARCHAR(64) NOT NULL,
 			updated_at VARCHAR(64) NOT NULL,
 			UNIQUE KEY uniq_projects_repo_branch (repo_url(255), branch),
@@ -175,6 +227,13 @@ func mysqlMigrationStatements() []string {
 			status VARCHAR(32) NOT NULL,
 			trigger_type VARCHAR(32) NOT NULL,
 			trigger_ref TEXT NOT NULL,
+			pull_request_number BIGINT NULL,
+			commit_id VARCHAR(64) NOT NULL DEFAULT '',
+			commit_message TEXT NULL,
+			author VARCHAR(255) NOT NULL DEFAULT '',
+			artifact_size BIGINT NOT NULL DEFAULT 0,
+			artifact_sha256 VARCHAR(64) NOT NULL DEFAULT '',
+			duration_ms BIGINT NOT NULL DEFAULT 0,
 			log_text LONGTEXT NOT NULL,
 			error_message LONGTEXT NOT NULL,
 			started_at VARCHAR(64) NULL,
@@ -197,12 +256,365 @@ func mysqlMigrationStatements() []string {
 			created_at VARCHAR(64) NOT NULL,
 			updated_at VARCHAR(64) NOT NULL
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			project_id BIGINT NULL,
+			headers_json LONGTEXT NOT NULL,
+			body LONGTEXT NOT NULL,
+			body_size BIGINT NOT NULL DEFAULT 0,
+			body_truncated TINYINT(1) NOT NULL DEFAULT 0,
+			decision VARCHAR(32) NOT NULL,
+			reason TEXT NOT NULL,
+			status_code INT NOT NULL DEFAULT 0,
+			run_id BIGINT NULL,
+			replay_of_id BIGINT NULL,
+			created_at VARCHAR(64) NOT NULL,
+			KEY idx_webhook_deliveries_project (project_id),
+			CONSTRAINT fk_webhook_deliveries_project FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+			CONSTRAINT fk_webhook_deliveries_run FOREIGN KEY (run_id) REFERENCES pipeline_runs(id) ON DELETE SET NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+		`CREATE TABLE IF NOT EXISTS run_log_chunks (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			run_id BIGINT NOT NULL,
+			start_seq BIGINT NOT NULL,
+			line_count INT NOT NULL,
+			content LONGTEXT NOT NULL,
+			content_format VARCHAR(16) NOT NULL DEFAULT 'text',
+			search_indexed TINYINT(1) NOT NULL DEFAULT 0,
+			created_at VARCHAR(64) NOT NULL,
+			UNIQUE KEY uniq_run_log_chunks_seq (run_id, start_seq),
+			CONSTRAINT fk_run_log_chunks_run FOREIGN KEY (run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+		`CREATE TABLE IF NOT EXISTS run_log_search (
+			run_id BIGINT NOT NULL,
+			seq BIGINT NOT NULL,
+			text MEDIUMTEXT NOT NULL,
+			PRIMARY KEY (run_id, seq),
+			FULLTEXT KEY ft_run_log_search_text (text),
+			CONSTRAINT fk_run_log_search_run FOREIGN KEY (run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+	}
+}
+
+// postgresMigrationStatements 与 SQLite 结构保持一致：时间仍以 RFC3339 文本存储，
+// 布尔值使用 INTEGER 0/1，便于三种驱动共用查询和扫描逻辑。
+func postgresMigrationStatements() []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS hosts (
+			id BIGSERIAL PRIMARY KEY,
+			sort_order BIGINT NOT NULL DEFAULT 0,
+			name TEXT NOT NULL,
+			address TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			username TEXT NOT NULL,
+			password_cipher TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS projects (
+			id BIGSERIAL PRIMARY KEY,
+			sort_order BIGINT NOT NULL DEFAULT 0,
+			name TEXT NOT NULL,
+			repo_url TEXT NOT NULL,
+			branch TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			webhook_token TEXT NOT NULL,
+			git_auth_type TEXT NOT NULL DEFAULT 'none',
+			git_username_cipher TEXT NOT NULL DEFAULT '',
+			git_password_cipher TEXT NOT NULL DEFAULT '',
+			git_ssh_key_cipher TEXT NOT NULL DEFAULT '',
+			path_includes_json TEXT NOT NULL DEFAULT '[]',
+			path_excludes_json TEXT NOT NULL DEFAULT '[]',
+			skip_markers_json TEXT NOT NULL DEFAULT '[]',
+			pr_builds_enabled INTEGER NOT NULL DEFAULT 0,
+			commit_status_provider TEXT NOT NULL DEFAULT '',
+			commit_status_api_url TEXT NOT NULL DEFAULT '',
+			commit_status_token_cipher TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			CONSTRAINT uniq_projects_repo_branch UNIQUE (repo_url, branch),
+			CONSTRAINT uniq_projects_webhook_token UNIQUE (webhook_token)
+		);`,
+		`CREATE TABLE IF NOT EXISTS notification_channels (
+			id BIGSERIAL PRIMARY KEY,
+			sort_order BIGINT NOT NULL DEFAULT 0,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			is_default INTEGER NOT NULL DEFAULT 0,
+			remark TEXT NOT NULL DEFAULT '',
+			config_json TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS deploy_configs (
+			id BIGSERIAL PRIMARY KEY,
+			project_id BIGINT NOT NULL,
+			host_id BIGINT NOT NULL,
+			build_image TEXT NOT NULL,
+			build_commands_json TEXT NOT NULL,
+			cache_dirs_json TEXT NOT NULL DEFAULT '[]',
+			artifact_filter_mode TEXT NOT NULL,
+			artifact_rules_json TEXT NOT NULL,
+			remote_save_dir TEXT NOT NULL,
+			remote_deploy_dir TEXT NOT NULL,
+			pre_deploy_commands_json TEXT NOT NULL,
+			post_deploy_commands_json TEXT NOT NULL,
+			timeout_seconds INTEGER NOT NULL DEFAULT 1800,
+			version_count INTEGER NOT NULL DEFAULT 5,
+			notify_webhook_url TEXT NOT NULL DEFAULT '',
+			notify_token_cipher TEXT NOT NULL DEFAULT '',
+			notification_channel_id BIGINT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			CONSTRAINT uniq_deploy_configs_project_id UNIQUE (project_id),
+			CONSTRAINT fk_deploy_configs_project FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			CONSTRAINT fk_deploy_configs_host FOREIGN KEY (host_id) REFERENCES hosts(id) ON DELETE RESTRICT,
+			CONSTRAINT fk_deploy_configs_notification_channel FOREIGN KEY (notification_channel_id) REFERENCES notification_channels(id) ON DELETE SET NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS pipeline_runs (
+			id BIGSERIAL PRIMARY KEY,
+			project_id BIGINT NOT NULL,
+			status TEXT NOT NULL,
+			trigger_type TEXT NOT NULL,
+			trigger_ref TEXT NOT NULL DEFAULT '',
+			pull_request_number BIGINT NULL,
+			commit_id TEXT NOT NULL DEFAULT '',
+			commit_message TEXT NOT NULL DEFAULT '',
+			author TEXT NOT NULL DEFAULT '',
+			artifact_size BIGINT NOT NULL DEFAULT 0,
+			artifact_sha256 TEXT NOT NULL DEFAULT '',
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			log_text TEXT NOT NULL DEFAULT '',
+			error_message TEXT NOT NULL DEFAULT '',
+			started_at TEXT NULL,
+			finished_at TEXT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			CONSTRAINT fk_pipeline_runs_project FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS admin_users (
+			id BIGSERIAL PRIMARY KEY,
+			username TEXT NOT NULL,
+			password_hash TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			CONSTRAINT uniq_admin_users_username UNIQUE (username)
+		);`,
+		`CREATE TABLE IF NOT EXISTS settings (
+			"key" TEXT PRIMARY KEY,
+			"value" TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			project_id BIGINT NULL,
+			headers_json TEXT NOT NULL DEFAULT '{}',
+			body TEXT NOT NULL DEFAULT '',
+			body_size BIGINT NOT NULL DEFAULT 0,
+			body_truncated INTEGER NOT NULL DEFAULT 0,
+			decision TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			status_code INTEGER NOT NULL DEFAULT 0,
+			run_id BIGINT NULL,
+			replay_of_id BIGINT NULL,
+			created_at TEXT NOT NULL,
+			CONSTRAINT fk_webhook_deliveries_project FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+			CONSTRAINT fk_webhook_deliveries_run FOREIGN KEY (run_id) REFERENCES pipeline_runs(id) ON DELETE SET NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_project ON webhook_deliveries (project_id);`,
+		`CREATE TABLE IF NOT EXISTS run_log_chunks (
+			id BIGSERIAL PRIMARY KEY,
+			run_id BIGINT NOT NULL,
+			start_seq BIGINT NOT NULL,
+			line_count INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			content_format TEXT NOT NULL DEFAULT 'text',
+			search_indexed INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL,
+			CONSTRAINT uniq_run_log_chunks_seq UNIQUE (run_id, start_seq),
+			CONSTRAINT fk_run_log_chunks_run FOREIGN KEY (run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS run_log_search (
+			run_id BIGINT NOT NULL,
+			seq BIGINT NOT NULL,
+			text TEXT NOT NULL,
+			PRIMARY KEY (run_id, seq),
+			CONSTRAINT fk_run_log_search_run FOREIGN KEY (run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+		);`,
+		// simple 分词配置不做词干提取，和 FTS5 / MySQL 的按词匹配行为接近
+		`CREATE INDEX IF NOT EXISTS idx_run_log_search_text ON run_log_search USING GIN (to_tsvector('simple', text));`,
 	}
 }
 
 func columnExistsQuery(driver, table, column string) (string, []any) {
-	if driver == DriverMySQL {
+	switch driver {
+	case DriverMySQL:
 		return `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`, []any{table, column}
+	case DriverPostgres:
+		return `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`, []any{table, column}
 	}
 	return fmt.Sprintf(`PRAGMA table_info(%s)`, table), nil
 }
+
+func (s *Store) columnExists(ctx context.Context, q migrationExecutor, table, column string) (bool, error) {
+	query, args := columnExistsQuery(s.driver, table, column)
+	if !s.isSQLite() {
+		var count int
+		if err := q.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+			return false, fmt.Errorf("read %s columns: %w", table, err)
+		}
+		return count > 0, nil
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("read %s columns: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name         string
+			columnType   string
+			notNull      int
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return false, fmt.Errorf("scan %s columns: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("iterate %s columns: %w", table, err)
+	}
+	return false, nil
+}
+
+// ensureColumn adds column to table when it is missing. The definitions are
+// dialect specific because MySQL TEXT columns cannot carry a default value;
+// PostgreSQL accepts the SQLite definition.
+func (s *Store) ensureColumn(ctx context.Context, q migrationExecutor, table, column, sqliteDefinition, mysqlDefinition string) error {
+	exists, err := s.columnExists(ctx, q, table, column)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	definition := sqliteDefinition
+	if s.isMySQL() {
+		definition = mysqlDefinition
+	}
+	if _, err := q.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition)); err != nil {
+		return fmt.Errorf("add %s to %s: %w", column, table, err)
+	}
+	return nil
+}
+
+// ensureProjectTriggerRuleColumns adds the trigger rule columns and leaves
+// them as a fresh schema declares them. MySQL cannot add a NOT NULL LONGTEXT
+// column without a default, so it is added as NULL, backfilled and then
+// tightened; running it again is harmless.
+func (s *Store) ensureProjectTriggerRuleColumns(ctx context.Context, q migrationExecutor) error {
+	for _, column := range []string{"path_includes_json", "path_excludes_json", "skip_markers_json"} {
+		if err := s.ensureColumn(ctx, q, "projects", column, `TEXT NOT NULL DEFAULT '[]'`, `LONGTEXT NULL`); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, fmt.Sprintf(`UPDATE projects SET %s = '[]' WHERE %s IS NULL OR %s = ''`, column, column, column)); err != nil {
+			return fmt.Errorf("backfill %s: %w", column, err)
+		}
+		if s.isMySQL() {
+			if _, err := q.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE projects MODIFY %s LONGTEXT NOT NULL`, column)); err != nil {
+				return fmt.Errorf("make %s not null: %w", column, err)
+			}
+		}
+	}
+	return s.ensureColumn(ctx, q, "projects", "pr_builds_enabled", `INTEGER NOT NULL DEFAULT 0`, `TINYINT(1) NOT NULL DEFAULT 0`)
+}
+
+func (s *Store) ensurePipelineRunCommitColumns(ctx context.Context, q migrationExecutor) error {
+	if err := s.ensureColumn(ctx, q, "pipeline_runs", "commit_id", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(64) NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, q, "pipeline_runs", "commit_message", `TEXT NOT NULL DEFAULT ''`, `TEXT NULL`); err != nil {
+		return err
+	}
+	return s.ensureColumn(ctx, q, "pipeline_runs", "author", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(255) NOT NULL DEFAULT ''`)
+}
+
+func (s *Store) ensurePipelineRunArtifactColumns(ctx context.Context, q migrationExecutor) error {
+	if err := s.ensureColumn(ctx, q, "pipeline_runs", "artifact_size", `INTEGER NOT NULL DEFAULT 0`, `BIGINT NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+	return s.ensureColumn(ctx, q, "pipeline_runs", "artifact_sha256", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(64) NOT NULL DEFAULT ''`)
+}
+
+// ensurePipelineRunDurationColumn adds duration_ms, used to sort runs by
+// duration, and fills it in for runs that finished before the column existed.
+func (s *Store) ensurePipelineRunDurationColumn(ctx context.Context, q migrationExecutor) error {
+	if err := s.ensureColumn(ctx, q, "pipeline_runs", "duration_ms", `INTEGER NOT NULL DEFAULT 0`, `BIGINT NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	rows, err := q.QueryContext(
+		ctx,
+		`SELECT id, started_at, finished_at FROM pipeline_runs
+		 WHERE duration_ms = 0 AND started_at IS NOT NULL AND finished_at IS NOT NULL`,
+	)
+	if err != nil {
+		return fmt.Errorf("query run durations: %w", err)
+	}
+	durations := make(map[int64]int64)
+	for rows.Next() {
+		var (
+			runID      int64
+			startedAt  string
+			finishedAt string
+		)
+		if err := rows.Scan(&runID, &startedAt, &finishedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan run duration: %w", err)
+		}
+		if duration := runDurationMS(startedAt, finishedAt); duration > 0 {
+			durations[runID] = duration
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for runID, duration := range durations {
+		if _, err := q.ExecContext(ctx, `UPDATE pipeline_runs SET duration_ms = ? WHERE id = ?`, duration, runID); err != nil {
+			return fmt.Errorf("backfill run duration %d: %w", runID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) ensureRunLogChunkFormatColumn(ctx context.Context, q migrationExecutor) error {
+	if err := s.ensureColumn(ctx, q, "run_log_chunks", "content_format", `TEXT NOT NULL DEFAULT 'text'`, `VARCHAR(16) NOT NULL DEFAULT 'text'`); err != nil {
+		return err
+	}
+	return s.ensureColumn(ctx, q, "run_log_chunks", "search_indexed", `INTEGER NOT NULL DEFAULT 0`, `TINYINT(1) NOT NULL DEFAULT 0`)
+}
+
+func (s *Store) ensureProjectCommitStatusColumns(ctx context.Context, q migrationExecutor) error {
+	if err := s.ensureColumn(ctx, q, "projects", "commit_status_provider", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(32) NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, q, "projects", "commit_status_api_url", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(512) NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	return s.ensureColumn(ctx, q, "projects", "commit_status_token_cipher", `TEXT NOT NULL DEFAULT ''`, `TEXT NULL`)
+}
+
+func (s *Store) ensurePipelineRunPullRequestColumn(ctx context.Context, q migrationExecutor) error {
+	return s.ensureColumn(ctx, q, "pipeline_runs", "pull_request_number", `INTEGER`, `BIGINT NULL`)
+}
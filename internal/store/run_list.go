@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/model"
+)
+
+const defaultRunPageLimit = 50
+
+// ErrInvalidCursor is returned when a run list cursor cannot be decoded or was
+// issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// runCursor points just past the last run of a page. Key holds that run's sort
+// value so the next page can continue with a keyset condition instead of an
+// OFFSET, which stays stable while new runs are inserted.
+type runCursor struct {
+	Sort      string `json:"s"`
+	Ascending bool   `json:"a,omitempty"`
+	Key       string `json:"k,omitempty"`
+	ID        int64  `json:"id"`
+}
+
+// ListRunPage returns one page of runs matching query together with the total
+// number of matching runs.
+func (s *Store) ListRunPage(ctx context.Context, query model.RunListQuery) (model.RunPage, error) {
+	sortKey, err := runSortExpression(query.Sort)
+	if err != nil {
+		return model.RunPage{}, err
+	}
+	if query.Sort == "" {
+		query.Sort = model.RunSortCreated
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultRunPageLimit
+	}
+
+	total, err := s.CountRuns(ctx, query.Filter)
+	if err != nil {
+		return model.RunPage{}, err
+	}
+
+	where, args := runFilterClause(query.Filter)
+	if query.Cursor != "" {
+		cursor, err := decodeRunCursor(query.Cursor)
+		if err != nil {
+			return model.RunPage{}, err
+		}
+		if cursor.Sort != query.Sort || cursor.Ascending != query.Ascending {
+			return model.RunPage{}, ErrInvalidCursor
+		}
+		condition, cursorArgs, err := runCursorCondition(sortKey, cursor)
+		if err != nil {
+			return model.RunPage{}, err
+		}
+		where = appendRunCondition(where, condition)
+		args = append(args, cursorArgs...)
+	}
+
+	direction := "DESC"
+	if query.Ascending {
+		direction = "ASC"
+	}
+	orderBy := "pipeline_runs.id " + direction
+	if sortKey != "" {
+		orderBy = sortKey + " " + direction + ", " + orderBy
+	}
+
+	// 多取一条用于判断是否还有下一页
+	statement := runSelectQuery() + where + `
+		 ORDER BY ` + orderBy + `
+		 LIMIT ? OFFSET ?`
+	offset := query.Offset
+	if query.Cursor != "" || offset < 0 {
+		offset = 0
+	}
+	args = append(args, query.Limit+1, offset)
+
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return model.RunPage{}, fmt.Errorf("query runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]model.PipelineRun, 0, query.Limit)
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return model.RunPage{}, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return model.RunPage{}, err
+	}
+
+	page := model.RunPage{Runs: runs, Total: total}
+	if len(runs) > query.Limit {
+		page.Runs = runs[:query.Limit]
+		page.NextCursor = encodeRunCursor(query.Sort, query.Ascending, page.Runs[len(page.Runs)-1])
+	}
+	return page, nil
+}
+
+// CountRuns returns the number of runs matching filter.
+func (s *Store) CountRuns(ctx context.Context, filter model.RunFilter) (int64, error) {
+	where, args := runFilterClause(filter)
+	var total int64
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(1)
+		 FROM pipeline_runs
+		 JOIN projects ON projects.id = pipeline_runs.project_id`+where,
+		args...,
+	).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("count runs: %w", err)
+	}
+	return total, nil
+}
+
+// runSortExpression maps a sort name to its SQL expression; the default
+// creation order sorts by id alone.
+func runSortExpression(sort string) (string, error) {
+	switch sort {
+	case "", model.RunSortCreated:
+		return "", nil
+	case model.RunSortStarted:
+		// 排队中的任务还没有 started_at，按创建时间参与排序
+		return "COALESCE(pipeline_runs.started_at, pipeline_runs.created_at)", nil
+	case model.RunSortDuration:
+		return "pipeline_runs.duration_ms", nil
+	default:
+		return "", fmt.Errorf("unsupported run sort %q", sort)
+	}
+}
+
+func runCursorCondition(sortKey string, cursor runCursor) (string, []any, error) {
+	operator := "<"
+	if cursor.Ascending {
+		operator = ">"
+	}
+	if sortKey == "" {
+		return "pipeline_runs.id " + operator + " ?", []any{cursor.ID}, nil
+	}
+
+	var key any = cursor.Key
+	if cursor.Sort == model.RunSortDuration {
+		duration, err := strconv.ParseInt(cursor.Key, 10, 64)
+		if err != nil {
+			return "", nil, ErrInvalidCursor
+		}
+		key = duration
+	}
+	condition := "(" + sortKey + " " + operator + " ? OR (" + sortKey + " = ? AND pipeline_runs.id " + operator + " ?))"
+	return condition, []any{key, key, cursor.ID}, nil
+}
+
+func encodeRunCursor(sort string, ascending bool, run model.PipelineRun) string {
+	cursor := runCursor{Sort: sort, Ascending: ascending, ID: run.ID}
+	switch sort {
+	case model.RunSortStarted:
+		startedAt := run.CreatedAt
+		if run.StartedAt != nil {
+			startedAt = *run.StartedAt
+		}
+		cursor.Key = startedAt.UTC().Format(time.RFC3339Nano)
+	case model.RunSortDuration:
+		cursor.Key = strconv.FormatInt(run.DurationMS, 10)
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeRunCursor(value string) (runCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return runCursor{}, ErrInvalidCursor
+	}
+	var cursor runCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID <= 0 {
+		return runCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func appendRunCondition(where, condition string) string {
+	if where == "" {
+		return `
+		 WHERE ` + condition
+	}
+	return where + " AND " + condition
+}
+
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
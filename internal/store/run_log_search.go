@@ -0,0 +1,337 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"devops-pipeline/internal/model"
+)
+
+// 日志全文检索按行建立索引：SQLite 使用 FTS5 虚拟表，rowid 编码为 run_id<<32 | seq；
+// MySQL 使用带 FULLTEXT 索引的普通表，PostgreSQL 使用 to_tsvector 表达式上的 GIN 索引，
+// 两者都随 pipeline_runs 级联删除。
+
+const (
+	runLogSearchBatchRows  = 200
+	maxIndexedLineBytes    = 8 << 10
+	defaultRunSearchLimit  = 20
+	maxRunSearchLines      = 500
+	maxRunSearchHitsPerRun = 5
+	runSearchSnippetRunes  = 160
+	runSearchSnippetLead   = 40
+)
+
+func runLogSearchRowID(runID, seq int64) int64 {
+	return runID<<32 | seq
+}
+
+// indexRunLogLines adds entries stored from startSeq on to the search index.
+func (s *Store) indexRunLogLines(ctx context.Context, tx *dbTx, runID, startSeq int64, entries []model.RunLogEntry) error {
+	columns := "(rowid, text)"
+	rowPlaceholders := "(?, ?)"
+	if !s.isSQLite() {
+		columns = "(run_id, seq, text)"
+		rowPlaceholders = "(?, ?, ?)"
+	}
+
+	var (
+		rows []string
+		args []any
+	)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		statement := "INSERT INTO run_log_search " + columns + " VALUES " + strings.Join(rows, ", ")
+		if _, err := tx.ExecContext(ctx, statement, args...); err != nil {
+			return fmt.Errorf("index run log: %w", err)
+		}
+		rows, args = rows[:0], args[:0]
+		return nil
+	}
+
+	for i, entry := range entries {
+		text := truncateIndexedLine(entry.Text)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		seq := startSeq + int64(i)
+		rows = append(rows, rowPlaceholders)
+		if !s.isSQLite() {
+			args = append(args, runID, seq, text)
+		} else {
+			args = append(args, runLogSearchRowID(runID, seq), text)
+		}
+		if len(rows) >= runLogSearchBatchRows {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// indexPendingRunLogChunks indexes chunks written before the search index
+// existed, including logs migrated from pipeline_runs.log_text.
+func (s *Store) indexPendingRunLogChunks(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM run_log_chunks WHERE search_indexed = 0 ORDER BY id ASC`)
+	if err != nil {
+		return fmt.Errorf("query unindexed run log chunks: %w", err)
+	}
+	var chunkIDs []int64
+	for rows.Next() {
+		var chunkID int64
+		if err := rows.Scan(&chunkID); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan unindexed run log chunk: %w", err)
+		}
+		chunkIDs = append(chunkIDs, chunkID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, chunkID := range chunkIDs {
+		if err := s.indexRunLogChunk(ctx, chunkID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) indexRunLogChunk(ctx context.Context, chunkID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin run log indexing: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		runID    int64
+		startSeq int64
+		content  string
+		format   string
+	)
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT run_id, start_seq, content, content_format FROM run_log_chunks WHERE id = ?`,
+		chunkID,
+	).Scan(&runID, &startSeq, &content, &format)
+	if err != nil {
+		return fmt.Errorf("read run log chunk %d: %w", chunkID, err)
+	}
+	entries, err := decodeRunLogChunk(startSeq, content, format)
+	if err != nil {
+		return err
+	}
+	if err := s.indexRunLogLines(ctx, tx, runID, startSeq, entries); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE run_log_chunks SET search_indexed = 1 WHERE id = ?`, chunkID); err != nil {
+		return fmt.Errorf("mark run log chunk %d indexed: %w", chunkID, err)
+	}
+	return tx.Commit()
+}
+
+// SearchRunLogs returns the runs whose log lines match query, most relevant
+// first, each with up to maxRunSearchHitsPerRun highlighted lines.
+func (s *Store) SearchRunLogs(ctx context.Context, query model.RunSearchQuery) ([]model.RunSearchResult, error) {
+	terms := runSearchTerms(query.Query)
+	if len(terms) == 0 {
+		return []model.RunSearchResult{}, nil
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultRunSearchLimit
+	}
+
+	statement, args := s.runLogSearchQuery(terms, query.ProjectID)
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search run logs: %w", err)
+	}
+
+	var (
+		order   []int64
+		matches = make(map[int64][]model.RunLogMatch)
+	)
+	for rows.Next() {
+		var (
+			runID int64
+			seq   int64
+			text  string
+		)
+		if err := rows.Scan(&runID, &seq, &text); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan run log match: %w", err)
+		}
+		if _, seen := matches[runID]; !seen {
+			if len(order) == query.Limit {
+				continue
+			}
+			order = append(order, runID)
+		}
+		if len(matches[runID]) < maxRunSearchHitsPerRun {
+			matches[runID] = append(matches[runID], model.RunLogMatch{
+				Seq:     seq,
+				Line:    seq + 1,
+				Snippet: highlightSnippet(text, terms),
+			})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]model.RunSearchResult, 0, len(order))
+	for _, runID := range order {
+		run, err := s.GetRunSummary(ctx, runID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		runMatches := matches[runID]
+		sort.Slice(runMatches, func(i, j int) bool { return runMatches[i].Seq < runMatches[j].Seq })
+		results = append(results, model.RunSearchResult{Run: run, Matches: runMatches})
+	}
+	return results, nil
+}
+
+func (s *Store) runLogSearchQuery(terms []string, projectID int64) (string, []any) {
+	if s.isMySQL() {
+		booleanQuery := make([]string, len(terms))
+		for i, term := range terms {
+			booleanQuery[i] = `+"` + term + `"`
+		}
+		match := strings.Join(booleanQuery, " ")
+		statement := `SELECT run_id, seq, text FROM run_log_search
+			 WHERE MATCH(text) AGAINST (? IN BOOLEAN MODE)`
+		args := []any{match}
+		if projectID > 0 {
+			statement += ` AND run_id IN (SELECT id FROM pipeline_runs WHERE project_id = ?)`
+			args = append(args, projectID)
+		}
+		statement += ` ORDER BY MATCH(text) AGAINST (? IN BOOLEAN MODE) DESC, run_id DESC, seq ASC LIMIT ?`
+		return statement, append(args, match, maxRunSearchLines)
+	}
+	if s.isPostgres() {
+		// plainto_tsquery 会把各个词用 & 连接，要求同一行包含全部词
+		match := strings.Join(terms, " ")
+		statement := `SELECT run_id, seq, text FROM run_log_search
+			 WHERE to_tsvector('simple', text) @@ plainto_tsquery('simple', ?)`
+		args := []any{match}
+		if projectID > 0 {
+			statement += ` AND run_id IN (SELECT id FROM pipeline_runs WHERE project_id = ?)`
+			args = append(args, projectID)
+		}
+		statement += ` ORDER BY ts_rank(to_tsvector('simple', text), plainto_tsquery('simple', ?)) DESC, run_id DESC, seq ASC LIMIT ?`
+		return statement, append(args, match, maxRunSearchLines)
+	}
+
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"`
+	}
+	statement := `SELECT rowid >> 32, rowid & 4294967295, text FROM run_log_search
+		 WHERE run_log_search MATCH ?`
+	args := []any{strings.Join(phrases, " ")}
+	if projectID > 0 {
+		statement += ` AND (rowid >> 32) IN (SELECT id FROM pipeline_runs WHERE project_id = ?)`
+		args = append(args, projectID)
+	}
+	statement += ` ORDER BY rank, rowid DESC LIMIT ?`
+	return statement, append(args, maxRunSearchLines)
+}
+
+// runSearchTerms splits the query into terms that are safe to quote in both
+// FTS5 and MySQL boolean mode syntax; PostgreSQL receives them as plain text.
+func runSearchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		term := strings.Trim(strings.ReplaceAll(field, `"`, ""), `+-*~<>()@`)
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// highlightSnippet cuts a window of text around the first matched term,
+// escapes it as HTML and wraps every case-insensitive term match in <mark>.
+func highlightSnippet(text string, terms []string) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		termRunes := []rune(strings.ToLower(term))
+		if len(termRunes) == 0 {
+			continue
+		}
+		for i := 0; i+len(termRunes) <= len(lower); i++ {
+			if string(lower[i:i+len(termRunes)]) != string(termRunes) {
+				continue
+			}
+			for j := i; j < i+len(termRunes); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start := 0
+	if first > runSearchSnippetLead {
+		start = first - runSearchSnippetLead
+	}
+	end := min(len(runes), start+runSearchSnippetRunes)
+
+	var builder strings.Builder
+	if start > 0 {
+		builder.WriteString("…")
+	}
+	inMark := false
+	for i := start; i < end; i++ {
+		if marked[i] != inMark {
+			if marked[i] {
+				builder.WriteString("<mark>")
+			} else {
+				builder.WriteString("</mark>")
+			}
+			inMark = marked[i]
+		}
+		builder.WriteString(html.EscapeString(string(runes[i])))
+	}
+	if inMark {
+		builder.WriteString("</mark>")
+	}
+	if end < len(runes) {
+		builder.WriteString("…")
+	}
+	return builder.String()
+}
+
+func truncateIndexedLine(text string) string {
+	if len(text) <= maxIndexedLineBytes {
+		return text
+	}
+	cut := maxIndexedLineBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunSearchTermsStripOperators(t *testing.T) {
+	got := runSearchTerms(`  "connection refused" +npm -x (ERR!) `)
+
+	want := []string{"connection", "refused", "npm", "x", "ERR!"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected terms: got %q want %q", got, want)
+	}
+}
+
+func TestHighlightSnippetMarksTermsAndEscapesHTML(t *testing.T) {
+	got := highlightSnippet("dial tcp: Connection refused <b>", []string{"connection", "REFUSED"})
+
+	want := "dial tcp: <mark>Connection</mark> <mark>refused</mark> &lt;b&gt;"
+	if got != want {
+		t.Fatalf("unexpected snippet: got %q want %q", got, want)
+	}
+}
+
+func TestHighlightSnippetTrimsLongLines(t *testing.T) {
+	text := strings.Repeat("a", 100) + " fatal " + strings.Repeat("b", 300)
+
+	got := highlightSnippet(text, []string{"fatal"})
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Fatalf("expected ellipsis on both sides, got %q", got)
+	}
+	if !strings.Contains(got, "<mark>fatal</mark>") {
+		t.Fatalf("expected highlighted term, got %q", got)
+	}
+}
+
+func TestRunLogSearchRowIDEncodesRunAndSeq(t *testing.T) {
+	rowID := runLogSearchRowID(7, 42)
+
+	if rowID>>32 != 7 || rowID&0xffffffff != 42 {
+		t.Fatalf("unexpected row id decoding: %d", rowID)
+	}
+}
@@ -0,0 +1,448 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops-pipeline/internal/model"
+)
+
+// 日志按批写入 run_log_chunks，每个分片记录起始行号和行数，
+// 读取时可以按行号偏移增量获取，避免反复改写整段日志文本。
+// 分片内容为 JSON Lines 格式的结构化日志；从 log_text 迁移来的旧分片为纯文本。
+
+const (
+	appendRunLogAttempts = 3
+
+	runLogFormatText  = "text"
+	runLogFormatJSONL = "jsonl"
+)
+
+// storedRunLogEntry is the per-line JSON stored in a chunk; the sequence
+// number follows from the chunk's start_seq and is not repeated.
+type storedRunLogEntry struct {
+	Time   time.Time `json:"time,omitzero"`
+	Stage  string    `json:"stage,omitempty"`
+	Source string    `json:"source,omitempty"`
+	Level  string    `json:"level,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// AppendRunLogEntries stores entries as one chunk, assigns their Seq and
+// returns the sequence number of the first entry. Concurrent writers for the
+// same run race on the (run_id, start_seq) unique key, so the insert is
+// retried on conflict.
+func (s *Store) AppendRunLogEntries(ctx context.Context, runID int64, entries []model.RunLogEntry) (int64, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	content, err := encodeRunLogEntries(entries)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 0; attempt < appendRunLogAttempts; attempt++ {
+		var startSeq int64
+		startSeq, err = s.appendRunLogChunk(ctx, runID, entries, content)
+		if err == nil {
+			for i := range entries {
+				entries[i].Seq = startSeq + int64(i)
+			}
+			return startSeq, nil
+		}
+		if !isUniqueConstraintError(err) {
+			break
+		}
+	}
+	return 0, fmt.Errorf("append run log: %w", err)
+}
+
+func (s *Store) appendRunLogChunk(ctx context.Context, runID int64, entries []model.RunLogEntry, content string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	startSeq, err := runLogLineCount(ctx, tx, runID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := nowString()
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO run_log_chunks (run_id, start_seq, line_count, content, content_format, search_indexed, created_at)
+		 VALUES (?, ?, ?, ?, ?, 1, ?)`,
+		runID, startSeq, len(entries), content, runLogFormatJSONL, now,
+	); err != nil {
+		return 0, err
+	}
+	if err := s.indexRunLogLines(ctx, tx, runID, startSeq, entries); err != nil {
+		return 0, err
+	}
+	// 更新 updated_at，日志流据此判断是否有新内容
+	if _, err := tx.ExecContext(ctx, `UPDATE pipeline_runs SET updated_at = ? WHERE id = ?`, now, runID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return startSeq, nil
+}
+
+// GetRunLog returns the log entries selected by query together with their
+// plain-text rendering.
+func (s *Store) GetRunLog(ctx context.Context, runID int64, query model.RunLogQuery) (model.PipelineRunLog, error) {
+	var updatedAtString string
+	err := s.db.QueryRowContext(ctx, `SELECT updated_at FROM pipeline_runs WHERE id = ?`, runID).Scan(&updatedAtString)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.PipelineRunLog{}, ErrNotFound
+	}
+	if err != nil {
+		return model.PipelineRunLog{}, fmt.Errorf("scan run log: %w", err)
+	}
+	updatedAt, err := parseTime(updatedAtString)
+	if err != nil {
+		return model.PipelineRunLog{}, err
+	}
+
+	filtered := query.Stage != "" || query.Source != ""
+	offset := query.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	if query.Tail > 0 && !filtered {
+		// 无过滤条件时直接按行号定位尾部，避免读取整段日志
+		total, err := runLogLineCount(ctx, s.db, runID)
+		if err != nil {
+			return model.PipelineRunLog{}, err
+		}
+		if total-query.Tail > offset {
+			offset = total - query.Tail
+		}
+	}
+
+	entries, total, err := s.readRunLogEntries(ctx, runID, offset)
+	if err != nil {
+		return model.PipelineRunLog{}, err
+	}
+	if offset > total {
+		offset = total
+	}
+	entries = filterRunLogEntries(entries, query)
+
+	return model.PipelineRunLog{
+		RunID:      runID,
+		LogText:    RenderRunLog(entries),
+		Entries:    entries,
+		Offset:     offset,
+		NextOffset: total,
+		TotalLines: total,
+		UpdatedAt:  updatedAt,
+	}, nil
+}
+
+// runLogExportPageChunks bounds the chunks read by one export query. Pages
+// are short queries whose rows are closed before anything is sent, so a slow
+// download never holds a connection; SQLite only has one.
+const runLogExportPageChunks = 20
+
+// RunLogExportPage renders the chunks of a run that start after afterSeq as
+// plain text; pass -1 for the first page. cursor is passed to the next call,
+// more reports whether another page may follow.
+func (s *Store) RunLogExportPage(ctx context.Context, runID, afterSeq int64) (text string, cursor int64, more bool, err error) {
+	type chunk struct {
+		startSeq int64
+		content  string
+		format   string
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT start_seq, content, content_format
+		 FROM run_log_chunks
+		 WHERE run_id = ? AND start_seq > ?
+		 ORDER BY start_seq ASC
+		 LIMIT ?`,
+		runID, afterSeq, runLogExportPageChunks,
+	)
+	if err != nil {
+		return "", afterSeq, false, fmt.Errorf("query run log chunks: %w", err)
+	}
+	var chunks []chunk
+	for rows.Next() {
+		var c chunk
+		if err := rows.Scan(&c.startSeq, &c.content, &c.format); err != nil {
+			rows.Close()
+			return "", afterSeq, false, fmt.Errorf("scan run log chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return "", afterSeq, false, fmt.Errorf("read run log chunks: %w", err)
+	}
+	rows.Close()
+
+	var builder strings.Builder
+	cursor = afterSeq
+	for _, c := range chunks {
+		entries, err := decodeRunLogChunk(c.startSeq, c.content, c.format)
+		if err != nil {
+			return "", afterSeq, false, err
+		}
+		builder.WriteString(RenderRunLog(entries))
+		cursor = c.startSeq
+	}
+	return builder.String(), cursor, len(chunks) == runLogExportPageChunks, nil
+}
+
+// filterRunLogEntries applies the stage/source filters and then the tail limit.
+func filterRunLogEntries(entries []model.RunLogEntry, query model.RunLogQuery) []model.RunLogEntry {
+	if query.Stage != "" || query.Source != "" {
+		matched := make([]model.RunLogEntry, 0, len(entries))
+		for _, entry := range entries {
+			if query.Stage != "" && entry.Stage != query.Stage {
+				continue
+			}
+			if query.Source != "" && entry.Source != query.Source {
+				continue
+			}
+			matched = append(matched, entry)
+		}
+		entries = matched
+	}
+	if query.Tail > 0 && int64(len(entries)) > query.Tail {
+		entries = entries[int64(len(entries))-query.Tail:]
+	}
+	return entries
+}
+
+// RenderRunLog joins entries into the plain-text log, one line per entry.
+func RenderRunLog(entries []model.RunLogEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	for _, entry := range entries {
+		builder.WriteString(entry.PlainText())
+		builder.WriteByte('\n')
+	}
+	return builder.String()
+}
+
+// readRunLogEntries returns every entry with sequence >= offset and the total
+// number of lines stored for the run.
+func (s *Store) readRunLogEntries(ctx context.Context, runID, offset int64) ([]model.RunLogEntry, int64, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT start_seq, line_count, content, content_format
+		 FROM run_log_chunks
+		 WHERE run_id = ? AND start_seq + line_count > ?
+		 ORDER BY start_seq ASC`,
+		runID, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query run log chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		entries []model.RunLogEntry
+		total   = offset
+	)
+	for rows.Next() {
+		var (
+			startSeq  int64
+			lineCount int64
+			content   string
+			format    string
+		)
+		if err := rows.Scan(&startSeq, &lineCount, &content, &format); err != nil {
+			return nil, 0, fmt.Errorf("scan run log chunk: %w", err)
+		}
+		chunkEntries, err := decodeRunLogChunk(startSeq, content, format)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, sliceChunkEntries(startSeq, chunkEntries, offset)...)
+		total = startSeq + lineCount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if len(entries) == 0 {
+		// offset 已越过末尾时仍需返回真实的总行数
+		total, err = runLogLineCount(ctx, s.db, runID)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return entries, total, nil
+}
+
+func runLogLineCount(ctx context.Context, queryer queryRowContext, runID int64) (int64, error) {
+	var total int64
+	err := queryer.QueryRowContext(
+		ctx,
+		`SELECT COALESCE(MAX(start_seq + line_count), 0) FROM run_log_chunks WHERE run_id = ?`,
+		runID,
+	).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("count run log lines: %w", err)
+	}
+	return total, nil
+}
+
+// sliceChunkEntries drops the entries of a chunk that precede offset.
+func sliceChunkEntries(startSeq int64, entries []model.RunLogEntry, offset int64) []model.RunLogEntry {
+	if skip := offset - startSeq; skip > 0 {
+		if skip >= int64(len(entries)) {
+			return nil
+		}
+		return entries[skip:]
+	}
+	return entries
+}
+
+func encodeRunLogEntries(entries []model.RunLogEntry) (string, error) {
+	var builder strings.Builder
+	for _, entry := range entries {
+		line, err := json.Marshal(storedRunLogEntry{
+			Time:   entry.Time,
+			Stage:  entry.Stage,
+			Source: entry.Source,
+			Level:  entry.Level,
+			Text:   entry.Text,
+		})
+		if err != nil {
+			return "", fmt.Errorf("marshal run log entry: %w", err)
+		}
+		builder.Write(line)
+		builder.WriteByte('\n')
+	}
+	return builder.String(), nil
+}
+
+func decodeRunLogChunk(startSeq int64, content, format string) ([]model.RunLogEntry, error) {
+	lines := splitLogLines(content)
+	entries := make([]model.RunLogEntry, 0, len(lines))
+	for i, line := range lines {
+		entry := model.RunLogEntry{
+			Seq:    startSeq + int64(i),
+			Source: model.LogSourceSystem,
+			Level:  model.LogLevelInfo,
+			Text:   line,
+		}
+		if format == runLogFormatJSONL {
+			var stored storedRunLogEntry
+			if err := json.Unmarshal([]byte(line), &stored); err != nil {
+				return nil, fmt.Errorf("unmarshal run log entry: %w", err)
+			}
+			entry.Time = stored.Time
+			entry.Stage = stored.Stage
+			entry.Text = stored.Text
+			if stored.Source != "" {
+				entry.Source = stored.Source
+			}
+			if stored.Level != "" {
+				entry.Level = stored.Level
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func splitLogLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func joinLogLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// migrateRunLogText moves logs written before run_log_chunks existed out of
+// pipeline_runs.log_text, one run per transaction.
+func (s *Store) migrateRunLogText(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM pipeline_runs WHERE log_text IS NOT NULL AND log_text <> ''`)
+	if err != nil {
+		return fmt.Errorf("query legacy run logs: %w", err)
+	}
+	var runIDs []int64
+	for rows.Next() {
+		var runID int64
+		if err := rows.Scan(&runID); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan legacy run log: %w", err)
+		}
+		runIDs = append(runIDs, runID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, runID := range runIDs {
+		if err := s.migrateRunLogTextForRun(ctx, runID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) migrateRunLogTextForRun(ctx context.Context, runID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin run log migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	var logText string
+	if err := tx.QueryRowContext(ctx, `SELECT log_text FROM pipeline_runs WHERE id = ?`, runID).Scan(&logText); err != nil {
+		return fmt.Errorf("read legacy run log %d: %w", runID, err)
+	}
+
+	existing, err := runLogLineCount(ctx, tx, runID)
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		// 已有分片时无法把旧日志插到前面，保留 log_text 不做处理
+		return nil
+	}
+	if lines := splitLogLines(logText); len(lines) > 0 {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO run_log_chunks (run_id, start_seq, line_count, content, content_format, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			runID, 0, len(lines), joinLogLines(lines), runLogFormatText, nowString(),
+		); err != nil {
+			return fmt.Errorf("migrate run log %d: %w", runID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE pipeline_runs SET log_text = '' WHERE id = ?`, runID); err != nil {
+		return fmt.Errorf("clear legacy run log %d: %w", runID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit run log migration %d: %w", runID, err)
+	}
+	return nil
+}
@@ -3,45 +3,198 @@ package store
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"devops-pipeline/internal/model"
 )
 
-func TestAppendRunLogQuerySQLite(t *testing.T) {
-	query := appendRunLogQuery(false)
+func TestRunSelectQueryDoesNotReadLogText(t *testing.T) {
+	query := runSelectQuery()
+
+	if strings.Contains(query, "log_text") {
+		t.Fatalf("expected run query to leave log_text to run_log_chunks, got %q", query)
+	}
+}
+
+func TestSplitAndJoinLogLines(t *testing.T) {
+	lines := splitLogLines("[t] one\n[t] two\n")
+	if len(lines) != 2 || lines[0] != "[t] one" || lines[1] != "[t] two" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+	if got := joinLogLines(lines); got != "[t] one\n[t] two\n" {
+		t.Fatalf("unexpected joined log: got %q", got)
+	}
+	if got := splitLogLines(""); got != nil {
+		t.Fatalf("expected no lines for empty text, got %q", got)
+	}
+}
+
+func TestSliceChunkEntries(t *testing.T) {
+	entries, err := decodeRunLogChunk(10, "a\nb\nc\n", runLogFormatText)
+	if err != nil {
+		t.Fatalf("decode text chunk: %v", err)
+	}
+
+	tests := []struct {
+		offset int64
+		want   string
+	}{
+		{offset: 0, want: "a,b,c"},
+		{offset: 10, want: "a,b,c"},
+		{offset: 11, want: "b,c"},
+		{offset: 13, want: ""},
+	}
+	for _, tt := range tests {
+		var texts []string
+		for _, entry := range sliceChunkEntries(10, entries, tt.offset) {
+			texts = append(texts, entry.Text)
+		}
+		if got := strings.Join(texts, ","); got != tt.want {
+			t.Fatalf("sliceChunkEntries(offset %d) = %q want %q", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestRunLogEntriesRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC)
+	content, err := encodeRunLogEntries([]model.RunLogEntry{
+		{Time: at, Stage: "build", Source: model.LogSourceStderr, Level: model.LogLevelWarn, Text: "warning: x"},
+		{Time: at, Source: model.LogSourceSystem, Level: model.LogLevelInfo, Text: "done"},
+	})
+	if err != nil {
+		t.Fatalf("encode entries: %v", err)
+	}
+
+	entries, err := decodeRunLogChunk(4, content, runLogFormatJSONL)
+	if err != nil {
+		t.Fatalf("decode entries: %v", err)
+	}
+	want := model.RunLogEntry{Seq: 4, Time: at, Stage: "build", Source: model.LogSourceStderr, Level: model.LogLevelWarn, Text: "warning: x"}
+	if len(entries) != 2 || !entries[0].Time.Equal(at) {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	entries[0].Time = at
+	if entries[0] != want || entries[1].Seq != 5 || entries[1].Text != "done" {
+		t.Fatalf("unexpected entries: got %+v want first %+v", entries, want)
+	}
+}
+
+func TestDecodeTextChunkDefaultsToSystemInfo(t *testing.T) {
+	entries, err := decodeRunLogChunk(0, "[2026-10-19 08:30:00] legacy\n", runLogFormatText)
+	if err != nil {
+		t.Fatalf("decode text chunk: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Source != model.LogSourceSystem || entries[0].Level != model.LogLevelInfo || !entries[0].Time.IsZero() {
+		t.Fatalf("unexpected legacy entry: %+v", entries)
+	}
+	if got := RenderRunLog(entries); got != "[2026-10-19 08:30:00] legacy\n" {
+		t.Fatalf("unexpected rendered legacy log: got %q", got)
+	}
+}
 
-	if !strings.Contains(query, "COALESCE(log_text, '') || ?") {
-		t.Fatalf("expected sqlite log append query, got %q", query)
+func TestFilterRunLogEntries(t *testing.T) {
+	entries := []model.RunLogEntry{
+		{Seq: 0, Stage: "git-clone", Source: model.LogSourceSystem, Text: "clone"},
+		{Seq: 1, Stage: "build", Source: model.LogSourceStdout, Text: "one"},
+		{Seq: 2, Stage: "build", Source: model.LogSourceStderr, Text: "two"},
+		{Seq: 3, Stage: "build", Source: model.LogSourceStdout, Text: "three"},
 	}
-	if strings.Contains(query, "CONCAT(") {
-		t.Fatalf("did not expect mysql concat query, got %q", query)
+
+	got := filterRunLogEntries(entries, model.RunLogQuery{Stage: "build", Source: model.LogSourceStdout, Tail: 1})
+	if len(got) != 1 || got[0].Seq != 3 {
+		t.Fatalf("unexpected filtered entries: %+v", got)
+	}
+	if got := filterRunLogEntries(entries, model.RunLogQuery{}); len(got) != len(entries) {
+		t.Fatalf("expected unfiltered entries, got %+v", got)
 	}
 }
 
-func TestAppendRunLogQueryMySQL(t *testing.T) {
-	query := appendRunLogQuery(true)
+func TestRunFilterClauseEmpty(t *testing.T) {
+	where, args := runFilterClause(model.RunFilter{})
 
-	if !strings.Contains(query, "CONCAT(COALESCE(log_text, ''), ?)") {
-		t.Fatalf("expected mysql log append query, got %q", query)
+	if where != "" || len(args) != 0 {
+		t.Fatalf("expected no filter clause, got %q %v", where, args)
 	}
-	if strings.Contains(query, "|| ?") {
-		t.Fatalf("did not expect sqlite concatenation operator, got %q", query)
+}
+
+func TestRunFilterClauseCommitAndAuthor(t *testing.T) {
+	where, args := runFilterClause(model.RunFilter{ProjectID: 3, CommitPrefix: "AbC1", Author: "50%_dev"})
+
+	for _, fragment := range []string{
+		"pipeline_runs.project_id = ?",
+		"LOWER(pipeline_runs.commit_id) LIKE ? ESCAPE '!'",
+		"LOWER(pipeline_runs.author) LIKE ? ESCAPE '!'",
+	} {
+		if !strings.Contains(where, fragment) {
+			t.Fatalf("expected %q in filter clause, got %q", fragment, where)
+		}
+	}
+	want := []any{int64(3), "abc1%", "%50!%!_dev%"}
+	if len(args) != len(want) {
+		t.Fatalf("unexpected args: got %v want %v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("unexpected arg %d: got %v want %v", i, args[i], want[i])
+		}
 	}
 }
 
-func TestRunSelectQueryWithoutLogText(t *testing.T) {
-	query := runSelectQuery(false)
+func TestRunFilterClauseStatusBranchAndDates(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	where, args := runFilterClause(model.RunFilter{
+		Statuses:    []string{model.RunStatusSuccess, model.RunStatusFailed},
+		TriggerType: model.TriggerTypeWebhook,
+		Branch:      "main",
+		CreatedFrom: from,
+		CreatedTo:   from.AddDate(0, 0, 1),
+	})
 
-	if !strings.Contains(query, "'' AS log_text") {
-		t.Fatalf("expected summary run query to avoid loading log_text, got %q", query)
+	for _, fragment := range []string{
+		"pipeline_runs.status IN (?, ?)",
+		"pipeline_runs.trigger_type = ?",
+		"projects.branch = ?",
+		"pipeline_runs.created_at >= ?",
+		"pipeline_runs.created_at < ?",
+	} {
+		if !strings.Contains(where, fragment) {
+			t.Fatalf("expected %q in filter clause, got %q", fragment, where)
+		}
+	}
+	want := []any{"success", "failed", "webhook", "main", "2026-10-01T00:00:00Z", "2026-10-02T00:00:00Z"}
+	if len(args) != len(want) {
+		t.Fatalf("unexpected args: got %v want %v", args, want)
 	}
-	if strings.Contains(query, "pipeline_runs.log_text AS log_text") {
-		t.Fatalf("did not expect summary run query to select pipeline_runs.log_text, got %q", query)
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("unexpected arg %d: got %v want %v", i, args[i], want[i])
+		}
 	}
 }
 
-func TestRunSelectQueryWithLogText(t *testing.T) {
-	query := runSelectQuery(true)
+func TestRunCursorRoundTrip(t *testing.T) {
+	encoded := encodeRunCursor(model.RunSortDuration, true, model.PipelineRun{ID: 42, DurationMS: 1500})
+
+	cursor, err := decodeRunCursor(encoded)
+	if err != nil {
+		t.Fatalf("decode cursor: %v", err)
+	}
+	if cursor != (runCursor{Sort: model.RunSortDuration, Ascending: true, Key: "1500", ID: 42}) {
+		t.Fatalf("unexpected cursor: %+v", cursor)
+	}
+
+	condition, args, err := runCursorCondition("pipeline_runs.duration_ms", cursor)
+	if err != nil {
+		t.Fatalf("cursor condition: %v", err)
+	}
+	if condition != "(pipeline_runs.duration_ms > ? OR (pipeline_runs.duration_ms = ? AND pipeline_runs.id > ?))" {
+		t.Fatalf("unexpected condition: %q", condition)
+	}
+	if len(args) != 3 || args[0] != int64(1500) || args[2] != int64(42) {
+		t.Fatalf("unexpected args: %v", args)
+	}
 
-	if !strings.Contains(query, "pipeline_runs.log_text AS log_text") {
-		t.Fatalf("expected detail run query to include log_text, got %q", query)
+	if _, err := decodeRunCursor("not-a-cursor"); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
 	}
 }
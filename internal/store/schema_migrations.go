@@ -0,0 +1,583 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"devops-pipeline/internal/model"
+)
+
+// ErrSchemaTooNew is returned when the database or a backup was written by a
+// newer build that knows migrations this build does not.
+var ErrSchemaTooNew = errors.New("schema version is newer than this build supports")
+
+type migrationExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// schemaMigration 是一次带编号的结构变更，已发布的版本号和内容都不能再修改，
+// 新的变更只能追加新版本。
+type schemaMigration struct {
+	version int
+	name    string
+	// statements 按驱动区分的 DDL，在 up 之前执行
+	statements map[string][]string
+	up         func(ctx context.Context, q migrationExecutor) error
+	// selfManaged 的迁移自行分批提交（如搬迁大量日志），必须可以安全地重复执行
+	selfManaged bool
+}
+
+func (s *Store) schemaMigrations() []schemaMigration {
+	return []schemaMigration{
+		{
+			version: 1,
+			name:    "base_tables",
+			statements: map[string][]string{
+				DriverSQLite:   sqliteMigrationStatements(),
+				DriverMySQL:    mysqlMigrationStatements(),
+				DriverPostgres: postgresMigrationStatements(),
+			},
+		},
+		{
+			// 早期版本创建的库缺少这些列，新库执行时均为空操作
+			version: 2,
+			name:    "legacy_columns",
+			up: func(ctx context.Context, q migrationExecutor) error {
+				steps := []func(context.Context, migrationExecutor) error{
+					s.ensureDeployConfigCacheDirsColumn,
+					s.ensureProjectTriggerRuleColumns,
+					s.ensurePipelineRunPullRequestColumn,
+					s.ensureProjectCommitStatusColumns,
+					s.ensurePipelineRunCommitColumns,
+					s.ensurePipelineRunArtifactColumns,
+					s.ensurePipelineRunDurationColumn,
+					s.ensureRunLogChunkFormatColumn,
+				}
+				for _, step := range steps {
+					if err := step(ctx, q); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			version: 3,
+			name:    "sort_order",
+			up: func(ctx context.Context, q migrationExecutor) error {
+				for _, table := range []string{"hosts", "projects", "notification_channels"} {
+					if err := s.ensureSortOrderColumn(ctx, q, table); err != nil {
+						return err
+					}
+					if err := s.initializeSortOrder(ctx, q, table); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			version:     4,
+			name:        "run_log_chunks",
+			selfManaged: true,
+			up: func(ctx context.Context, _ migrationExecutor) error {
+				return s.migrateRunLogText(ctx)
+			},
+		},
+		{
+			version:     5,
+			name:        "run_log_search_index",
+			selfManaged: true,
+			up: func(ctx context.Context, _ migrationExecutor) error {
+				return s.indexPendingRunLogChunks(ctx)
+			},
+		},
+		{
+			// 原有的单个管理员账号升级为 admin 角色
+			version: 6,
+			name:    "users_and_roles",
+			statements: map[string][]string{
+				DriverSQLite: {
+					`CREATE TABLE IF NOT EXISTS project_permissions (
+						user_id INTEGER NOT NULL,
+						project_id INTEGER NOT NULL,
+						role TEXT NOT NULL,
+						created_at TEXT NOT NULL,
+						PRIMARY KEY (user_id, project_id),
+						FOREIGN KEY(user_id) REFERENCES admin_users(id) ON DELETE CASCADE,
+						FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+					);`,
+				},
+				DriverMySQL: {
+					`CREATE TABLE IF NOT EXISTS project_permissions (
+						user_id BIGINT NOT NULL,
+						project_id BIGINT NOT NULL,
+						role VARCHAR(32) NOT NULL,
+						created_at VARCHAR(64) NOT NULL,
+						PRIMARY KEY (user_id, project_id),
+						CONSTRAINT fk_project_permissions_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE,
+						CONSTRAINT fk_project_permissions_project FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+				},
+				DriverPostgres: {
+					`CREATE TABLE IF NOT EXISTS project_permissions (
+						user_id BIGINT NOT NULL,
+						project_id BIGINT NOT NULL,
+						role TEXT NOT NULL,
+						created_at TEXT NOT NULL,
+						PRIMARY KEY (user_id, project_id),
+						CONSTRAINT fk_project_permissions_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE,
+						CONSTRAINT fk_project_permissions_project FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+					);`,
+				},
+			},
+			up: func(ctx context.Context, q migrationExecutor) error {
+				columns := []struct {
+					table, column, sqliteDefinition, mysqlDefinition string
+				}{
+					{"admin_users", "role", `TEXT NOT NULL DEFAULT 'admin'`, `VARCHAR(32) NOT NULL DEFAULT 'admin'`},
+					{"admin_users", "disabled", `INTEGER NOT NULL DEFAULT 0`, `TINYINT(1) NOT NULL DEFAULT 0`},
+					{"pipeline_runs", "triggered_by", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(191) NOT NULL DEFAULT ''`},
+					{"pipeline_runs", "cancelled_by", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(191) NOT NULL DEFAULT ''`},
+				}
+				for _, column := range columns {
+					if err := s.ensureColumn(ctx, q, column.table, column.column, column.sqliteDefinition, column.mysqlDefinition); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			version: 7,
+			name:    "api_tokens",
+			statements: map[string][]string{
+				DriverSQLite: {
+					`CREATE TABLE IF NOT EXISTS api_tokens (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						user_id INTEGER NOT NULL,
+						name TEXT NOT NULL,
+						scope TEXT NOT NULL,
+						token_prefix TEXT NOT NULL,
+						token_hash TEXT NOT NULL UNIQUE,
+						expires_at TEXT NOT NULL,
+						last_used_at TEXT,
+						created_at TEXT NOT NULL,
+						FOREIGN KEY(user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);`,
+				},
+				DriverMySQL: {
+					`CREATE TABLE IF NOT EXISTS api_tokens (
+						id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+						user_id BIGINT NOT NULL,
+						name VARCHAR(255) NOT NULL,
+						scope VARCHAR(32) NOT NULL,
+						token_prefix VARCHAR(32) NOT NULL,
+						token_hash CHAR(64) NOT NULL,
+						expires_at VARCHAR(64) NOT NULL,
+						last_used_at VARCHAR(64) NULL,
+						created_at VARCHAR(64) NOT NULL,
+						UNIQUE KEY uniq_api_tokens_hash (token_hash),
+						KEY idx_api_tokens_user (user_id),
+						CONSTRAINT fk_api_tokens_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+				},
+				DriverPostgres: {
+					`CREATE TABLE IF NOT EXISTS api_tokens (
+						id BIGSERIAL PRIMARY KEY,
+						user_id BIGINT NOT NULL,
+						name TEXT NOT NULL,
+						scope TEXT NOT NULL,
+						token_prefix TEXT NOT NULL,
+						token_hash TEXT NOT NULL,
+						expires_at TEXT NOT NULL,
+						last_used_at TEXT NULL,
+						created_at TEXT NOT NULL,
+						CONSTRAINT uniq_api_tokens_hash UNIQUE (token_hash),
+						CONSTRAINT fk_api_tokens_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);`,
+				},
+			},
+		},
+		{
+			// actor_id 不设外键，删除账号后审计记录仍然保留
+			version: 8,
+			name:    "audit_events",
+			statements: map[string][]string{
+				DriverSQLite: {
+					`CREATE TABLE IF NOT EXISTS audit_events (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						actor_id INTEGER,
+						actor TEXT NOT NULL DEFAULT '',
+						action TEXT NOT NULL,
+						target_type TEXT NOT NULL DEFAULT '',
+						target_id TEXT NOT NULL DEFAULT '',
+						target_name TEXT NOT NULL DEFAULT '',
+						request_id TEXT NOT NULL DEFAULT '',
+						client_ip TEXT NOT NULL DEFAULT '',
+						changes_json TEXT NOT NULL DEFAULT '{}',
+						created_at TEXT NOT NULL
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id);`,
+				},
+				DriverMySQL: {
+					`CREATE TABLE IF NOT EXISTS audit_events (
+						id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+						actor_id BIGINT NULL,
+						actor VARCHAR(191) NOT NULL DEFAULT '',
+						action VARCHAR(64) NOT NULL,
+						target_type VARCHAR(64) NOT NULL DEFAULT '',
+						target_id VARCHAR(191) NOT NULL DEFAULT '',
+						target_name VARCHAR(255) NOT NULL DEFAULT '',
+						request_id VARCHAR(191) NOT NULL DEFAULT '',
+						client_ip VARCHAR(64) NOT NULL DEFAULT '',
+						changes_json LONGTEXT NOT NULL,
+						created_at VARCHAR(64) NOT NULL,
+						KEY idx_audit_events_created_at (created_at),
+						KEY idx_audit_events_target (target_type, target_id)
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+				},
+				DriverPostgres: {
+					`CREATE TABLE IF NOT EXISTS audit_events (
+						id BIGSERIAL PRIMARY KEY,
+						actor_id BIGINT NULL,
+						actor TEXT NOT NULL DEFAULT '',
+						action TEXT NOT NULL,
+						target_type TEXT NOT NULL DEFAULT '',
+						target_id TEXT NOT NULL DEFAULT '',
+						target_name TEXT NOT NULL DEFAULT '',
+						request_id TEXT NOT NULL DEFAULT '',
+						client_ip TEXT NOT NULL DEFAULT '',
+						changes_json TEXT NOT NULL DEFAULT '{}',
+						created_at TEXT NOT NULL
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id);`,
+				},
+			},
+		},
+		{
+			// totp_secret_cipher 在启用前保存待确认的密钥，totp_enabled 为 1 时才生效
+			version: 9,
+			name:    "two_factor",
+			statements: map[string][]string{
+				DriverSQLite: {
+					`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						user_id INTEGER NOT NULL,
+						code_hash TEXT NOT NULL,
+						used_at TEXT,
+						created_at TEXT NOT NULL,
+						FOREIGN KEY(user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user ON user_recovery_codes(user_id);`,
+				},
+				DriverMySQL: {
+					`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+						id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+						user_id BIGINT NOT NULL,
+						code_hash CHAR(64) NOT NULL,
+						used_at VARCHAR(64) NULL,
+						created_at VARCHAR(64) NOT NULL,
+						KEY idx_user_recovery_codes_user (user_id),
+						CONSTRAINT fk_user_recovery_codes_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+				},
+				DriverPostgres: {
+					`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+						id BIGSERIAL PRIMARY KEY,
+						user_id BIGINT NOT NULL,
+						code_hash TEXT NOT NULL,
+						used_at TEXT NULL,
+						created_at TEXT NOT NULL,
+						CONSTRAINT fk_user_recovery_codes_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user ON user_recovery_codes(user_id);`,
+				},
+			},
+			up: func(ctx context.Context, q migrationExecutor) error {
+				columns := []struct {
+					column, sqliteDefinition, mysqlDefinition string
+				}{
+					{"totp_secret_cipher", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(512) NOT NULL DEFAULT ''`},
+					{"totp_enabled", `INTEGER NOT NULL DEFAULT 0`, `TINYINT(1) NOT NULL DEFAULT 0`},
+					{"totp_last_step", `BIGINT NOT NULL DEFAULT 0`, `BIGINT NOT NULL DEFAULT 0`},
+				}
+				for _, column := range columns {
+					if err := s.ensureColumn(ctx, q, "admin_users", column.column, column.sqliteDefinition, column.mysqlDefinition); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			// 仍在使用默认密码的账号在下次登录时标记，改密码后清除
+			version: 10,
+			name:    "password_change_required",
+			up: func(ctx context.Context, q migrationExecutor) error {
+				return s.ensureColumn(ctx, q, "admin_users", "password_change_required", `INTEGER NOT NULL DEFAULT 0`, `TINYINT(1) NOT NULL DEFAULT 0`)
+			},
+		},
+		{
+			// 只保存刷新令牌的哈希，吊销会话即删除对应行
+			version: 11,
+			name:    "user_sessions",
+			statements: map[string][]string{
+				DriverSQLite: {
+					`CREATE TABLE IF NOT EXISTS user_sessions (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						user_id INTEGER NOT NULL,
+						refresh_token_hash TEXT NOT NULL UNIQUE,
+						user_agent TEXT NOT NULL DEFAULT '',
+						client_ip TEXT NOT NULL DEFAULT '',
+						created_at TEXT NOT NULL,
+						last_used_at TEXT NOT NULL,
+						expires_at TEXT NOT NULL,
+						FOREIGN KEY(user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id);`,
+				},
+				DriverMySQL: {
+					`CREATE TABLE IF NOT EXISTS user_sessions (
+						id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+						user_id BIGINT NOT NULL,
+						refresh_token_hash CHAR(64) NOT NULL,
+						user_agent VARCHAR(512) NOT NULL DEFAULT '',
+						client_ip VARCHAR(64) NOT NULL DEFAULT '',
+						created_at VARCHAR(64) NOT NULL,
+						last_used_at VARCHAR(64) NOT NULL,
+						expires_at VARCHAR(64) NOT NULL,
+						UNIQUE KEY uniq_user_sessions_token (refresh_token_hash),
+						KEY idx_user_sessions_user (user_id),
+						CONSTRAINT fk_user_sessions_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`,
+				},
+				DriverPostgres: {
+					`CREATE TABLE IF NOT EXISTS user_sessions (
+						id BIGSERIAL PRIMARY KEY,
+						user_id BIGINT NOT NULL,
+						refresh_token_hash TEXT NOT NULL,
+						user_agent TEXT NOT NULL DEFAULT '',
+						client_ip TEXT NOT NULL DEFAULT '',
+						created_at TEXT NOT NULL,
+						last_used_at TEXT NOT NULL,
+						expires_at TEXT NOT NULL,
+						CONSTRAINT uniq_user_sessions_token UNIQUE (refresh_token_hash),
+						CONSTRAINT fk_user_sessions_user FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+					);`,
+					`CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id);`,
+				},
+			},
+		},
+		{
+			// 已有账号都视为本地账号；之前由单点登录创建的账号需要管理员重新关联
+			version: 12,
+			name:    "user_auth_source",
+			up: func(ctx context.Context, q migrationExecutor) error {
+				if err := s.ensureColumn(ctx, q, "admin_users", "auth_source", `TEXT NOT NULL DEFAULT 'local'`, `VARCHAR(16) NOT NULL DEFAULT 'local'`); err != nil {
+					return err
+				}
+				return s.ensureColumn(ctx, q, "admin_users", "external_id", `TEXT NOT NULL DEFAULT ''`, `VARCHAR(255) NOT NULL DEFAULT ''`)
+			},
+		},
+		{
+			// 迁移 2 在 MySQL 上把规则列加成了可空列，与新建库的 NOT NULL 不一致
+			version: 13,
+			name:    "project_trigger_rules_not_null",
+			up:      s.ensureProjectTriggerRuleColumns,
+		},
+	}
+}
+
+func schemaMigrationsTableStatement(driver string) string {
+	switch driver {
+	case DriverMySQL:
+		return `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			applied_at VARCHAR(64) NOT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;`
+	default:
+		return `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			applied_at TEXT NOT NULL
+		);`
+	}
+}
+
+// LatestSchemaVersion returns the version of the newest migration this build
+// knows about.
+func (s *Store) LatestSchemaVersion() int {
+	migrations := s.schemaMigrations()
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the highest migration version applied to the
+// database, or 0 when none has been recorded.
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	if err := s.ensureSchemaMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrationStatus lists every known migration together with the ones recorded
+// in schema_migrations, ordered by version. Pending migrations have a nil
+// AppliedAt.
+func (s *Store) MigrationStatus(ctx context.Context) ([]model.SchemaMigration, error) {
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]model.SchemaMigration, 0, len(applied))
+	for _, migration := range s.schemaMigrations() {
+		status, ok := applied[migration.version]
+		if !ok {
+			status = model.SchemaMigration{Version: migration.version, Name: migration.name}
+		}
+		delete(applied, migration.version)
+		statuses = append(statuses, status)
+	}
+	// 由更新版本写入、本版本不认识的迁移也一并列出
+	for _, status := range applied {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Migrate applies every pending migration in version order. Each migration
+// runs in its own transaction and is recorded in schema_migrations together
+// with its changes; MySQL commits DDL implicitly, so there a failed migration
+// may leave part of its statements applied and is retried on the next start.
+func (s *Store) Migrate(ctx context.Context) error {
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest := s.LatestSchemaVersion()
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("database is at migration %d, this build knows up to %d: %w", version, latest, ErrSchemaTooNew)
+		}
+	}
+
+	for _, migration := range s.schemaMigrations() {
+		if _, ok := applied[migration.version]; ok {
+			continue
+		}
+		if err := s.applyMigration(ctx, migration); err != nil {
+			return fmt.Errorf("apply migration %d_%s: %w", migration.version, migration.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) applyMigration(ctx context.Context, migration schemaMigration) error {
+	startedAt := time.Now()
+	if migration.selfManaged {
+		if err := s.runMigration(ctx, s.db, migration); err != nil {
+			return err
+		}
+		return s.recordMigration(ctx, s.db, migration, time.Since(startedAt))
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.runMigration(ctx, tx, migration); err != nil {
+		return err
+	}
+	if err := s.recordMigration(ctx, tx, migration, time.Since(startedAt)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) runMigration(ctx context.Context, q migrationExecutor, migration schemaMigration) error {
+	for _, statement := range migration.statements[s.driver] {
+		if _, err := q.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("run migration statement: %w", err)
+		}
+	}
+	if migration.up != nil {
+		return migration.up(ctx, q)
+	}
+	return nil
+}
+
+func (s *Store) recordMigration(ctx context.Context, q migrationExecutor, migration schemaMigration, duration time.Duration) error {
+	if _, err := q.ExecContext(
+		ctx,
+		`INSERT INTO schema_migrations (version, name, duration_ms, applied_at) VALUES (?, ?, ?, ?)`,
+		migration.version, migration.name, duration.Milliseconds(), nowString(),
+	); err != nil {
+		return fmt.Errorf("record migration: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) ensureSchemaMigrationsTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, schemaMigrationsTableStatement(s.driver)); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) appliedMigrations(ctx context.Context) (map[int]model.SchemaMigration, error) {
+	if err := s.ensureSchemaMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, name, duration_ms, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("query schema migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]model.SchemaMigration)
+	for rows.Next() {
+		var (
+			migration model.SchemaMigration
+			appliedAt string
+		)
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.DurationMS, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan schema migration: %w", err)
+		}
+		parsed, err := parseTime(appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		migration.AppliedAt = &parsed
+		applied[migration.Version] = migration
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaMigrationsAreNumberedInOrder(t *testing.T) {
+	s := &Store{driver: DriverSQLite}
+	migrations := s.schemaMigrations()
+
+	seen := make(map[string]bool)
+	for i, migration := range migrations {
+		if migration.version != i+1 {
+			t.Fatalf("migration %q has version %d, want %d", migration.name, migration.version, i+1)
+		}
+		if migration.name == "" || seen[migration.name] {
+			t.Fatalf("migration %d needs a unique name, got %q", migration.version, migration.name)
+		}
+		seen[migration.name] = true
+
+		if migration.up != nil {
+			continue
+		}
+		for _, driver := range []string{DriverSQLite, DriverMySQL, DriverPostgres} {
+			if len(migration.statements[driver]) == 0 {
+				t.Fatalf("migration %d_%s has no statements for %s", migration.version, migration.name, driver)
+			}
+		}
+	}
+	if got, want := s.LatestSchemaVersion(), len(migrations); got != want {
+		t.Fatalf("unexpected latest schema version: got %d want %d", got, want)
+	}
+}
+
+func TestSchemaMigrationsTableStatement(t *testing.T) {
+	if statement := schemaMigrationsTableStatement(DriverMySQL); !strings.Contains(statement, "ENGINE=InnoDB") {
+		t.Fatalf("expected mysql table options, got %q", statement)
+	}
+	for _, driver := range []string{DriverSQLite, DriverPostgres} {
+		if statement := schemaMigrationsTableStatement(driver); !strings.Contains(statement, "version INTEGER PRIMARY KEY") {
+			t.Fatalf("unexpected %s statement %q", driver, statement)
+		}
+	}
+}
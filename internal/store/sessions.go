@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"devops-pipeline/internal/model"
+)
+
+const userSessionSelectColumns = `id, user_id, user_agent, client_ip, refresh_token_hash, created_at, last_used_at, expires_at`
+
+// CreateUserSession stores a new login session. Expired sessions of the same
+// user are purged on the way, so the table does not grow without bound.
+func (s *Store) CreateUserSession(ctx context.Context, session model.UserSession) (model.UserSession, error) {
+	if err := s.deleteExpiredUserSessions(ctx, session.UserID); err != nil {
+		return model.UserSession{}, err
+	}
+	now := nowString()
+	id, err := s.insertID(
+		ctx,
+		s.db,
+		`INSERT INTO user_sessions (user_id, refresh_token_hash, user_agent, client_ip, created_at, last_used_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, session.RefreshTokenHash, session.UserAgent, session.ClientIP,
+		now, now, session.ExpiresAt.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return model.UserSession{}, fmt.Errorf("create user session: %w", err)
+	}
+	return s.GetUserSession(ctx, id)
+}
+
+func (s *Store) GetUserSession(ctx context.Context, sessionID int64) (model.UserSession, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userSessionSelectColumns+` FROM user_sessions WHERE id = ?`, sessionID)
+	return scanUserSession(row)
+}
+
+// GetUserSessionByTokenHash looks a session up by the hash of its refresh token.
+func (s *Store) GetUserSessionByTokenHash(ctx context.Context, tokenHash string) (model.UserSession, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userSessionSelectColumns+` FROM user_sessions WHERE refresh_token_hash = ?`, tokenHash)
+	return scanUserSession(row)
+}
+
+// RotateUserSession replaces the refresh token of a session and extends it
+// to expiresAt. The update only matches while the session still holds
+// oldHash, so a refresh token can be exchanged once; a concurrent or replayed
+// exchange gets ErrNotFound.
+func (s *Store) RotateUserSession(ctx context.Context, sessionID int64, oldHash, newHash string, expiresAt time.Time) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE user_sessions SET refresh_token_hash = ?, last_used_at = ?, expires_at = ?
+		 WHERE id = ? AND refresh_token_hash = ?`,
+		newHash, nowString(), expiresAt.UTC().Format(time.RFC3339Nano), sessionID, oldHash,
+	)
+	if err != nil {
+		return fmt.Errorf("rotate user session: %w", err)
+	}
+	return expectDeleted(result)
+}
+
+// ListUserSessions returns the unexpired sessions of userID, most recently
+// used first.
+func (s *Store) ListUserSessions(ctx context.Context, userID int64) ([]model.UserSession, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+userSessionSelectColumns+` FROM user_sessions WHERE user_id = ? ORDER BY id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query user sessions: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []model.UserSession{}
+	for rows.Next() {
+		session, err := scanUserSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		// 时间以字符串保存，长度不固定，不能直接在 SQL 里比较，过期判断和排序都放在这里
+		if session.ExpiresAt.Before(now) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// DeleteUserSession revokes one session. Only the owner's sessions match.
+func (s *Store) DeleteUserSession(ctx context.Context, userID, sessionID int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("delete user session: %w", err)
+	}
+	return expectDeleted(result)
+}
+
+// DeleteUserSessions revokes all sessions of userID except exceptID (0 keeps
+// none) and returns how many were removed.
+func (s *Store) DeleteUserSessions(ctx context.Context, userID, exceptID int64) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = ? AND id <> ?`, userID, exceptID)
+	if err != nil {
+		return 0, fmt.Errorf("delete user sessions: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("read rows affected: %w", err)
+	}
+	return affected, nil
+}
+
+func (s *Store) deleteExpiredUserSessions(ctx context.Context, userID int64) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, expires_at FROM user_sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("query user sessions: %w", err)
+	}
+	now := time.Now()
+	var expired []int64
+	for rows.Next() {
+		var (
+			id           int64
+			expiresAtStr string
+		)
+		if err := rows.Scan(&id, &expiresAtStr); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan user session: %w", err)
+		}
+		if expiresAt, err := parseTime(expiresAtStr); err != nil || expiresAt.Before(now) {
+			expired = append(expired, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("query user sessions: %w", err)
+	}
+	rows.Close()
+
+	for _, id := range expired {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("delete expired user session: %w", err)
+		}
+	}
+	return nil
+}
+
+func scanUserSession(scan scanner) (model.UserSession, error) {
+	var (
+		session       model.UserSession
+		createdAtStr  string
+		lastUsedAtStr string
+		expiresAtStr  string
+	)
+	err := scan.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.ClientIP,
+		&session.RefreshTokenHash,
+		&createdAtStr,
+		&lastUsedAtStr,
+		&expiresAtStr,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.UserSession{}, ErrNotFound
+	}
+	if err != nil {
+		return model.UserSession{}, fmt.Errorf("scan user session: %w", err)
+	}
+
+	if session.CreatedAt, err = parseTime(createdAtStr); err != nil {
+		return model.UserSession{}, err
+	}
+	if session.LastUsedAt, err = parseTime(lastUsedAtStr); err != nil {
+		return model.UserSession{}, err
+	}
+	if session.ExpiresAt, err = parseTime(expiresAtStr); err != nil {
+		return model.UserSession{}, err
+	}
+	return session, nil
+}
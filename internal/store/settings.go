@@ -100,18 +100,6 @@ func (s *Store) SetSetting(ctx context.Context, key, value string) (model.Settin
 	return s.GetSetting(ctx, key)
 }
 
-func (s *Store) UpdateAdminUsername(ctx context.Context, username string) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		`UPDATE admin_users SET username = ?, updated_at = ?`,
-		username, nowString(),
-	)
-	if err != nil {
-		return fmt.Errorf("update admin username: %w", err)
-	}
-	return nil
-}
-
 func (s *Store) ClearRuns(ctx context.Context) (int64, error) {
 	result, err := s.db.ExecContext(ctx, `DELETE FROM pipeline_runs`)
 	if err != nil {
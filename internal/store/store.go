@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	cryptoutil "devops-pipeline/internal/crypto"
@@ -24,40 +25,6 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-func (s *Store) Migrate(ctx context.Context) error {
-	for _, statement := range s.migrationStatements() {
-		if _, err := s.db.ExecContext(ctx, statement); err != nil {
-			return fmt.Errorf("run migration: %w", err)
-		}
-	}
-
-	if err := s.ensureDeployConfigCacheDirsColumn(ctx); err != nil {
-		return err
-	}
-
-	if err := s.ensureSortOrderColumn(ctx, "hosts"); err != nil {
-		return err
-	}
-	if err := s.ensureSortOrderColumn(ctx, "projects"); err != nil {
-		return err
-	}
-	if err := s.ensureSortOrderColumn(ctx, "notification_channels"); err != nil {
-		return err
-	}
-
-	if err := s.initializeSortOrder(ctx, "hosts"); err != nil {
-		return err
-	}
-	if err := s.initializeSortOrder(ctx, "projects"); err != nil {
-		return err
-	}
-	if err := s.initializeSortOrder(ctx, "notification_channels"); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s *Store) CreateHost(ctx context.Context, input model.HostUpsert) (model.Host, error) {
 	encryptedPassword, err := s.cipher.Encrypt(valueOrEmpty(input.Password))
 	if err != nil {
@@ -69,8 +36,9 @@ func (s *Store) CreateHost(ctx context.Context, input model.HostUpsert) (model.H
 	if err != nil {
 		return model.Host{}, err
 	}
-	result, err := s.db.ExecContext(
+	id, err := s.insertID(
 		ctx,
+		s.db,
 		`INSERT INTO hosts (sort_order, name, address, port, username, password_cipher, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		nextSortOrder, input.Name, input.Address, input.Port, input.Username, encryptedPassword, now, now,
@@ -79,11 +47,6 @@ func (s *Store) CreateHost(ctx context.Context, input model.HostUpsert) (model.H
 		return model.Host{}, fmt.Errorf("insert host: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return model.Host{}, fmt.Errorf("get host id: %w", err)
-	}
-
 	return s.GetHost(ctx, id)
 }
 
@@ -249,16 +212,20 @@ func (s *Store) ReorderProjects(ctx context.Context, ids []int64) error {
 	return s.reorderRecords(ctx, "projects", ids)
 }
 
-func (s *Store) GetProject(ctx context.Context, id int64) (model.Project, error) {
-	row := s.db.QueryRowContext(
-		ctx,
-		`SELECT projects.id, projects.sort_order, projects.name, projects.repo_url, projects.branch, projects.description, projects.webhook_token,
+const projectSelectQuery = `SELECT projects.id, projects.sort_order, projects.name, projects.repo_url, projects.branch, projects.description, projects.webhook_token,
 		        (CASE WHEN deploy_configs.id IS NOT NULL THEN 1 ELSE 0 END) as has_deploy_config,
 		        projects.git_auth_type, projects.git_username_cipher, projects.git_password_cipher, projects.git_ssh_key_cipher,
+		        COALESCE(projects.path_includes_json, '[]'), COALESCE(projects.path_excludes_json, '[]'), COALESCE(projects.skip_markers_json, '[]'),
+		        projects.pr_builds_enabled,
+		        projects.commit_status_provider, projects.commit_status_api_url, COALESCE(projects.commit_status_token_cipher, ''),
 		        projects.created_at, projects.updated_at
 		 FROM projects
-		 LEFT JOIN deploy_configs ON deploy_configs.project_id = projects.id
-		 WHERE projects.id = ?`,
+		 LEFT JOIN deploy_configs ON deploy_configs.project_id = projects.id`
+
+func (s *Store) GetProject(ctx context.Context, id int64) (model.Project, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		projectSelectQuery+` WHERE projects.id = ?`,
 		id,
 	)
 	return s.scanProjectWithGitAuth(row)
@@ -267,13 +234,7 @@ func (s *Store) GetProject(ctx context.Context, id int64) (model.Project, error)
 func (s *Store) GetProjectByWebhookToken(ctx context.Context, token string) (model.Project, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT projects.id, projects.sort_order, projects.name, projects.repo_url, projects.branch, projects.description, projects.webhook_token,
-		        (CASE WHEN deploy_configs.id IS NOT NULL THEN 1 ELSE 0 END) as has_deploy_config,
-		        projects.git_auth_type, projects.git_username_cipher, projects.git_password_cipher, projects.git_ssh_key_cipher,
-		        projects.created_at, projects.updated_at
-		 FROM projects
-		 LEFT JOIN deploy_configs ON deploy_configs.project_id = projects.id
-		 WHERE projects.webhook_token = ?`,
+		projectSelectQuery+` WHERE projects.webhook_token = ?`,
 		token,
 	)
 	return s.scanProjectWithGitAuth(row)
@@ -282,13 +243,7 @@ func (s *Store) GetProjectByWebhookToken(ctx context.Context, token string) (mod
 func (s *Store) ListProjects(ctx context.Context) ([]model.Project, error) {
 	rows, err := s.db.QueryContext(
 		ctx,
-		`SELECT projects.id, projects.sort_order, projects.name, projects.repo_url, projects.branch, projects.description, projects.webhook_token,
-		        (CASE WHEN deploy_configs.id IS NOT NULL THEN 1 ELSE 0 END) as has_deploy_config,
-		        projects.git_auth_type, projects.git_username_cipher, projects.git_password_cipher, projects.git_ssh_key_cipher,
-		        projects.created_at, projects.updated_at
-		 FROM projects
-		 LEFT JOIN deploy_configs ON deploy_configs.project_id = projects.id
-		 ORDER BY projects.sort_order DESC, projects.id DESC`,
+		projectSelectQuery+` ORDER BY projects.sort_order DESC, projects.id DESC`,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("query projects: %w", err)
@@ -316,13 +271,7 @@ func (s *Store) CloneProject(ctx context.Context, sourceID int64, input model.Pr
 
 	sourceProjectRow := tx.QueryRowContext(
 		ctx,
-		`SELECT projects.id, projects.sort_order, projects.name, projects.repo_url, projects.branch, projects.description, projects.webhook_token,
-		        (CASE WHEN deploy_configs.id IS NOT NULL THEN 1 ELSE 0 END) as has_deploy_config,
-		        projects.git_auth_type, projects.git_username_cipher, projects.git_password_cipher, projects.git_ssh_key_cipher,
-		        projects.created_at, projects.updated_at
-		 FROM projects
-		 LEFT JOIN deploy_configs ON deploy_configs.project_id = projects.id
-		 WHERE projects.id = ?`,
+		projectSelectQuery+` WHERE projects.id = ?`,
 		sourceID,
 	)
 
@@ -357,26 +306,29 @@ func (s *Store) CloneProject(ctx context.Context, sourceID int64, input model.Pr
 		return model.ProjectDetail{}, fmt.Errorf("encrypt git ssh key: %w", err)
 	}
 
+	commitStatusTokenCipher, err := s.cipher.Encrypt(sourceProject.CommitStatusToken)
+	if err != nil {
+		return model.ProjectDetail{}, fmt.Errorf("encrypt commit status token: %w", err)
+	}
+
 	now := nowString()
 	nextSortOrder, err := s.nextSortOrder(ctx, tx, "projects")
 	if err != nil {
 		return model.ProjectDetail{}, err
 	}
-	result, err := tx.ExecContext(
+	projectID, err := s.insertID(
 		ctx,
-		`INSERT INTO projects (sort_order, name, repo_url, branch, description, webhook_token, git_auth_type, git_username_cipher, git_password_cipher, git_ssh_key_cipher, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		nextSortOrder, input.Name, sourceProject.RepoURL, input.Branch, description, token, sourceProject.GitAuthType, gitUsernameCipher, gitPasswordCipher, gitSSHKeyCipher, now, now,
+		tx,
+		`INSERT INTO projects (sort_order, name, repo_url, branch, description, webhook_token, git_auth_type, git_username_cipher, git_password_cipher, git_ssh_key_cipher, path_includes_json, path_excludes_json, skip_markers_json, pr_builds_enabled, commit_status_provider, commit_status_api_url, commit_status_token_cipher, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nextSortOrder, input.Name, sourceProject.RepoURL, input.Branch, description, token, sourceProject.GitAuthType, gitUsernameCipher, gitPasswordCipher, gitSSHKeyCipher,
+		mustMarshal(sourceProject.PathIncludes), mustMarshal(sourceProject.PathExcludes), mustMarshal(sourceProject.SkipMarkers), boolToInt(sourceProject.PRBuildsEnabled),
+		sourceProject.CommitStatusProvider, sourceProject.CommitStatusAPIURL, commitStatusTokenCipher, now, now,
 	)
 	if err != nil {
 		return model.ProjectDetail{}, wrapProjectMutationError("clone", err)
 	}
 
-	projectID, err := result.LastInsertId()
-	if err != nil {
-		return model.ProjectDetail{}, fmt.Errorf("get cloned project id: %w", err)
-	}
-
 	config, err := s.getDeployConfigWithExecutor(ctx, tx, sourceID)
 	if err != nil && !errors.Is(err, ErrNotFound) {
 		return model.ProjectDetail{}, err
@@ -469,7 +421,7 @@ func (s *Store) upsertDeployConfigWithExecutor(ctx context.Context, executor exe
 	}
 
 	now := nowString()
-	query := deployConfigUpsertQuery(s.isMySQL())
+	query := deployConfigUpsertQuery(s.driver)
 	_, err = executor.ExecContext(
 		ctx,
 		query,
@@ -511,7 +463,9 @@ func (s *Store) ensureHostExistsWithExecutor(ctx context.Context, queryer queryR
 	return nil
 }
 
-func deployConfigUpsertQuery(isMySQL bool) string {
+// deployConfigUpsertQuery returns the upsert statement for driver. SQLite and
+// PostgreSQL share the ON CONFLICT form; MySQL uses ON DUPLICATE KEY UPDATE.
+func deployConfigUpsertQuery(driver string) string {
 	query := `INSERT INTO deploy_configs (
 		project_id, host_id, build_image, build_commands_json, cache_dirs_json, artifact_filter_mode,
 		artifact_rules_json, remote_save_dir, remote_deploy_dir, pre_deploy_commands_json,
@@ -534,7 +488,7 @@ func deployConfigUpsertQuery(isMySQL bool) string {
 		notify_token_cipher = excluded.notify_token_cipher,
 		notification_channel_id = excluded.notification_channel_id,
 		updated_at = excluded.updated_at`
-	if isMySQL {
+	if driver == DriverMySQL {
 		query = `INSERT INTO deploy_configs (
 			project_id, host_id, build_image, build_commands_json, cache_dirs_json, artifact_filter_mode,
 			artifact_rules_json, remote_save_dir, remote_deploy_dir, pre_deploy_commands_json,
@@ -629,21 +583,17 @@ func (s *Store) GetExecutionBundle(ctx context.Context, projectID int64) (model.
 
 func (s *Store) CreateRun(ctx context.Context, input model.RunCreateInput) (model.PipelineRun, error) {
 	now := nowString()
-	result, err := s.db.ExecContext(
+	id, err := s.insertID(
 		ctx,
-		`INSERT INTO pipeline_runs (project_id, status, trigger_type, trigger_ref, log_text, error_message, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		input.ProjectID, input.Status, input.TriggerType, input.TriggerRef, "", "", now, now,
+		s.db,
+		`INSERT INTO pipeline_runs (project_id, status, trigger_type, trigger_ref, pull_request_number, triggered_by, log_text, error_message, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		input.ProjectID, input.Status, input.TriggerType, input.TriggerRef, input.PullRequestNumber, input.TriggeredBy, "", "", now, now,
 	)
 	if err != nil {
 		return model.PipelineRun{}, fmt.Errorf("insert run: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return model.PipelineRun{}, fmt.Errorf("get run id: %w", err)
-	}
-
 	return s.GetRun(ctx, id)
 }
 
@@ -662,40 +612,68 @@ func (s *Store) MarkRunRunning(ctx context.Context, runID int64) error {
 	return nil
 }
 
-func (s *Store) AppendRunLog(ctx context.Context, runID int64, line string) error {
-	query := appendRunLogQuery(s.isMySQL())
+// SetRunCommit records the commit a run was built from.
+func (s *Store) SetRunCommit(ctx context.Context, runID int64, commitID, commitMessage, author string) error {
 	_, err := s.db.ExecContext(
 		ctx,
-		query,
-		line,
-		nowString(),
-		runID,
+		`UPDATE pipeline_runs
+		 SET commit_id = ?, commit_message = ?, author = ?, updated_at = ?
+		 WHERE id = ?`,
+		commitID, commitMessage, author, nowString(), runID,
+	)
+	if err != nil {
+		return fmt.Errorf("set run commit: %w", err)
+	}
+	return nil
+}
+
+// SetRunArtifact records the size and SHA-256 digest of the run's artifact
+// archive; zero values clear them once the archive is removed.
+func (s *Store) SetRunArtifact(ctx context.Context, runID, size int64, sha256 string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE pipeline_runs
+		 SET artifact_size = ?, artifact_sha256 = ?, updated_at = ?
+		 WHERE id = ?`,
+		size, sha256, nowString(), runID,
 	)
 	if err != nil {
-		return fmt.Errorf("append run log: %w", err)
+		return fmt.Errorf("set run artifact: %w", err)
 	}
 	return nil
 }
 
-func appendRunLogQuery(isMySQL bool) string {
-	if isMySQL {
-		return `UPDATE pipeline_runs
-		 SET log_text = CONCAT(COALESCE(log_text, ''), ?), updated_at = ?
-		 WHERE id = ?`
+// SetRunCancelledBy records the user who cancelled a run.
+func (s *Store) SetRunCancelledBy(ctx context.Context, runID int64, username string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE pipeline_runs SET cancelled_by = ?, updated_at = ? WHERE id = ?`,
+		username, nowString(), runID,
+	)
+	if err != nil {
+		return fmt.Errorf("set run cancelled by: %w", err)
 	}
-	return `UPDATE pipeline_runs
-	 SET log_text = COALESCE(log_text, '') || ?, updated_at = ?
-	 WHERE id = ?`
+	return nil
 }
 
 func (s *Store) FinalizeRun(ctx context.Context, runID int64, status string, errorMessage string) error {
+	var startedAt sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT started_at FROM pipeline_runs WHERE id = ?`, runID).Scan(&startedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read run start: %w", err)
+	}
+
 	now := nowString()
-	_, err := s.db.ExecContext(
+	var durationMS int64
+	if startedAt.Valid {
+		durationMS = runDurationMS(startedAt.String, now)
+	}
+	_, err = s.db.ExecContext(
 		ctx,
 		`UPDATE pipeline_runs
-		 SET status = ?, error_message = ?, finished_at = ?, updated_at = ?
+		 SET status = ?, error_message = ?, finished_at = ?, duration_ms = ?, updated_at = ?
 		 WHERE id = ?`,
-		status, errorMessage, now, now, runID,
+		status, errorMessage, now, durationMS, now, runID,
 	)
 	if err != nil {
 		return fmt.Errorf("finalize run: %w", err)
@@ -703,77 +681,68 @@ func (s *Store) FinalizeRun(ctx context.Context, runID int64, status string, err
 	return nil
 }
 
-func runSelectQuery(includeLog bool) string {
-	logField := "''"
-	if includeLog {
-		logField = "pipeline_runs.log_text"
+func runDurationMS(startedAt, finishedAt string) int64 {
+	start, err := parseTime(startedAt)
+	if err != nil {
+		return 0
 	}
+	finish, err := parseTime(finishedAt)
+	if err != nil || finish.Before(start) {
+		return 0
+	}
+	return finish.Sub(start).Milliseconds()
+}
 
-	return fmt.Sprintf(`SELECT pipeline_runs.id, pipeline_runs.project_id, projects.name, projects.branch,
-		        pipeline_runs.status, pipeline_runs.trigger_type, pipeline_runs.trigger_ref,
-		        %s AS log_text, pipeline_runs.error_message,
+// runSelectQuery selects run summaries. Log lines live in run_log_chunks and
+// are loaded separately, so the legacy pipeline_runs.log_text is never read.
+func runSelectQuery() string {
+	return `SELECT pipeline_runs.id, pipeline_runs.project_id, projects.name, projects.branch,
+		        pipeline_runs.status, pipeline_runs.trigger_type, pipeline_runs.trigger_ref, pipeline_runs.pull_request_number,
+		        pipeline_runs.commit_id, COALESCE(pipeline_runs.commit_message, ''), pipeline_runs.author,
+		        pipeline_runs.triggered_by, pipeline_runs.cancelled_by,
+		        pipeline_runs.artifact_size, pipeline_runs.artifact_sha256, pipeline_runs.duration_ms, pipeline_runs.error_message,
 		        pipeline_runs.started_at, pipeline_runs.finished_at, pipeline_runs.created_at, pipeline_runs.updated_at
 		 FROM pipeline_runs
-		 JOIN projects ON projects.id = pipeline_runs.project_id`, logField)
+		 JOIN projects ON projects.id = pipeline_runs.project_id`
 }
 
+// GetRun returns the run together with its full log text.
 func (s *Store) GetRun(ctx context.Context, runID int64) (model.PipelineRun, error) {
-	row := s.db.QueryRowContext(
-		ctx,
-		runSelectQuery(true)+`
-		 WHERE pipeline_runs.id = ?`,
-		runID,
-	)
-	return scanRun(row)
+	run, err := s.GetRunSummary(ctx, runID)
+	if err != nil {
+		return model.PipelineRun{}, err
+	}
+
+	entries, _, err := s.readRunLogEntries(ctx, runID, 0)
+	if err != nil {
+		return model.PipelineRun{}, err
+	}
+	run.LogText = RenderRunLog(entries)
+	return run, nil
 }
 
 func (s *Store) GetRunSummary(ctx context.Context, runID int64) (model.PipelineRun, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		runSelectQuery(false)+`
+		runSelectQuery()+`
 		 WHERE pipeline_runs.id = ?`,
 		runID,
 	)
 	return scanRun(row)
 }
 
-func (s *Store) GetRunLog(ctx context.Context, runID int64) (model.PipelineRunLog, error) {
-	row := s.db.QueryRowContext(
-		ctx,
-		`SELECT id, log_text, updated_at
-		 FROM pipeline_runs
-		 WHERE id = ?`,
-		runID,
-	)
-
-	var (
-		logEntry        model.PipelineRunLog
-		updatedAtString string
-	)
-	if err := row.Scan(&logEntry.RunID, &logEntry.LogText, &updatedAtString); errors.Is(err, sql.ErrNoRows) {
-		return model.PipelineRunLog{}, ErrNotFound
-	} else if err != nil {
-		return model.PipelineRunLog{}, fmt.Errorf("scan run log: %w", err)
-	}
-
-	updatedAt, err := parseTime(updatedAtString)
-	if err != nil {
-		return model.PipelineRunLog{}, err
-	}
-	logEntry.UpdatedAt = updatedAt
-
-	return logEntry, nil
+func (s *Store) ListRunsByProject(ctx context.Context, projectID int64, limit int) ([]model.PipelineRun, error) {
+	return s.ListRuns(ctx, model.RunFilter{ProjectID: projectID}, 0, limit)
 }
 
-func (s *Store) ListRunsByProject(ctx context.Context, projectID int64, limit int) ([]model.PipelineRun, error) {
-	rows, err := s.db.QueryContext(
-		ctx,
-		runSelectQuery(false)+`
-		 WHERE pipeline_runs.project_id = ?
+func (s *Store) ListRuns(ctx context.Context, filter model.RunFilter, offset, limit int) ([]model.PipelineRun, error) {
+	where, args := runFilterClause(filter)
+	query := runSelectQuery() + where + `
 		 ORDER BY pipeline_runs.id DESC
-		 LIMIT ?`,
-		projectID, limit,
-	)
+		 LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query runs: %w", err)
 	}
@@ -791,27 +760,57 @@ func (s *Store) ListRunsByProject(ctx context.Context, projectID int64, limit in
 	return runs, rows.Err()
 }
 
-func (s *Store) ListAllRuns(ctx context.Context, offset, limit int) ([]model.PipelineRun, error) {
-	query := runSelectQuery(false) + `
-		 ORDER BY pipeline_runs.id DESC
-		 LIMIT ? OFFSET ?`
-
-	rows, err := s.db.QueryContext(ctx, query, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("query all runs: %w", err)
-	}
-	defer rows.Close()
-
-	var runs []model.PipelineRun
-	for rows.Next() {
-		run, err := scanRun(rows)
-		if err != nil {
-			return nil, err
+// runFilterClause builds the WHERE clause for filter. LIKE patterns escape
+// their wildcards with '!' because backslash escaping differs between dialects.
+func runFilterClause(filter model.RunFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.ProjectID > 0 {
+		conditions = append(conditions, "pipeline_runs.project_id = ?")
+		args = append(args, filter.ProjectID)
+	}
+	if len(filter.Statuses) > 0 {
+		conditions = append(conditions, "pipeline_runs.status IN ("+placeholders(len(filter.Statuses))+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
 		}
-		runs = append(runs, run)
 	}
+	if filter.TriggerType != "" {
+		conditions = append(conditions, "pipeline_runs.trigger_type = ?")
+		args = append(args, filter.TriggerType)
+	}
+	if filter.Branch != "" {
+		conditions = append(conditions, "projects.branch = ?")
+		args = append(args, filter.Branch)
+	}
+	if filter.CommitPrefix != "" {
+		conditions = append(conditions, "LOWER(pipeline_runs.commit_id) LIKE ? ESCAPE '!'")
+		args = append(args, escapeLikePattern(strings.ToLower(filter.CommitPrefix))+"%")
+	}
+	if filter.Author != "" {
+		conditions = append(conditions, "LOWER(pipeline_runs.author) LIKE ? ESCAPE '!'")
+		args = append(args, "%"+escapeLikePattern(strings.ToLower(filter.Author))+"%")
+	}
+	// created_at 统一以 UTC RFC3339 字符串保存，可以直接按字符串比较
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "pipeline_runs.created_at >= ?")
+		args = append(args, filter.CreatedFrom.UTC().Format(time.RFC3339Nano))
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "pipeline_runs.created_at < ?")
+		args = append(args, filter.CreatedTo.UTC().Format(time.RFC3339Nano))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return `
+		 WHERE ` + strings.Join(conditions, " AND "), args
+}
 
-	return runs, rows.Err()
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
 }
 
 func (s *Store) CountActiveRuns(ctx context.Context) (int64, error) {
@@ -959,7 +958,7 @@ func (s *Store) GetHomeDashboard(ctx context.Context) (model.HomeDashboard, erro
 func (s *Store) listRunsForDashboard(ctx context.Context) ([]model.PipelineRun, error) {
 	rows, err := s.db.QueryContext(
 		ctx,
-		runSelectQuery(false)+`
+		runSelectQuery()+`
 		 ORDER BY pipeline_runs.id DESC`,
 	)
 	if err != nil {
@@ -1000,24 +999,28 @@ func (s *Store) insertProjectWithExecutor(ctx context.Context, executor execQuer
 		return 0, err
 	}
 
+	commitStatusProvider, commitStatusAPIURL, commitStatusTokenCipher, err := s.prepareProjectCommitStatus(nil, input)
+	if err != nil {
+		return 0, err
+	}
+
 	nextSortOrder, err := s.nextSortOrder(ctx, executor, "projects")
 	if err != nil {
 		return 0, err
 	}
-	result, err := executor.ExecContext(
+	id, err := s.insertID(
 		ctx,
-		`INSERT INTO projects (sort_order, name, repo_url, branch, description, webhook_token, git_auth_type, git_username_cipher, git_password_cipher, git_ssh_key_cipher, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		nextSortOrder, input.Name, input.RepoURL, input.Branch, input.Description, token, gitAuthType, gitUsernameCipher, gitPasswordCipher, gitSSHKeyCipher, now, now,
+		executor,
+		`INSERT INTO projects (sort_order, name, repo_url, branch, description, webhook_token, git_auth_type, git_username_cipher, git_password_cipher, git_ssh_key_cipher, path_includes_json, path_excludes_json, skip_markers_json, pr_builds_enabled, commit_status_provider, commit_status_api_url, commit_status_token_cipher, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nextSortOrder, input.Name, input.RepoURL, input.Branch, input.Description, token, gitAuthType, gitUsernameCipher, gitPasswordCipher, gitSSHKeyCipher,
+		mustMarshal(model.NormalizePathFilters(input.PathIncludes)), mustMarshal(model.NormalizePathFilters(input.PathExcludes)),
+		mustMarshal(model.NormalizeSkipMarkers(input.SkipMarkers)), boolToInt(input.PRBuildsEnabled != nil && *input.PRBuildsEnabled),
+		commitStatusProvider, commitStatusAPIURL, commitStatusTokenCipher, now, now,
 	)
 	if err != nil {
 		return 0, wrapProjectMutationError("insert", err)
 	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("get project id: %w", err)
-	}
 	return id, nil
 }
 
@@ -1027,12 +1030,37 @@ func (s *Store) updateProjectWithExecutor(ctx context.Context, executor execQuer
 		return err
 	}
 
+	pathIncludes := currentProject.PathIncludes
+	if input.PathIncludes != nil {
+		pathIncludes = model.NormalizePathFilters(input.PathIncludes)
+	}
+	pathExcludes := currentProject.PathExcludes
+	if input.PathExcludes != nil {
+		pathExcludes = model.NormalizePathFilters(input.PathExcludes)
+	}
+	skipMarkers := currentProject.SkipMarkers
+	if input.SkipMarkers != nil {
+		skipMarkers = model.NormalizeSkipMarkers(input.SkipMarkers)
+	}
+	prBuildsEnabled := currentProject.PRBuildsEnabled
+	if input.PRBuildsEnabled != nil {
+		prBuildsEnabled = *input.PRBuildsEnabled
+	}
+	commitStatusProvider, commitStatusAPIURL, commitStatusTokenCipher, err := s.prepareProjectCommitStatus(&currentProject, input)
+	if err != nil {
+		return err
+	}
+
 	_, err = executor.ExecContext(
 		ctx,
 		`UPDATE projects
-		 SET name = ?, repo_url = ?, branch = ?, description = ?, git_auth_type = ?, git_username_cipher = ?, git_password_cipher = ?, git_ssh_key_cipher = ?, updated_at = ?
+		 SET name = ?, repo_url = ?, branch = ?, description = ?, git_auth_type = ?, git_username_cipher = ?, git_password_cipher = ?, git_ssh_key_cipher = ?,
+		     path_includes_json = ?, path_excludes_json = ?, skip_markers_json = ?, pr_builds_enabled = ?,
+		     commit_status_provider = ?, commit_status_api_url = ?, commit_status_token_cipher = ?, updated_at = ?
 		 WHERE id = ?`,
-		input.Name, input.RepoURL, input.Branch, input.Description, gitAuthType, gitUsernameCipher, gitPasswordCipher, gitSSHKeyCipher, nowString(), id,
+		input.Name, input.RepoURL, input.Branch, input.Description, gitAuthType, gitUsernameCipher, gitPasswordCipher, gitSSHKeyCipher,
+		mustMarshal(pathIncludes), mustMarshal(pathExcludes), mustMarshal(skipMarkers), boolToInt(prBuildsEnabled),
+		commitStatusProvider, commitStatusAPIURL, commitStatusTokenCipher, nowString(), id,
 	)
 	if err != nil {
 		return wrapProjectMutationError("update", err)
@@ -1040,6 +1068,30 @@ func (s *Store) updateProjectWithExecutor(ctx context.Context, executor execQuer
 	return nil
 }
 
+// prepareProjectCommitStatus resolves the commit status settings to persist;
+// nil fields keep the current project's values.
+func (s *Store) prepareProjectCommitStatus(currentProject *model.Project, input model.ProjectUpsert) (string, string, string, error) {
+	var provider, apiURL, token string
+	if currentProject != nil {
+		provider, apiURL, token = currentProject.CommitStatusProvider, currentProject.CommitStatusAPIURL, currentProject.CommitStatusToken
+	}
+	if input.CommitStatusProvider != nil {
+		provider = *input.CommitStatusProvider
+	}
+	if input.CommitStatusAPIURL != nil {
+		apiURL = *input.CommitStatusAPIURL
+	}
+	if input.CommitStatusToken != nil {
+		token = *input.CommitStatusToken
+	}
+
+	tokenCipher, err := s.cipher.Encrypt(token)
+	if err != nil {
+		return "", "", "", fmt.Errorf("encrypt commit status token: %w", err)
+	}
+	return provider, apiURL, tokenCipher, nil
+}
+
 func (s *Store) prepareProjectGitAuth(currentProject *model.Project, input model.ProjectUpsert) (string, string, string, string, error) {
 	gitAuthType := input.GitAuthType
 	if gitAuthType == "" {
@@ -1199,6 +1251,11 @@ func (s *Store) scanProjectWithGitAuth(scan scanner) (model.Project, error) {
 		gitUsernameCipher string
 		gitPasswordCipher string
 		gitSSHKeyCipher   string
+		pathIncludesJSON  string
+		pathExcludesJSON  string
+		skipMarkersJSON   string
+		prBuildsEnabled   int64
+		statusTokenCipher string
 		createdAtString   string
 		updatedAtString   string
 	)
@@ -1216,6 +1273,13 @@ func (s *Store) scanProjectWithGitAuth(scan scanner) (model.Project, error) {
 		&gitUsernameCipher,
 		&gitPasswordCipher,
 		&gitSSHKeyCipher,
+		&pathIncludesJSON,
+		&pathExcludesJSON,
+		&skipMarkersJSON,
+		&prBuildsEnabled,
+		&project.CommitStatusProvider,
+		&project.CommitStatusAPIURL,
+		&statusTokenCipher,
 		&createdAtString,
 		&updatedAtString,
 	)
@@ -1228,6 +1292,7 @@ func (s *Store) scanProjectWithGitAuth(scan scanner) (model.Project, error) {
 
 	project.HasDeployConfig = hasDeployConfig == 1
 	project.GitAuthType = gitAuthType
+	project.PRBuildsEnabled = prBuildsEnabled == 1
 
 	// 解密Git认证信息
 	if gitUsernameCipher != "" {
@@ -1254,10 +1319,28 @@ func (s *Store) scanProjectWithGitAuth(scan scanner) (model.Project, error) {
 	project.HasGitPassword = project.GitPassword != ""
 	project.HasGitSSHKey = project.GitSSHKey != ""
 
+	if statusTokenCipher != "" {
+		project.CommitStatusToken, err = s.cipher.Decrypt(statusTokenCipher)
+		if err != nil {
+			return model.Project{}, fmt.Errorf("decrypt commit status token: %w", err)
+		}
+	}
+	project.HasCommitStatusToken = project.CommitStatusToken != ""
+
 	// 判断是否有Git认证信息
 	project.HasGitAuth = project.GitAuthType != model.GitAuthTypeNone &&
 		(project.GitUsername != "" || project.GitPassword != "" || project.GitSSHKey != "")
 
+	if err = json.Unmarshal([]byte(pathIncludesJSON), &project.PathIncludes); err != nil {
+		return model.Project{}, fmt.Errorf("unmarshal path includes: %w", err)
+	}
+	if err = json.Unmarshal([]byte(pathExcludesJSON), &project.PathExcludes); err != nil {
+		return model.Project{}, fmt.Errorf("unmarshal path excludes: %w", err)
+	}
+	if err = json.Unmarshal([]byte(skipMarkersJSON), &project.SkipMarkers); err != nil {
+		return model.Project{}, fmt.Errorf("unmarshal skip markers: %w", err)
+	}
+
 	project.CreatedAt, err = parseTime(createdAtString)
 	if err != nil {
 		return model.Project{}, err
@@ -1367,11 +1450,12 @@ func (s *Store) scanDeployConfig(scan scanner) (model.DeployConfig, error) {
 
 func scanRun(scan scanner) (model.PipelineRun, error) {
 	var (
-		run              model.PipelineRun
-		startedAtString  sql.NullString
-		finishedAtString sql.NullString
-		createdAtString  string
-		updatedAtString  string
+		run               model.PipelineRun
+		pullRequestNumber sql.NullInt64
+		startedAtString   sql.NullString
+		finishedAtString  sql.NullString
+		createdAtString   string
+		updatedAtString   string
 	)
 
 	err := scan.Scan(
@@ -1382,7 +1466,15 @@ func scanRun(scan scanner) (model.PipelineRun, error) {
 		&run.Status,
 		&run.TriggerType,
 		&run.TriggerRef,
-		&run.LogText,
+		&pullRequestNumber,
+		&run.CommitID,
+		&run.CommitMessage,
+		&run.Author,
+		&run.TriggeredBy,
+		&run.CancelledBy,
+		&run.ArtifactSize,
+		&run.ArtifactSHA256,
+		&run.DurationMS,
 		&run.ErrorMessage,
 		&startedAtString,
 		&finishedAtString,
@@ -1395,6 +1487,9 @@ func scanRun(scan scanner) (model.PipelineRun, error) {
 	if err != nil {
 		return model.PipelineRun{}, fmt.Errorf("scan run: %w", err)
 	}
+	if pullRequestNumber.Valid {
+		run.PullRequestNumber = &pullRequestNumber.Int64
+	}
 
 	createdAt, err := parseTime(createdAtString)
 	if err != nil {
@@ -1584,8 +1679,9 @@ func (s *Store) CreateNotificationChannel(ctx context.Context, input model.Notif
 	if err != nil {
 		return model.NotificationChannel{}, err
 	}
-	result, err := tx.ExecContext(
+	id, err := s.insertID(
 		ctx,
+		tx,
 		`INSERT INTO notification_channels (sort_order, name, type, is_default, remark, config_json, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		nextSortOrder, input.Name, input.Type, boolToInt(input.IsDefault), input.Remark, string(configJSON), now, now,
@@ -1594,11 +1690,6 @@ func (s *Store) CreateNotificationChannel(ctx context.Context, input model.Notif
 		return model.NotificationChannel{}, fmt.Errorf("insert notification channel: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return model.NotificationChannel{}, fmt.Errorf("get channel id: %w", err)
-	}
-
 	if err := tx.Commit(); err != nil {
 		return model.NotificationChannel{}, fmt.Errorf("commit create notification channel transaction: %w", err)
 	}
@@ -1833,132 +1924,23 @@ func boolToInt(b bool) int {
 	return 0
 }
 
-func (s *Store) ensureSortOrderColumn(ctx context.Context, table string) error {
-	if s.isMySQL() {
-		var count int
-		if err := s.db.QueryRowContext(
-			ctx,
-			`SELECT COUNT(*) FROM information_schema.COLUMNS
-			 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'sort_order'`,
-			table,
-		).Scan(&count); err != nil {
-			return fmt.Errorf("read %s columns: %w", table, err)
-		}
-		if count > 0 {
-			return nil
-		}
-		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN sort_order BIGINT NOT NULL DEFAULT 0`, table)); err != nil {
-			return fmt.Errorf("add sort_order to %s: %w", table, err)
-		}
-		return nil
-	}
-
-	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`PRAGMA table_info(%s)`, table))
-	if err != nil {
-		return fmt.Errorf("read %s columns: %w", table, err)
-	}
-
-	hasSortOrder := false
-
-	for rows.Next() {
-		var (
-			cid          int
-			name         string
-			columnType   string
-			notNull      int
-			defaultValue sql.NullString
-			primaryKey   int
-		)
-		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
-			rows.Close()
-			return fmt.Errorf("scan %s columns: %w", table, err)
-		}
-		if name == "sort_order" {
-			hasSortOrder = true
-			break
-		}
-	}
-	if err := rows.Err(); err != nil {
-		rows.Close()
-		return fmt.Errorf("iterate %s columns: %w", table, err)
-	}
-	if err := rows.Close(); err != nil {
-		return fmt.Errorf("close %s columns rows: %w", table, err)
-	}
-	if hasSortOrder {
-		return nil
-	}
-
-	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0`, table)); err != nil {
-		return fmt.Errorf("add sort_order to %s: %w", table, err)
-	}
-
-	return nil
+func (s *Store) ensureSortOrderColumn(ctx context.Context, q migrationExecutor, table string) error {
+	return s.ensureColumn(ctx, q, table, "sort_order", `INTEGER NOT NULL DEFAULT 0`, `BIGINT NOT NULL DEFAULT 0`)
 }
 
-func (s *Store) ensureDeployConfigCacheDirsColumn(ctx context.Context) error {
-	if s.isMySQL() {
-		var count int
-		if err := s.db.QueryRowContext(
-			ctx,
-			`SELECT COUNT(*) FROM information_schema.COLUMNS
-			 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'deploy_configs' AND COLUMN_NAME = 'cache_dirs_json'`,
-		).Scan(&count); err != nil {
-			return fmt.Errorf("read deploy_configs columns: %w", err)
-		}
-		if count == 0 {
-			if _, err := s.db.ExecContext(ctx, `ALTER TABLE deploy_configs ADD COLUMN cache_dirs_json LONGTEXT NULL`); err != nil {
-				return fmt.Errorf("add cache_dirs_json to deploy_configs: %w", err)
-			}
-		}
-	} else {
-		rows, err := s.db.QueryContext(ctx, `PRAGMA table_info(deploy_configs)`)
-		if err != nil {
-			return fmt.Errorf("read deploy_configs columns: %w", err)
-		}
-
-		hasCacheDirs := false
-
-		for rows.Next() {
-			var (
-				cid          int
-				name         string
-				columnType   string
-				notNull      int
-				defaultValue sql.NullString
-				primaryKey   int
-			)
-			if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
-				rows.Close()
-				return fmt.Errorf("scan deploy_configs columns: %w", err)
-			}
-			if name == "cache_dirs_json" {
-				hasCacheDirs = true
-				break
-			}
-		}
-		if err := rows.Err(); err != nil {
-			rows.Close()
-			return fmt.Errorf("iterate deploy_configs columns: %w", err)
-		}
-		if err := rows.Close(); err != nil {
-			return fmt.Errorf("close deploy_configs columns rows: %w", err)
-		}
-		if !hasCacheDirs {
-			if _, err := s.db.ExecContext(ctx, `ALTER TABLE deploy_configs ADD COLUMN cache_dirs_json TEXT NOT NULL DEFAULT '[]'`); err != nil {
-				return fmt.Errorf("add cache_dirs_json to deploy_configs: %w", err)
-			}
-		}
+func (s *Store) ensureDeployConfigCacheDirsColumn(ctx context.Context, q migrationExecutor) error {
+	if err := s.ensureColumn(ctx, q, "deploy_configs", "cache_dirs_json", `TEXT NOT NULL DEFAULT '[]'`, `LONGTEXT NULL`); err != nil {
+		return err
 	}
 
-	if _, err := s.db.ExecContext(ctx, `UPDATE deploy_configs SET cache_dirs_json = '[]' WHERE cache_dirs_json IS NULL OR cache_dirs_json = ''`); err != nil {
+	if _, err := q.ExecContext(ctx, `UPDATE deploy_configs SET cache_dirs_json = '[]' WHERE cache_dirs_json IS NULL OR cache_dirs_json = ''`); err != nil {
 		return fmt.Errorf("backfill cache_dirs_json: %w", err)
 	}
 	return nil
 }
 
-func (s *Store) initializeSortOrder(ctx context.Context, table string) error {
-	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET sort_order = id WHERE sort_order = 0`, table)); err != nil {
+func (s *Store) initializeSortOrder(ctx context.Context, q migrationExecutor, table string) error {
+	if _, err := q.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET sort_order = id WHERE sort_order = 0`, table)); err != nil {
 		return fmt.Errorf("initialize %s sort_order: %w", table, err)
 	}
 	return nil
@@ -2036,110 +2018,3 @@ func (s *Store) listRecordIDs(ctx context.Context, table string) ([]int64, error
 
 	return ids, nil
 }
-
-// 管理员用户管理
-
-func (s *Store) GetAdminUser(ctx context.Context) (model.AdminUser, error) {
-	row := s.db.QueryRowContext(
-		ctx,
-		`SELECT id, username, password_hash, created_at, updated_at
-		 FROM admin_users
-		 LIMIT 1`,
-	)
-	return s.scanAdminUser(row)
-}
-
-func (s *Store) CreateAdminUser(ctx context.Context, username, passwordHash string) (model.AdminUser, error) {
-	now := nowString()
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return model.AdminUser{}, fmt.Errorf("begin create admin user transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	var count int
-	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_users`).Scan(&count); err != nil {
-		return model.AdminUser{}, fmt.Errorf("count admin users: %w", err)
-	}
-	if count > 0 {
-		return model.AdminUser{}, fmt.Errorf("only one admin user is allowed")
-	}
-
-	result, err := tx.ExecContext(
-		ctx,
-		`INSERT INTO admin_users (username, password_hash, created_at, updated_at)
-		 VALUES (?, ?, ?, ?)`,
-		username, passwordHash, now, now,
-	)
-	if err != nil {
-		return model.AdminUser{}, fmt.Errorf("create admin user: %w", err)
-	}
-
-	_, err = result.LastInsertId()
-	if err != nil {
-		return model.AdminUser{}, fmt.Errorf("get admin user id: %w", err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return model.AdminUser{}, fmt.Errorf("commit create admin user transaction: %w", err)
-	}
-
-	return s.GetAdminUser(ctx)
-}
-
-func (s *Store) UpdateAdminPassword(ctx context.Context, passwordHash string) error {
-	now := nowString()
-	_, err := s.db.ExecContext(
-		ctx,
-		`UPDATE admin_users SET password_hash = ?, updated_at = ?`,
-		passwordHash, now,
-	)
-	if err != nil {
-		return fmt.Errorf("update admin password: %w", err)
-	}
-	return nil
-}
-
-func (s *Store) AdminUserExists(ctx context.Context) (bool, error) {
-	var count int
-	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_users`).Scan(&count)
-	if err != nil {
-		return false, fmt.Errorf("check admin user exists: %w", err)
-	}
-	return count > 0, nil
-}
-
-func (s *Store) scanAdminUser(scan scanner) (model.AdminUser, error) {
-	var (
-		user         model.AdminUser
-		createdAtStr string
-		updatedAtStr string
-	)
-
-	err := scan.Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&createdAtStr,
-		&updatedAtStr,
-	)
-	if errors.Is(err, sql.ErrNoRows) {
-		return model.AdminUser{}, ErrNotFound
-	}
-	if err != nil {
-		return model.AdminUser{}, fmt.Errorf("scan admin user: %w", err)
-	}
-
-	createdAt, err := parseTime(createdAtStr)
-	if err != nil {
-		return model.AdminUser{}, err
-	}
-	updatedAt, err := parseTime(updatedAtStr)
-	if err != nil {
-		return model.AdminUser{}, err
-	}
-	user.CreatedAt = createdAt
-	user.UpdatedAt = updatedAt
-
-	return user, nil
-}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	errTOTPAlreadyEnabled = newConflictError("two-factor authentication is already enabled")
+	errTOTPNotPending     = newConflictError("start two-factor setup before enabling it")
+)
+
+// UserTOTP is the stored second factor of an account. Secret is decrypted
+// and is either the active secret or, while Enabled is false, one that is
+// waiting to be confirmed.
+type UserTOTP struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+func (s *Store) GetUserTOTP(ctx context.Context, userID int64) (UserTOTP, error) {
+	var (
+		totp         UserTOTP
+		secretCipher string
+		enabled      int
+	)
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT totp_secret_cipher, totp_enabled, totp_last_step FROM admin_users WHERE id = ?`,
+		userID,
+	).Scan(&secretCipher, &enabled, &totp.LastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserTOTP{}, ErrNotFound
+	}
+	if err != nil {
+		return UserTOTP{}, fmt.Errorf("read user totp: %w", err)
+	}
+	totp.Enabled = enabled != 0
+	if secretCipher != "" {
+		totp.Secret, err = s.cipher.Decrypt(secretCipher)
+		if err != nil {
+			return UserTOTP{}, fmt.Errorf("decrypt totp secret: %w", err)
+		}
+	}
+	return totp, nil
+}
+
+// SetPendingTOTPSecret stores a new secret for an account that has not
+// enabled two-factor authentication yet, replacing any unconfirmed one.
+func (s *Store) SetPendingTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	secretCipher, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return fmt.Errorf("encrypt totp secret: %w", err)
+	}
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE admin_users SET totp_secret_cipher = ?, totp_last_step = 0, updated_at = ? WHERE id = ? AND totp_enabled = 0`,
+		secretCipher, nowString(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("set pending totp secret: %w", err)
+	}
+	if err := expectDeleted(result); errors.Is(err, ErrNotFound) {
+		if _, err := s.GetUser(ctx, userID); err != nil {
+			return err
+		}
+		return errTOTPAlreadyEnabled
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// EnableTOTP activates the pending secret after it was confirmed with the
+// code of step, and stores the hashes of a fresh set of recovery codes.
+func (s *Store) EnableTOTP(ctx context.Context, userID, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin enable totp transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE admin_users SET totp_enabled = 1, totp_last_step = ?, updated_at = ?
+		 WHERE id = ? AND totp_enabled = 0 AND totp_secret_cipher <> ''`,
+		step, nowString(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("enable totp: %w", err)
+	}
+	if err := expectDeleted(result); errors.Is(err, ErrNotFound) {
+		return errTOTPNotPending
+	} else if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit enable totp transaction: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP removes the second factor and all recovery codes of an account.
+func (s *Store) DisableTOTP(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin disable totp transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE admin_users SET totp_secret_cipher = '', totp_enabled = 0, totp_last_step = 0, updated_at = ? WHERE id = ?`,
+		nowString(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("disable totp: %w", err)
+	}
+	if err := expectDeleted(result); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit disable totp transaction: %w", err)
+	}
+	return nil
+}
+
+// RecordTOTPStep marks the time step of an accepted code as used. It
+// returns false when that step or a later one was used before, so a code
+// cannot be replayed.
+func (s *Store) RecordTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE admin_users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`,
+		step, userID, step,
+	)
+	if err != nil {
+		return false, fmt.Errorf("record totp step: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("read rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// UseRecoveryCode consumes an unused recovery code. It returns false when no
+// unused code with that hash exists.
+func (s *Store) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		nowString(), userID, codeHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("read rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes an account has left.
+func (s *Store) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`,
+		userID,
+	).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// ReplaceRecoveryCodes invalidates all recovery codes of an account and
+// stores new ones.
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin replace recovery codes transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit replace recovery codes transaction: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *dbTx, userID int64, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	now := nowString()
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO user_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, codeHash, now,
+		); err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+	return nil
+}
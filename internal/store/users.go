@@ -0,0 +1,366 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"devops-pipeline/internal/model"
+)
+
+// 用户账号保存在 admin_users 表中，表名沿用只有一个管理员时的命名。
+
+const userSelectColumns = `id, username, password_hash, role, disabled, totp_enabled, password_change_required, auth_source, external_id, created_at, updated_at`
+
+var errLastAdmin = newConflictError("at least one enabled admin account is required")
+
+// HasUsers reports whether any account exists, used to create the initial
+// administrator on first start.
+func (s *Store) HasUsers(ctx context.Context) (bool, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_users`).Scan(&count); err != nil {
+		return false, fmt.Errorf("count users: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *Store) ListUsers(ctx context.Context) ([]model.User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+userSelectColumns+` FROM admin_users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *Store) GetUser(ctx context.Context, userID int64) (model.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userSelectColumns+` FROM admin_users WHERE id = ?`, userID)
+	return scanUser(row)
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (model.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userSelectColumns+` FROM admin_users WHERE username = ?`, username)
+	return scanUser(row)
+}
+
+// GetUserByExternalID returns the account linked to an identity of an
+// external source, such as the subject of an OIDC provider.
+func (s *Store) GetUserByExternalID(ctx context.Context, source, externalID string) (model.User, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+userSelectColumns+` FROM admin_users WHERE auth_source = ? AND external_id = ?`,
+		source, externalID,
+	)
+	return scanUser(row)
+}
+
+// CreateUser creates a local password account.
+func (s *Store) CreateUser(ctx context.Context, username, passwordHash, role string) (model.User, error) {
+	return s.CreateExternalUser(ctx, username, passwordHash, role, model.AuthSourceLocal, "")
+}
+
+// CreateExternalUser creates an account linked to an identity of source.
+func (s *Store) CreateExternalUser(ctx context.Context, username, passwordHash, role, source, externalID string) (model.User, error) {
+	now := nowString()
+	id, err := s.insertID(
+		ctx,
+		s.db,
+		`INSERT INTO admin_users (username, password_hash, role, disabled, auth_source, external_id, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		username, passwordHash, role, 0, source, externalID, now, now,
+	)
+	if err != nil {
+		return model.User{}, fmt.Errorf("create user: %w", err)
+	}
+	return s.GetUser(ctx, id)
+}
+
+// UpdateUser changes the role and disabled flag of an account and, when
+// passwordHash is not empty, its password. The last enabled admin cannot be
+// demoted or disabled.
+func (s *Store) UpdateUser(ctx context.Context, userID int64, role string, disabled bool, passwordHash string) (model.User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return model.User{}, fmt.Errorf("begin update user transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userSelectColumns+` FROM admin_users WHERE id = ?`, userID))
+	if err != nil {
+		return model.User{}, err
+	}
+	if isActiveAdmin(current) && (role != model.RoleAdmin || disabled) {
+		if err := s.ensureOtherActiveAdmin(ctx, tx, userID); err != nil {
+			return model.User{}, err
+		}
+	}
+
+	mustChange := current.PasswordChangeRequired
+	if passwordHash == "" {
+		passwordHash = current.PasswordHash
+	} else {
+		mustChange = false
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE admin_users SET role = ?, disabled = ?, password_hash = ?, password_change_required = ?, updated_at = ? WHERE id = ?`,
+		role, boolToInt(disabled), passwordHash, boolToInt(mustChange), nowString(), userID,
+	); err != nil {
+		return model.User{}, fmt.Errorf("update user: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return model.User{}, fmt.Errorf("commit update user transaction: %w", err)
+	}
+	return s.GetUser(ctx, userID)
+}
+
+func (s *Store) UpdateUsername(ctx context.Context, userID int64, username string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE admin_users SET username = ?, updated_at = ? WHERE id = ?`,
+		username, nowString(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("update username: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserPassword sets a new password and clears the password change
+// requirement.
+func (s *Store) UpdateUserPassword(ctx context.Context, userID int64, passwordHash string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE admin_users SET password_hash = ?, password_change_required = 0, updated_at = ? WHERE id = ?`,
+		passwordHash, nowString(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("update user password: %w", err)
+	}
+	return nil
+}
+
+// LinkUser sets the source of an account and the external identity it is
+// linked to. An empty externalID leaves the account to be claimed by the next
+// login from source with the same username.
+func (s *Store) LinkUser(ctx context.Context, userID int64, source, externalID string) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE admin_users SET auth_source = ?, external_id = ?, updated_at = ? WHERE id = ?`,
+		source, externalID, nowString(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("link user: %w", err)
+	}
+	return expectDeleted(result)
+}
+
+// RequirePasswordChange flags an account that must change its password
+// before it can use anything else.
+func (s *Store) RequirePasswordChange(ctx context.Context, userID int64) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE admin_users SET password_change_required = 1, updated_at = ? WHERE id = ?`,
+		nowString(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("require password change: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser removes an account; its project permissions cascade. The last
+// enabled admin cannot be deleted.
+func (s *Store) DeleteUser(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete user transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userSelectColumns+` FROM admin_users WHERE id = ?`, userID))
+	if err != nil {
+		return err
+	}
+	if isActiveAdmin(current) {
+		if err := s.ensureOtherActiveAdmin(ctx, tx, userID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM admin_users WHERE id = ?`, userID); err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit delete user transaction: %w", err)
+	}
+	return nil
+}
+
+func isActiveAdmin(user model.User) bool {
+	return user.Role == model.RoleAdmin && !user.Disabled
+}
+
+// ensureOtherActiveAdmin fails with errLastAdmin when userID is the only
+// enabled admin. On MySQL and Postgres the admin rows are locked until the
+// transaction ends, so two admins demoting or deleting each other at the same
+// time are serialized and the second one sees the first change; SQLite only
+// has one writer.
+func (s *Store) ensureOtherActiveAdmin(ctx context.Context, tx *dbTx, userID int64) error {
+	query := `SELECT id FROM admin_users WHERE role = ? AND disabled = 0 ORDER BY id`
+	if !s.isSQLite() {
+		query += ` FOR UPDATE`
+	}
+	rows, err := tx.QueryContext(ctx, query, model.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("lock admins: %w", err)
+	}
+	defer rows.Close()
+
+	others := 0
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("scan admin: %w", err)
+		}
+		if id != userID {
+			others++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate admins: %w", err)
+	}
+	if others == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// ListProjectPermissions returns the per-project grants of a user.
+func (s *Store) ListProjectPermissions(ctx context.Context, userID int64) ([]model.ProjectPermission, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT project_permissions.project_id, projects.name, project_permissions.role
+		 FROM project_permissions
+		 JOIN projects ON projects.id = project_permissions.project_id
+		 WHERE project_permissions.user_id = ?
+		 ORDER BY project_permissions.project_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query project permissions: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []model.ProjectPermission{}
+	for rows.Next() {
+		var permission model.ProjectPermission
+		if err := rows.Scan(&permission.ProjectID, &permission.ProjectName, &permission.Role); err != nil {
+			return nil, fmt.Errorf("scan project permission: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+// SetProjectPermissions replaces all per-project grants of a user.
+func (s *Store) SetProjectPermissions(ctx context.Context, userID int64, permissions []model.ProjectPermission) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin set project permissions transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userSelectColumns+` FROM admin_users WHERE id = ?`, userID)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM project_permissions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("clear project permissions: %w", err)
+	}
+	now := nowString()
+	for _, permission := range permissions {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO project_permissions (user_id, project_id, role, created_at) VALUES (?, ?, ?, ?)`,
+			userID, permission.ProjectID, permission.Role, now,
+		); err != nil {
+			return fmt.Errorf("insert project permission: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit set project permissions transaction: %w", err)
+	}
+	return nil
+}
+
+// ProjectRole returns the role user has on a project: the higher of the
+// global role and any grant on that project.
+func (s *Store) ProjectRole(ctx context.Context, user model.User, projectID int64) (string, error) {
+	var granted string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT role FROM project_permissions WHERE user_id = ? AND project_id = ?`,
+		user.ID, projectID,
+	).Scan(&granted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("read project permission: %w", err)
+	}
+	return model.HigherRole(user.Role, granted), nil
+}
+
+func scanUser(scan scanner) (model.User, error) {
+	var (
+		user         model.User
+		disabled     int
+		totpEnabled  int
+		mustChange   int
+		createdAtStr string
+		updatedAtStr string
+	)
+
+	err := scan.Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.Role,
+		&disabled,
+		&totpEnabled,
+		&mustChange,
+		&user.AuthSource,
+		&user.ExternalID,
+		&createdAtStr,
+		&updatedAtStr,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, ErrNotFound
+	}
+	if err != nil {
+		return model.User{}, fmt.Errorf("scan user: %w", err)
+	}
+	user.Disabled = disabled != 0
+	user.TOTPEnabled = totpEnabled != 0
+	user.PasswordChangeRequired = mustChange != 0
+
+	createdAt, err := parseTime(createdAtStr)
+	if err != nil {
+		return model.User{}, err
+	}
+	updatedAt, err := parseTime(updatedAtStr)
+	if err != nil {
+		return model.User{}, err
+	}
+	user.CreatedAt = createdAt
+	user.UpdatedAt = updatedAt
+
+	return user, nil
+}
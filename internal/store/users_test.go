@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	cryptoutil "devops-pipeline/internal/crypto"
+	"devops-pipeline/internal/model"
+)
+
+func TestLastActiveAdminCannotBeRemoved(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer db.Close()
+	s := New(db, cryptoutil.New("test"), DriverSQLite)
+	if err := s.Migrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	first, err := s.CreateUser(ctx, "alice", "hash", model.RoleAdmin)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	second, err := s.CreateUser(ctx, "bob", "hash", model.RoleAdmin)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	if _, err := s.UpdateUser(ctx, first.ID, model.RoleViewer, false, ""); err != nil {
+		t.Fatalf("expected the first admin to be demoted, got %v", err)
+	}
+	if _, err := s.UpdateUser(ctx, second.ID, model.RoleViewer, false, ""); !errors.Is(err, errLastAdmin) {
+		t.Fatalf("expected the last admin to stay, got %v", err)
+	}
+	if _, err := s.UpdateUser(ctx, second.ID, model.RoleAdmin, true, ""); !errors.Is(err, errLastAdmin) {
+		t.Fatalf("expected the last admin to stay enabled, got %v", err)
+	}
+	if err := s.DeleteUser(ctx, second.ID); !errors.Is(err, errLastAdmin) {
+		t.Fatalf("expected the last admin not to be deleted, got %v", err)
+	}
+	if err := s.DeleteUser(ctx, first.ID); err != nil {
+		t.Fatalf("expected a demoted account to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"devops-pipeline/internal/model"
+)
+
+func webhookDeliverySelectQuery(includeBody bool) string {
+	bodyField := "''"
+	if includeBody {
+		bodyField = "webhook_deliveries.body"
+	}
+	return fmt.Sprintf(`SELECT webhook_deliveries.id, webhook_deliveries.project_id, COALESCE(projects.name, ''),
+		        webhook_deliveries.headers_json, %s AS body, webhook_deliveries.body_size, webhook_deliveries.body_truncated,
+		        webhook_deliveries.decision, webhook_deliveries.reason, webhook_deliveries.status_code,
+		        webhook_deliveries.run_id, webhook_deliveries.replay_of_id, webhook_deliveries.created_at
+		 FROM webhook_deliveries
+		 LEFT JOIN projects ON projects.id = webhook_deliveries.project_id`, bodyField)
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, input model.WebhookDeliveryCreateInput) (model.WebhookDelivery, error) {
+	headers := input.Headers
+	if headers == nil {
+		headers = map[string][]string{}
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return model.WebhookDelivery{}, fmt.Errorf("marshal webhook headers: %w", err)
+	}
+
+	id, err := s.insertID(
+		ctx,
+		s.db,
+		`INSERT INTO webhook_deliveries (project_id, headers_json, body, body_size, body_truncated, decision, reason, status_code, run_id, replay_of_id, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		input.ProjectID,
+		string(headersJSON),
+		input.Body,
+		input.BodySize,
+		boolToInt(input.BodyTruncated),
+		input.Decision,
+		input.Reason,
+		input.StatusCode,
+		input.RunID,
+		input.ReplayOfID,
+		nowString(),
+	)
+	if err != nil {
+		return model.WebhookDelivery{}, fmt.Errorf("insert webhook delivery: %w", err)
+	}
+
+	if err := s.ApplyWebhookDeliveryRetention(ctx); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	return s.GetWebhookDelivery(ctx, id)
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id int64) (model.WebhookDelivery, error) {
+	row := s.db.QueryRowContext(ctx, webhookDeliverySelectQuery(true)+` WHERE webhook_deliveries.id = ?`, id)
+	return scanWebhookDelivery(row)
+}
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.ProjectID > 0 {
+		conditions = append(conditions, "webhook_deliveries.project_id = ?")
+		args = append(args, filter.ProjectID)
+	}
+	if filter.Decision != "" {
+		conditions = append(conditions, "webhook_deliveries.decision = ?")
+		args = append(args, filter.Decision)
+	}
+
+	query := webhookDeliverySelectQuery(false)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY webhook_deliveries.id DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// ApplyWebhookDeliveryRetention keeps only the newest deliveries as configured
+// by the webhook_delivery_retention setting.
+func (s *Store) ApplyWebhookDeliveryRetention(ctx context.Context) error {
+	value, err := s.GetSettingValue(ctx, model.SettingWebhookDeliveryRetention)
+	if err != nil {
+		return err
+	}
+
+	keep, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || keep <= 0 {
+		return nil
+	}
+
+	var oldestKeptID int64
+	err = s.db.QueryRowContext(
+		ctx,
+		`SELECT id FROM webhook_deliveries ORDER BY id DESC LIMIT 1 OFFSET ?`,
+		keep-1,
+	).Scan(&oldestKeptID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("query webhook delivery retention boundary: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE id < ?`, oldestKeptID); err != nil {
+		return fmt.Errorf("delete expired webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func scanWebhookDelivery(scan scanner) (model.WebhookDelivery, error) {
+	var (
+		delivery        model.WebhookDelivery
+		projectID       sql.NullInt64
+		headersJSON     string
+		bodyTruncated   int64
+		runID           sql.NullInt64
+		replayOfID      sql.NullInt64
+		createdAtString string
+	)
+
+	err := scan.Scan(
+		&delivery.ID,
+		&projectID,
+		&delivery.ProjectName,
+		&headersJSON,
+		&delivery.Body,
+		&delivery.BodySize,
+		&bodyTruncated,
+		&delivery.Decision,
+		&delivery.Reason,
+		&delivery.StatusCode,
+		&runID,
+		&replayOfID,
+		&createdAtString,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.WebhookDelivery{}, ErrNotFound
+	}
+	if err != nil {
+		return model.WebhookDelivery{}, fmt.Errorf("scan webhook delivery: %w", err)
+	}
+
+	if projectID.Valid {
+		delivery.ProjectID = &projectID.Int64
+	}
+	if runID.Valid {
+		delivery.RunID = &runID.Int64
+	}
+	if replayOfID.Valid {
+		delivery.ReplayOfID = &replayOfID.Int64
+	}
+	delivery.BodyTruncated = bodyTruncated == 1
+	if err = json.Unmarshal([]byte(headersJSON), &delivery.Headers); err != nil {
+		return model.WebhookDelivery{}, fmt.Errorf("unmarshal webhook headers: %w", err)
+	}
+	delivery.CreatedAt, err = parseTime(createdAtString)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
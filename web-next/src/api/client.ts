@@ -6,16 +6,48 @@ function getToken(): string | null {
   return localStorage.getItem("jwt_token");
 }
 
-// 设置 Token
-export function setToken(token: string): void {
+// 设置 Token，refreshToken 用于访问令牌过期后续期
+export function setToken(token: string, refreshToken?: string): void {
   if (typeof window === "undefined") return;
   localStorage.setItem("jwt_token", token);
+  if (refreshToken) {
+    localStorage.setItem("refresh_token", refreshToken);
+  }
 }
 
 // 清除 Token
 export function clearToken(): void {
   if (typeof window === "undefined") return;
   localStorage.removeItem("jwt_token");
+  localStorage.removeItem("refresh_token");
+}
+
+// 刷新令牌每次使用后都会更换，并发的 401 共用同一次刷新
+let refreshing: Promise<boolean> | null = null;
+
+function refreshSession(): Promise<boolean> {
+  if (typeof window === "undefined") return Promise.resolve(false);
+  const refreshToken = localStorage.getItem("refresh_token");
+  if (!refreshToken) return Promise.resolve(false);
+  if (!refreshing) {
+    refreshing = fetch(buildApiUrl("/auth/refresh"), {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    })
+      .then(async (response) => {
+        if (!response.ok) return false;
+        const data: import("@/types").LoginResponse = await response.json();
+        if (!data.token) return false;
+        setToken(data.token, data.refresh_token);
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
 }
 
 // 检查是否已认证
@@ -26,7 +58,8 @@ export function isAuthenticated(): boolean {
 // 请求封装
 async function request<T>(
   path: string,
-  options: RequestInit = {}
+  options: RequestInit = {},
+  retried = false
 ): Promise<T> {
   const token = getToken();
   const headers: Record<string, string> = {
@@ -46,6 +79,9 @@ async function request<T>(
 
   if (!response.ok) {
     if (response.status === 401) {
+      if (!retried && (await refreshSession())) {
+        return request<T>(path, options, true);
+      }
       clearToken();
       if (typeof window !== "undefined") {
         window.location.href = "/";
@@ -71,12 +107,22 @@ async function request<T>(
 // ==================== 认证 API ====================
 export const authApi = {
   login: (username: string, password: string) =>
-    request<{ token: string; username: string }>("/admin/login", {
+    request<import("@/types").LoginResponse>("/admin/login", {
       method: "POST",
       body: JSON.stringify({ username, password }),
     }),
 };
 
+// ==================== 登录会话 API ====================
+export const sessionApi = {
+  list: () => request<import("@/types").UserSession[]>("/sessions"),
+  revoke: (id: number) => request<void>(`/sessions/${id}`, { method: "DELETE" }),
+  // 包括当前会话在内全部下线
+  revokeAll: () => request<void>("/sessions", { method: "DELETE" }),
+  revokeUser: (userId: number) =>
+    request<void>(`/users/${userId}/sessions`, { method: "DELETE" }),
+};
+
 // ==================== 主机 API ====================
 export const hostApi = {
   list: () => request<import("@/types").Host[]>("/hosts"),
@@ -156,6 +202,16 @@ export const runApi = {
     request<import("@/types").PipelineRun[]>(buildRunListPath(params?.limit, params?.offset)),
   get: (id: number) => request<import("@/types").PipelineRun>(`/runs/${id}`),
   getLog: (id: number) => request<import("@/types").PipelineRunLog>(`/runs/${id}/log`),
+  // 日志流的一次性票据，30 秒内有效
+  createStreamTicket: (id: number) =>
+    request<import("@/types").StreamTicket>(`/runs/${id}/stream-ticket`, { method: "POST" }),
+  search: (q: string, projectId?: number) => {
+    const params = new URLSearchParams({ q });
+    if (projectId) {
+      params.set("project", String(projectId));
+    }
+    return request<import("@/types").RunSearchResult[]>(`/runs/search?${params.toString()}`);
+  },
   cancel: (id: number) => request<import("@/types").PipelineRun>(`/runs/${id}/cancel`, { method: "POST" }),
   clear: () => request<{ cleared: number }>("/runs", { method: "DELETE" }),
 };
@@ -223,6 +279,23 @@ export const settingApi = {
       method: "PUT",
       body: JSON.stringify({ old_password: oldPassword, new_password: newPassword }),
     }),
+  setupTwoFactor: () =>
+    request<import("@/types").TwoFactorSetup>("/admin/2fa/setup", { method: "POST" }),
+  enableTwoFactor: (code: string) =>
+    request<import("@/types").RecoveryCodes>("/admin/2fa/enable", {
+      method: "POST",
+      body: JSON.stringify({ code }),
+    }),
+  disableTwoFactor: (code: string) =>
+    request<void>("/admin/2fa/disable", {
+      method: "POST",
+      body: JSON.stringify({ code }),
+    }),
+  regenerateRecoveryCodes: (code: string) =>
+    request<import("@/types").RecoveryCodes>("/admin/2fa/recovery-codes", {
+      method: "POST",
+      body: JSON.stringify({ code }),
+    }),
   getSystemInfo: () => request<import("@/types").SystemInfo>("/system/info"),
   getLatestRelease: () => request<import("@/types").ReleaseInfo>("/update"),
   getUpdateStatus: () => request<import("@/types").UpdateStatus>("/update/now-version"),
@@ -1,9 +1,10 @@
 "use client";
 
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useRouter } from "next/navigation";
 import { toast } from "sonner";
-import { login } from "@/lib/api";
+import { getSSOInfo, getSSOLoginUrl, login, loginTwoFactor, storeSession } from "@/lib/api";
+import type { SSOInfo } from "@/types";
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
@@ -14,14 +15,53 @@ export default function LoginPage() {
   const [loading, setLoading] = useState(false);
   const [username, setUsername] = useState("");
   const [password, setPassword] = useState("");
+  const [sso, setSSO] = useState<SSOInfo>({ enabled: false });
+  // 非空时显示两步验证输入框
+  const [challenge, setChallenge] = useState("");
+  const [code, setCode] = useState("");
+
+  useEffect(() => {
+    // 单点登录回调把令牌或错误放在地址的 # 部分
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    window.history.replaceState(null, "", window.location.pathname);
+    const token = params.get("token");
+    if (token) {
+      storeSession({ token, refresh_token: params.get("refresh_token") || undefined });
+      toast.success("登录成功");
+      router.push("/");
+      return;
+    }
+    const pendingChallenge = params.get("challenge");
+    if (pendingChallenge) {
+      setUsername(params.get("username") || "");
+      setChallenge(pendingChallenge);
+    }
+    const error = params.get("error");
+    if (error) {
+      toast.error(error);
+    }
+
+    getSSOInfo()
+      .then(setSSO)
+      .catch(() => setSSO({ enabled: false }));
+  }, [router]);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setLoading(true);
 
     try {
-      await login(username, password);
+      const response = challenge
+        ? await loginTwoFactor(challenge, code)
+        : await login(username, password);
+      if (response.two_factor_required && response.challenge) {
+        setChallenge(response.challenge);
+        return;
+      }
       toast.success("登录成功");
+      if (response.password_change_required) {
+        toast.warning("当前仍在使用默认密码，请先在设置中修改密码");
+      }
       router.push("/");
     } catch (error) {
       toast.error(error instanceof Error ? error.message : "登录失败");
@@ -35,36 +75,67 @@ export default function LoginPage() {
       <Card className="w-full max-w-md">
         <CardHeader className="space-y-1 text-center">
           <CardTitle className="text-2xl font-bold">积木区 DevOps</CardTitle>
-          <CardDescription>请输入用户名和密码登录</CardDescription>
+          <CardDescription>{challenge ? "请输入两步验证码" : "请输入用户名和密码登录"}</CardDescription>
         </CardHeader>
         <CardContent>
           <form onSubmit={handleSubmit} className="space-y-4">
-            <div className="space-y-2">
-              <Label htmlFor="username">用户名</Label>
-              <Input
-                id="username"
-                type="text"
-                placeholder="admin"
-                value={username}
-                onChange={(e) => setUsername(e.target.value)}
-                required
-              />
-            </div>
-            <div className="space-y-2">
-              <Label htmlFor="password">密码</Label>
-              <Input
-                id="password"
-                type="password"
-                placeholder="默认密码: admin123"
-                value={password}
-                onChange={(e) => setPassword(e.target.value)}
-                required
-              />
-            </div>
+            {challenge ? (
+              <div className="space-y-2">
+                <Label htmlFor="code">验证码</Label>
+                <Input
+                  id="code"
+                  type="text"
+                  inputMode="numeric"
+                  autoComplete="one-time-code"
+                  placeholder="验证器中的 6 位验证码或恢复码"
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  autoFocus
+                  required
+                />
+              </div>
+            ) : (
+              <>
+                <div className="space-y-2">
+                  <Label htmlFor="username">用户名</Label>
+                  <Input
+                    id="username"
+                    type="text"
+                    placeholder="admin"
+                    value={username}
+                    onChange={(e) => setUsername(e.target.value)}
+                    required
+                  />
+                </div>
+                <div className="space-y-2">
+                  <Label htmlFor="password">密码</Label>
+                  <Input
+                    id="password"
+                    type="password"
+                    placeholder="默认密码: admin123"
+                    value={password}
+                    onChange={(e) => setPassword(e.target.value)}
+                    required
+                  />
+                </div>
+              </>
+            )}
             <Button type="submit" className="w-full" disabled={loading}>
               {loading ? "登录中..." : "登录"}
             </Button>
           </form>
+          {sso.enabled && !challenge && (
+            <Button
+              type="button"
+              variant="outline"
+              className="mt-4 w-full"
+              onClick={() => {
+                window.location.href = getSSOLoginUrl();
+              }}
+            >
+              使用 {sso.display_name || "SSO"} 登录
+            </Button>
+          )}
         </CardContent>
       </Card>
     </div>
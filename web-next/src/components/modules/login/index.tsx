@@ -21,8 +21,11 @@ export function Login({ onSuccess }: LoginProps) {
     setLoading(true);
 
     try {
-      const { token } = await authApi.login(username, password);
-      setToken(token);
+      const { token, refresh_token } = await authApi.login(username, password);
+      if (!token) {
+        throw new Error("该账号需要两步验证，请使用登录页登录");
+      }
+      setToken(token, refresh_token);
       toast.success("登录成功");
       onSuccess();
     } catch (error: any) {
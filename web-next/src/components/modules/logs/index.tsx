@@ -5,9 +5,9 @@ import { Card, CardContent } from "@/components/ui/card";
 import { Badge } from "@/components/ui/badge";
 import { Button } from "@/components/ui/button";
 import { runApi } from "@/api/client";
-import type { PipelineRun } from "@/types";
+import type { PipelineRun, RunLogEntry } from "@/types";
 import { getApiOrigin } from "@/lib/api-base";
-import { formatDate, getStatusVariant, getStatusText, calculateDuration, formatDuration, formatShortDateTime } from "@/lib/utils";
+import { formatDate, formatLogEntry, getStatusVariant, getStatusText, calculateDuration, formatDuration, formatShortDateTime } from "@/lib/utils";
 import { X, Square } from "lucide-react";
 import { motion, AnimatePresence } from "motion/react";
 import { useNavStore } from "@/stores";
@@ -64,45 +64,64 @@ function LogDialog({
     }
 
     let cancelled = false;
-    let streamUpdated = false;
 
-    void (async () => {
-      try {
-        const runLog = await runApi.getLog(run.id);
-        if (cancelled || streamUpdated) {
-          return;
-        }
-        setLogContent(runLog.log_text || "");
-      } catch (error) {
-        if (!cancelled) {
+    // 运行中的任务通过流式接口获取日志：先补发历史行，之后只推送新增行
+    if (run.status === "running") {
+      setLogContent("");
+      // 票据只能用一次，浏览器自动重连会被拒绝，此时换新票据并从下一行继续
+      let nextSeq = 0;
+      const connect = async () => {
+        if (cancelled) return;
+        let ticket: string;
+        try {
+          ({ ticket } = await runApi.createStreamTicket(run.id));
+        } catch (error) {
           console.error(error);
-        }
-      } finally {
-        if (!cancelled && !streamUpdated) {
           setLoadingLog(false);
+          return;
         }
-      }
-    })();
-
-    // 如果是运行中的任务，开启流式日志
-    if (run.status === "running") {
-      const token = typeof window !== "undefined" ? localStorage.getItem("jwt_token") : null;
-      const query = token ? `?token=${encodeURIComponent(token)}` : "";
-      const es = new EventSource(`${getApiOrigin()}/api/v1/runs/${run.id}/stream${query}`);
-      es.addEventListener("run", (event) => {
-        streamUpdated = true;
-        const nextRun = JSON.parse((event as MessageEvent<string>).data) as PipelineRun;
-        setCurrentRun(nextRun);
-        setLogContent(nextRun.log_text || "");
-        setLoadingLog(false);
-        if (nextRun.status !== "running") {
+        if (cancelled) return;
+        const query = `?ticket=${encodeURIComponent(ticket)}&offset=${nextSeq}`;
+        const es = new EventSource(`${getApiOrigin()}/api/v1/runs/${run.id}/stream${query}`);
+        es.addEventListener("run", (event) => {
+          const nextRun = JSON.parse((event as MessageEvent<string>).data) as PipelineRun;
+          setCurrentRun(nextRun);
+          setLoadingLog(false);
+        });
+        es.addEventListener("log", (event) => {
+          const entry = JSON.parse((event as MessageEvent<string>).data) as RunLogEntry;
+          nextSeq = entry.seq + 1;
+          setLogContent((content) => content + formatLogEntry(entry) + "\n");
+        });
+        es.addEventListener("end", () => {
           es.close();
-        }
-      });
-      es.onerror = () => {
-        es.close();
+        });
+        es.onerror = () => {
+          es.close();
+          if (!cancelled) {
+            window.setTimeout(() => void connect(), 1000);
+          }
+        };
+        eventSourceRef.current = es;
       };
-      eventSourceRef.current = es;
+      void connect();
+    } else {
+      void (async () => {
+        try {
+          const runLog = await runApi.getLog(run.id);
+          if (!cancelled) {
+            setLogContent(runLog.log_text || "");
+          }
+        } catch (error) {
+          if (!cancelled) {
+            console.error(error);
+          }
+        } finally {
+          if (!cancelled) {
+            setLoadingLog(false);
+          }
+        }
+      })();
     }
 
     return () => {
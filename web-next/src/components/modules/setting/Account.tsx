@@ -3,13 +3,13 @@
 import { useEffect, useState } from "react";
 import { Eye, EyeOff, KeyRound, Lock, User } from "lucide-react";
 import { toast } from "sonner";
-import { settingApi, clearToken } from "@/api/client";
+import { settingApi } from "@/api/client";
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
+import { logout } from "@/lib/api";
 
 function forceLogout() {
-  clearToken();
-  window.location.href = "/";
+  void logout();
 }
 
 export function SettingAccount() {
@@ -1,7 +1,7 @@
 "use client";
 
 import { useEffect, useRef, useState } from "react";
-import { Calendar, ScrollText, Trash2 } from "lucide-react";
+import { Archive, Calendar, ScrollText, Trash2 } from "lucide-react";
 import { toast } from "sonner";
 import { runApi } from "@/api/client";
 import { Button } from "@/components/ui/button";
@@ -19,12 +19,19 @@ export function SettingLog({ settings, onSave }: SettingLogProps) {
   const [retentionDays, setRetentionDays] = useState(settings.run_retention_days);
   const [clearing, setClearing] = useState(false);
   const initialRetentionDays = useRef(settings.run_retention_days);
+  const [artifactRetentionDays, setArtifactRetentionDays] = useState(settings.artifact_retention_days);
+  const initialArtifactRetentionDays = useRef(settings.artifact_retention_days);
 
   useEffect(() => {
     setRetentionDays(settings.run_retention_days);
     initialRetentionDays.current = settings.run_retention_days;
   }, [settings.run_retention_days]);
 
+  useEffect(() => {
+    setArtifactRetentionDays(settings.artifact_retention_days);
+    initialArtifactRetentionDays.current = settings.artifact_retention_days;
+  }, [settings.artifact_retention_days]);
+
   const handleClearLogs = async () => {
     if (!window.confirm("确认清空所有部署记录吗？此操作不可恢复。")) {
       return;
@@ -71,6 +78,28 @@ export function SettingLog({ settings, onSave }: SettingLogProps) {
         </p>
       </div>
 
+      <div className="space-y-2">
+        <div className="flex items-center gap-3">
+          <Archive className="h-5 w-5 text-muted-foreground" />
+          <span className="text-sm font-medium">制品保留天数</span>
+        </div>
+        <Input
+          type="number"
+          min={0}
+          value={artifactRetentionDays}
+          onChange={(event) => setArtifactRetentionDays(event.target.value)}
+          onBlur={() => {
+            if (artifactRetentionDays !== initialArtifactRetentionDays.current) {
+              void onSave("artifact_retention_days", artifactRetentionDays);
+            }
+          }}
+          className="rounded-xl"
+        />
+        <p className="text-xs text-muted-foreground">
+          大于 0 时保留每次部署的制品归档供下载，0 表示部署结束后立即删除。
+        </p>
+      </div>
+
       <div className="space-y-2">
         <div className="flex items-center gap-3">
           <Trash2 className="h-5 w-5 text-muted-foreground" />
@@ -20,6 +20,7 @@ const defaultSettings: Record<SettingKey, string> = {
   public_base_url: "",
   proxy_url: "",
   run_retention_days: "30",
+  artifact_retention_days: "0",
 };
 
 function buildSettingsMap(settings: SettingItem[]) {
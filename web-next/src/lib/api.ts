@@ -1,4 +1,5 @@
 import { buildApiUrl } from "@/lib/api-base";
+import type { LoginResponse, SSOInfo } from "@/types";
 
 /**
  * API 请求封装
@@ -37,24 +38,68 @@ export const apiClient = {
   delete: <T>(endpoint: string) => api<T>(endpoint, { method: "DELETE" }),
 };
 
+/**
+ * 保存登录返回的访问令牌和刷新令牌
+ */
+export function storeSession(response: Pick<LoginResponse, "token" | "refresh_token">) {
+  if (response.token) {
+    localStorage.setItem("jwt_token", response.token);
+  }
+  if (response.refresh_token) {
+    localStorage.setItem("refresh_token", response.refresh_token);
+  }
+}
+
 /**
  * 登录
  */
 export async function login(username: string, password: string) {
-  const response = await apiClient.post<{ token: string }>("/admin/login", {
+  const response = await apiClient.post<LoginResponse>("/admin/login", {
     username,
     password,
   });
-  if (response.token) {
-    localStorage.setItem("jwt_token", response.token);
-  }
+  storeSession(response);
+  return response;
+}
+
+/**
+ * 两步验证登录，code 可以是验证器中的 6 位验证码或恢复码
+ */
+export async function loginTwoFactor(challenge: string, code: string) {
+  const response = await apiClient.post<LoginResponse>("/admin/login/2fa", {
+    challenge,
+    code,
+  });
+  storeSession(response);
   return response;
 }
 
+/**
+ * 单点登录配置，未配置时 enabled 为 false
+ */
+export function getSSOInfo() {
+  return apiClient.get<SSOInfo>("/auth/oidc");
+}
+
+/**
+ * 单点登录入口地址，需要整页跳转
+ */
+export function getSSOLoginUrl() {
+  return buildApiUrl("/auth/oidc/login");
+}
+
 /**
  * 退出登录
  */
-export function logout() {
+export async function logout() {
+  const refreshToken = localStorage.getItem("refresh_token");
   localStorage.removeItem("jwt_token");
+  localStorage.removeItem("refresh_token");
+  if (refreshToken) {
+    // 服务端会话结束失败也照常退出，会话会在空闲期满后过期
+    await apiClient
+      .post<void>("/auth/logout", { refresh_token: refreshToken })
+      .catch(() => undefined);
+  }
   window.location.href = "/";
 }
@@ -89,6 +89,7 @@ export function getStatusVariant(status: string): "success" | "error" | "warning
     case "running":
       return "warning";
     case "queued":
+    case "skipped":
       return "secondary";
     default:
       return "default";
@@ -106,7 +107,18 @@ export function getStatusText(status: string): string {
       return "运行中";
     case "queued":
       return "排队中";
+    case "skipped":
+      return "已跳过";
     default:
       return status;
   }
 }
+
+// 按服务端纯文本导出的格式渲染一条结构化日志
+export function formatLogEntry(entry: { time?: string; text: string }): string {
+  if (!entry.time) return entry.text;
+  const d = new Date(entry.time);
+  const pad = (value: number) => String(value).padStart(2, "0");
+  const stamp = `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())} ${pad(d.getHours())}:${pad(d.getMinutes())}:${pad(d.getSeconds())}`;
+  return `[${stamp}] ${entry.text}`;
+}
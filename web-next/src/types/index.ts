@@ -59,7 +59,7 @@ export interface ProjectDetail {
 }
 
 // 部署记录状态
-export type RunStatus = "queued" | "running" | "success" | "failed";
+export type RunStatus = "queued" | "running" | "success" | "failed" | "skipped";
 
 // 部署记录
 export interface PipelineRun {
@@ -68,7 +68,14 @@ export interface PipelineRun {
   project_name: string;
   branch: string;
   status: RunStatus;
+  commit_id: string;
+  artifact_size?: number;
+  artifact_sha256?: string;
+  duration_ms: number;
   commit_message: string;
+  author: string;
+  triggered_by?: string;
+  cancelled_by?: string;
   log_text?: string;
   started_at: string | null;
   finished_at: string | null;
@@ -76,10 +83,36 @@ export interface PipelineRun {
 
 export interface PipelineRunLog {
   run_id: number;
-  log_text: string;
+  log_text?: string;
+  entries?: RunLogEntry[];
+  offset: number;
+  next_offset: number;
+  total_lines: number;
   updated_at: string;
 }
 
+// 日志全文检索结果，snippet 已做 HTML 转义，命中词包裹在 <mark> 中
+export interface RunLogMatch {
+  seq: number;
+  line: number;
+  snippet: string;
+}
+
+export interface RunSearchResult {
+  run: PipelineRun;
+  matches: RunLogMatch[];
+}
+
+// 结构化日志条目，seq 即 SSE 事件 id；从旧版纯文本迁移的日志没有 time
+export interface RunLogEntry {
+  seq: number;
+  time?: string;
+  stage?: string;
+  source: "system" | "stdout" | "stderr" | "remote";
+  level: "info" | "warn" | "error";
+  text: string;
+}
+
 // 通知渠道类型
 export type NotifyChannelType = "webhook" | "dingtalk" | "wechat" | "feishu";
 
@@ -166,7 +199,10 @@ export type SettingKey =
   | "build_cache_dirs"
   | "public_base_url"
   | "proxy_url"
-  | "run_retention_days";
+  | "run_retention_days"
+  | "artifact_retention_days"
+  | "audit_retention_days"
+  | "two_factor_required";
 
 export interface Setting {
   key: SettingKey;
@@ -175,8 +211,72 @@ export interface Setting {
   updated_at?: string;
 }
 
+export type UserRole = "admin" | "maintainer" | "deployer" | "viewer";
+
+export interface ProjectPermission {
+  project_id: number;
+  project_name?: string;
+  role: Exclude<UserRole, "admin">;
+}
+
+export interface User {
+  id: number;
+  username: string;
+  role: UserRole;
+  disabled: boolean;
+  totp_enabled: boolean;
+  password_change_required: boolean;
+  auth_source: "local" | "ldap" | "oidc";
+  external_id?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export type APITokenScope = "read" | "trigger" | "full";
+
+export interface APIToken {
+  id: number;
+  user_id: number;
+  name: string;
+  scope: APITokenScope;
+  token_prefix: string;
+  expires_at: string;
+  last_used_at?: string;
+  created_at: string;
+}
+
+// 仅在创建时返回一次明文令牌
+export interface APITokenCreated extends APIToken {
+  token: string;
+}
+
+export interface AuditChange {
+  old?: unknown;
+  new?: unknown;
+}
+
+export interface AuditEvent {
+  id: number;
+  actor_id: number | null;
+  actor: string;
+  action: string;
+  target_type: string;
+  target_id: string;
+  target_name: string;
+  request_id: string;
+  client_ip: string;
+  changes: Record<string, AuditChange>;
+  created_at: string;
+}
+
 export interface AccountProfile {
   username: string;
+  role: UserRole;
+  permissions: ProjectPermission[];
+  totp_enabled: boolean;
+  recovery_codes_left: number;
+  two_factor_required: boolean;
+  password_change_required: boolean;
 }
 
 export interface BackupRestoreResult {
@@ -218,6 +318,45 @@ export interface LoginRequest {
 }
 
 // 登录响应
+export interface SSOInfo {
+  enabled: boolean;
+  display_name?: string;
+}
+
+// 启用两步验证的账号先返回 challenge，验证码通过后才返回 token
 export interface LoginResponse {
-  token: string;
+  token?: string;
+  username: string;
+  role?: UserRole;
+  two_factor_required?: boolean;
+  challenge?: string;
+  password_change_required?: boolean;
+  refresh_token?: string;
+  // 访问令牌的有效秒数
+  expires_in?: number;
+}
+
+export interface StreamTicket {
+  ticket: string;
+  expires_in: number;
+}
+
+export interface UserSession {
+  id: number;
+  user_id: number;
+  user_agent: string;
+  client_ip: string;
+  created_at: string;
+  last_used_at: string;
+  expires_at: string;
+  current: boolean;
+}
+
+export interface TwoFactorSetup {
+  secret: string;
+  otpauth_url: string;
+}
+
+export interface RecoveryCodes {
+  recovery_codes: string[];
 }